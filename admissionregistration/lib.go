@@ -36,7 +36,9 @@ func init() {
 var (
 	ErrMissingKind         = errors.New("test object missing kind")
 	ErrMissingVersion      = errors.New("test object missing version")
+	ErrWebhookNotReady     = errors.New("admission webhook server is not ready")
 	ErrWebhookNotActivated = errors.New("admission webhooks are not activated. Enable it by configuring --enable-admission-plugins flag of kube-apiserver. For details, visit: https://appsco.de/kube-apiserver-webhooks")
+	ErrProbeNotDryRun      = errors.New("only create xrays can be probed, other operations persist the test object")
 )
 
 func BypassValidatingWebhookXray() bool {
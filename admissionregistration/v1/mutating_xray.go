@@ -0,0 +1,169 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"strings"
+
+	admreg "kmodules.xyz/client-go/admissionregistration"
+	dynamic_util "kmodules.xyz/client-go/dynamic"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// MutatedFn returns true if the object returned by the API server differs from the submitted object
+// in the way the mutating webhook is expected to patch it.
+type MutatedFn func(submitted, returned *unstructured.Unstructured) bool
+
+// FieldsChanged returns a MutatedFn that reports a mutation if any of the fields differs. Fields are
+// dot separated paths, eg, "metadata.labels" or "spec.template.spec.containers".
+func FieldsChanged(fields ...string) MutatedFn {
+	return func(submitted, returned *unstructured.Unstructured) bool {
+		for _, field := range fields {
+			path := strings.Split(field, ".")
+			a, _, _ := unstructured.NestedFieldNoCopy(submitted.Object, path...)
+			b, _, _ := unstructured.NestedFieldNoCopy(returned.Object, path...)
+			if !equality.Semantic.DeepEqual(a, b) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// DefaultMutatedFn reports a mutation if the labels or annotations changed. These are not touched by
+// API server defaulting, so a change can only come from a webhook.
+var DefaultMutatedFn = FieldsChanged("metadata.labels", "metadata.annotations")
+
+// MutatingWebhookXray checks that a mutating webhook is active by submitting a test object
+// in dry run mode and checking that the returned object was mutated.
+type MutatingWebhookXray struct {
+	config    *rest.Config
+	target    XrayTarget
+	testObj   runtime.Object
+	op        v1.OperationType
+	transform func(_ runtime.Object)
+	mutated   MutatedFn
+	stopCh    <-chan struct{}
+}
+
+// NewCreateMutatingWebhookXray returns a MutatingWebhookXray that creates the test object in dry run mode.
+// A nil mutated uses DefaultMutatedFn.
+func NewCreateMutatingWebhookXray(config *rest.Config, target XrayTarget, testObj runtime.Object, mutated MutatedFn, stopCh <-chan struct{}) *MutatingWebhookXray {
+	return &MutatingWebhookXray{
+		config:  config,
+		target:  target,
+		testObj: testObj,
+		op:      v1.Create,
+		mutated: mutated,
+		stopCh:  stopCh,
+	}
+}
+
+// NewUpdateMutatingWebhookXray returns a MutatingWebhookXray that creates the test object, then updates
+// it with transform in dry run mode. A nil mutated uses DefaultMutatedFn.
+func NewUpdateMutatingWebhookXray(config *rest.Config, target XrayTarget, testObj runtime.Object, transform func(_ runtime.Object), mutated MutatedFn, stopCh <-chan struct{}) *MutatingWebhookXray {
+	return &MutatingWebhookXray{
+		config:    config,
+		target:    target,
+		testObj:   testObj,
+		op:        v1.Update,
+		transform: transform,
+		mutated:   mutated,
+		stopCh:    stopCh,
+	}
+}
+
+func (d MutatingWebhookXray) IsActive(ctx context.Context) error {
+	return waitUntilActive(d.stopCh, "MutatingWebhook", d.target, d.check)
+}
+
+// Probe checks the webhook once and records the result on the target. Only create xrays can be probed,
+// as update xrays persist the test object.
+func (d MutatingWebhookXray) Probe(ctx context.Context) error {
+	if d.op != v1.Create {
+		return admreg.ErrProbeNotDryRun
+	}
+	return probe(ctx, d.target, d.check)
+}
+
+func (d MutatingWebhookXray) check(ctx context.Context) (bool, error) {
+	ri, u, objJson, accessor, err := testResource(d.config, d.testObj, "MutatingWebhook")
+	if err != nil {
+		return false, err
+	}
+	mutated := d.mutated
+	if mutated == nil {
+		mutated = DefaultMutatedFn
+	}
+	dryRun := []string{metav1.DryRunAll}
+
+	switch d.op {
+	case v1.Create:
+		out, err := ri.Create(ctx, u, metav1.CreateOptions{DryRun: dryRun})
+		if err != nil {
+			return false, err
+		}
+		if mutated(u, out) {
+			return true, nil
+		}
+		return false, admreg.ErrWebhookNotActivated
+	case v1.Update:
+		_, err := ri.Create(ctx, u, metav1.CreateOptions{})
+		if err != nil {
+			return false, err
+		}
+		defer func() { _ = dynamic_util.WaitUntilDeleted(ri, d.stopCh, accessor.GetName()) }()
+
+		// the object returned by create is already mutated by the webhook and a working webhook mutates
+		// it again on update, so the result is compared against the test object with the transform applied
+		mod := d.testObj.DeepCopyObject()
+		d.transform(mod)
+		modJson, err := json.Marshal(mod)
+		if err != nil {
+			return false, err
+		}
+		patch, err := jsonpatch.CreateMergePatch(objJson, modJson)
+		if err != nil {
+			return false, err
+		}
+		expected := unstructured.Unstructured{}
+		if _, _, err = unstructured.UnstructuredJSONScheme.Decode(modJson, nil, &expected); err != nil {
+			return false, err
+		}
+
+		out, err := ri.Patch(ctx, accessor.GetName(), types.MergePatchType, patch, metav1.PatchOptions{DryRun: dryRun})
+		if err != nil {
+			return false, err
+		}
+		if mutated(&expected, out) {
+			return true, nil
+		}
+		klog.V(10).Infof("test object %s was not mutated on update", accessor.GetName())
+		return false, admreg.ErrWebhookNotActivated
+	}
+	return false, nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	admreg "kmodules.xyz/client-go/admissionregistration"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	v1 "k8s.io/api/admissionregistration/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+// fakeMutatingAPIServer serves ConfigMaps and, if enabled, mutates them like an idempotent mutating
+// webhook that adds a label on create and update.
+type fakeMutatingAPIServer struct {
+	mu      sync.Mutex
+	enabled bool
+	objects map[string][]byte
+}
+
+func (s *fakeMutatingAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	const prefix = "/api/v1/namespaces/default/configmaps"
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.URL.Path == "/api":
+		_, _ = io.WriteString(w, `{"kind":"APIVersions","versions":["v1"]}`)
+	case r.URL.Path == "/apis":
+		_, _ = io.WriteString(w, `{"kind":"APIGroupList","apiVersion":"v1","groups":[]}`)
+	case r.URL.Path == "/api/v1":
+		_, _ = io.WriteString(w, `{"kind":"APIResourceList","groupVersion":"v1","resources":[{"name":"configmaps","namespaced":true,"kind":"ConfigMap","verbs":["create","delete","get","patch"]}]}`)
+	case r.URL.Path == prefix && r.Method == http.MethodPost:
+		body, _ := io.ReadAll(r.Body)
+		s.write(w, r, http.StatusCreated, body)
+	case strings.HasPrefix(r.URL.Path, prefix+"/"):
+		name := strings.TrimPrefix(r.URL.Path, prefix+"/")
+		stored, found := s.objects[name]
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			_, _ = w.Write(stored)
+		case http.MethodPatch:
+			patch, _ := io.ReadAll(r.Body)
+			body, err := jsonpatch.MergePatch(stored, patch)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.write(w, r, http.StatusOK, body)
+		case http.MethodDelete:
+			delete(s.objects, name)
+			_, _ = io.WriteString(w, `{"kind":"Status","apiVersion":"v1","status":"Success"}`)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *fakeMutatingAPIServer) write(w http.ResponseWriter, r *http.Request, code int, body []byte) {
+	var obj core.ConfigMap
+	if err := json.Unmarshal(body, &obj); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if s.enabled {
+		if obj.Labels == nil {
+			obj.Labels = map[string]string{}
+		}
+		obj.Labels["injected"] = "true"
+	}
+	out, _ := json.Marshal(obj)
+	if r.URL.Query().Get("dryRun") == "" {
+		s.objects[obj.Name] = out
+	}
+	w.WriteHeader(code)
+	_, _ = w.Write(out)
+}
+
+func TestMutatingWebhookXrayUpdate(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		srv := &fakeMutatingAPIServer{enabled: enabled, objects: map[string][]byte{}}
+		ts := httptest.NewServer(srv)
+
+		testObj := &core.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+			ObjectMeta: metav1.ObjectMeta{Name: "xray", Namespace: "default", Labels: map[string]string{"app": "xray"}},
+		}
+		d := NewUpdateMutatingWebhookXray(&rest.Config{Host: ts.URL}, nil, testObj, func(obj runtime.Object) {
+			obj.(*core.ConfigMap).Data = map[string]string{"updated": "true"}
+		}, nil, nil)
+		if d.op != v1.Update {
+			t.Fatalf("unexpected op %s", d.op)
+		}
+
+		active, err := d.check(context.TODO())
+		switch {
+		case enabled && (!active || err != nil):
+			t.Errorf("expected an idempotent webhook to be detected as active, got %v, %v", active, err)
+		case !enabled && (active || err != admreg.ErrWebhookNotActivated):
+			t.Errorf("expected a disabled webhook to be detected as not active, got %v, %v", active, err)
+		}
+		if len(srv.objects) != 0 {
+			t.Errorf("expected the test object to be deleted")
+		}
+		ts.Close()
+	}
+}
@@ -18,38 +18,25 @@ package v1
 
 import (
 	"context"
-	"fmt"
 	"strings"
 
 	admreg "kmodules.xyz/client-go/admissionregistration"
-	apireg_util "kmodules.xyz/client-go/apiregistration/v1"
-	core_util "kmodules.xyz/client-go/core/v1"
-	"kmodules.xyz/client-go/discovery"
 	dynamic_util "kmodules.xyz/client-go/dynamic"
-	meta_util "kmodules.xyz/client-go/meta"
 
 	jsonpatch "github.com/evanphx/json-patch"
 	v1 "k8s.io/api/admissionregistration/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
-	apiregistration "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
-	apireg_cs "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
 	kutil "kmodules.xyz/client-go"
 )
 
 type ValidatingWebhookXray struct {
 	config    *rest.Config
-	apisvc    string
+	target    XrayTarget
 	testObj   runtime.Object
 	op        v1.OperationType
 	transform func(_ runtime.Object)
@@ -59,7 +46,7 @@ type ValidatingWebhookXray struct {
 func NewCreateValidatingWebhookXray(config *rest.Config, apisvc string, testObj runtime.Object, stopCh <-chan struct{}) *ValidatingWebhookXray {
 	return &ValidatingWebhookXray{
 		config:    config,
-		apisvc:    apisvc,
+		target:    APIServiceTarget(config, apisvc),
 		testObj:   testObj,
 		op:        v1.Create,
 		transform: nil,
@@ -70,7 +57,7 @@ func NewCreateValidatingWebhookXray(config *rest.Config, apisvc string, testObj
 func NewUpdateValidatingWebhookXray(config *rest.Config, apisvc string, testObj runtime.Object, transform func(_ runtime.Object), stopCh <-chan struct{}) *ValidatingWebhookXray {
 	return &ValidatingWebhookXray{
 		config:    config,
-		apisvc:    apisvc,
+		target:    APIServiceTarget(config, apisvc),
 		testObj:   testObj,
 		op:        v1.Update,
 		transform: transform,
@@ -81,7 +68,7 @@ func NewUpdateValidatingWebhookXray(config *rest.Config, apisvc string, testObj
 func NewDeleteValidatingWebhookXray(config *rest.Config, apisvc string, testObj runtime.Object, transform func(_ runtime.Object), stopCh <-chan struct{}) *ValidatingWebhookXray {
 	return &ValidatingWebhookXray{
 		config:    config,
-		apisvc:    apisvc,
+		target:    APIServiceTarget(config, apisvc),
 		testObj:   testObj,
 		op:        v1.Delete,
 		transform: transform,
@@ -103,162 +90,42 @@ func retry(err error) error {
 	return err
 }
 
-func (d ValidatingWebhookXray) IsActive(ctx context.Context) error {
-	kc := kubernetes.NewForConfigOrDie(d.config)
-	apireg := apireg_cs.NewForConfigOrDie(d.config)
+// WithTarget sets the object that serves the webhook. Defaults to the APIService passed to the constructor.
+func (d *ValidatingWebhookXray) WithTarget(target XrayTarget) *ValidatingWebhookXray {
+	d.target = target
+	return d
+}
 
+func (d ValidatingWebhookXray) IsActive(ctx context.Context) error {
 	if admreg.BypassValidatingWebhookXray() {
-		apisvc, err := apireg.ApiregistrationV1().APIServices().Get(ctx, d.apisvc, metav1.GetOptions{})
-		if err == nil {
-			_ = d.updateAPIService(ctx, apireg, apisvc, nil)
-		}
+		_ = d.target.Record(ctx, nil)
 		return nil
 	}
-
-	attempt := 0
-	var failures []string
-	return wait.PollUntilContextCancel(wait.ContextForChannel(d.stopCh), kutil.RetryInterval, true, func(ctx context.Context) (bool, error) {
-		apisvc, err := apireg.ApiregistrationV1().APIServices().Get(ctx, d.apisvc, metav1.GetOptions{})
-		if err != nil {
-			return false, retry(err)
-		}
-		for _, cond := range apisvc.Status.Conditions {
-			if cond.Type == apiregistration.Available && cond.Status == apiregistration.ConditionTrue {
-				// Kubernetes is slow to update APIService.status. So, we double check that the pods are running and ready.
-				if apisvc.Spec.Service != nil {
-					svc, err := kc.CoreV1().Services(apisvc.Spec.Service.Namespace).Get(ctx, apisvc.Spec.Service.Name, metav1.GetOptions{})
-					if err != nil {
-						return false, retry(err)
-					}
-
-					pods, err := kc.CoreV1().Pods(apisvc.Spec.Service.Namespace).List(ctx, metav1.ListOptions{
-						LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
-					})
-					if err != nil {
-						return false, retry(err)
-					}
-					if len(pods.Items) == 0 {
-						return false, nil
-					}
-					for _, pod := range pods.Items {
-						ready, _ := core_util.PodRunningAndReady(pod)
-						if !ready {
-							return false, nil
-						}
-					}
-				}
-				attempt++
-				active, err := d.check(ctx)
-				if err != nil {
-					failures = append(failures, fmt.Sprintf("Attempt %d to detect ValidatingWebhook activation failed due to %s", attempt, err.Error()))
-				}
-				err = retry(err)
-				if active || err != nil {
-					_ = d.updateAPIService(ctx, apireg, apisvc, err)
-				}
-				if err != nil {
-					// log failures only if xray fails, otherwise don't confuse users with intermediate failures.
-					for _, msg := range failures {
-						klog.Warningln(msg)
-					}
-				}
-				return active, err
-			}
-		}
-		return false, nil
+	return waitUntilActive(d.stopCh, "ValidatingWebhook", d.target, func(ctx context.Context) (bool, error) {
+		return d.check(ctx, nil)
 	})
 }
 
-func (d ValidatingWebhookXray) updateAPIService(ctx context.Context, apireg apireg_cs.Interface, apisvc *apiregistration.APIService, err error) error {
-	fn := func(annotations map[string]string) map[string]string {
-		if len(annotations) == 0 {
-			annotations = map[string]string{}
-		}
-		if err == nil {
-			annotations[admreg.KeyAdmissionWebhookActive] = "true"
-			annotations[admreg.KeyAdmissionWebhookStatus] = ""
-		} else {
-			annotations[admreg.KeyAdmissionWebhookActive] = "false"
-			annotations[admreg.KeyAdmissionWebhookStatus] = string(kerr.ReasonForError(err)) + "|" + err.Error()
-		}
-		return annotations
+// Probe checks the webhook once and records the result on the target. The test object is created in
+// dry run mode, so that periodic probes never persist it. Only create xrays can be probed.
+func (d ValidatingWebhookXray) Probe(ctx context.Context) error {
+	if d.op != v1.Create {
+		return admreg.ErrProbeNotDryRun
 	}
-
-	_, _, e3 := apireg_util.PatchAPIService(ctx, apireg, apisvc, func(in *apiregistration.APIService) *apiregistration.APIService {
-		data, ok := in.Annotations[meta_util.LastAppliedConfigAnnotation]
-		if ok {
-			u, e2 := runtime.Decode(unstructured.UnstructuredJSONScheme, []byte(data))
-			if e2 != nil {
-				goto LastAppliedConfig
-			}
-			m, e2 := meta.Accessor(u)
-			if e2 != nil {
-				goto LastAppliedConfig
-			}
-			m.SetAnnotations(fn(m.GetAnnotations()))
-			if mod, err := runtime.Encode(unstructured.UnstructuredJSONScheme, u); err == nil {
-				in.Annotations[meta_util.LastAppliedConfigAnnotation] = string(mod)
-			}
-		}
-
-	LastAppliedConfig:
-		in.Annotations = fn(in.Annotations)
-		return in
-	}, metav1.PatchOptions{})
-	return e3
+	return probe(ctx, d.target, func(ctx context.Context) (bool, error) {
+		return d.check(ctx, []string{metav1.DryRunAll})
+	})
 }
 
-func (d ValidatingWebhookXray) check(ctx context.Context) (bool, error) {
-	kc, err := kubernetes.NewForConfig(d.config)
-	if err != nil {
-		return false, err
-	}
-
-	dc, err := dynamic.NewForConfig(d.config)
-	if err != nil {
-		return false, err
-	}
-
-	gvk := d.testObj.GetObjectKind().GroupVersionKind()
-	if gvk.Version == "" {
-		return false, admreg.ErrMissingVersion
-	}
-	if gvk.Kind == "" {
-		return false, admreg.ErrMissingKind
-	}
-
-	gvr, err := discovery.ResourceForGVK(kc.Discovery(), gvk)
-	if err != nil {
-		return false, err
-	}
-	klog.Infof("testing ValidatingWebhook using an object with GVR = %s", gvr.String())
-
-	accessor, err := meta.Accessor(d.testObj)
-	if err != nil {
-		return false, err
-	}
-
-	var ri dynamic.ResourceInterface
-	if accessor.GetNamespace() != "" {
-		ri = dc.Resource(gvr).Namespace(accessor.GetNamespace())
-	} else {
-		ri = dc.Resource(gvr)
-	}
-
-	objJson, err := json.Marshal(d.testObj)
-	if err != nil {
-		return false, err
-	}
-
-	u := unstructured.Unstructured{}
-	_, _, err = unstructured.UnstructuredJSONScheme.Decode(objJson, nil, &u)
+func (d ValidatingWebhookXray) check(ctx context.Context, dryRun []string) (bool, error) {
+	ri, u, objJson, accessor, err := testResource(d.config, d.testObj, "ValidatingWebhook")
 	if err != nil {
 		return false, err
 	}
 
 	switch d.op {
 	case v1.Create:
-		_, err := ri.Create(ctx, &u, metav1.CreateOptions{})
+		_, err := ri.Create(ctx, u, metav1.CreateOptions{DryRun: dryRun})
 		if kutil.AdmissionWebhookDeniedRequest(err) {
 			klog.V(10).Infof("failed to create invalid test object as expected with error: %s", err)
 			return true, nil
@@ -266,10 +133,12 @@ func (d ValidatingWebhookXray) check(ctx context.Context) (bool, error) {
 			return false, err
 		}
 
-		_ = dynamic_util.WaitUntilDeleted(ri, d.stopCh, accessor.GetName())
+		if len(dryRun) == 0 {
+			_ = dynamic_util.WaitUntilDeleted(ri, d.stopCh, accessor.GetName())
+		}
 		return false, admreg.ErrWebhookNotActivated
 	case v1.Update:
-		_, err := ri.Create(ctx, &u, metav1.CreateOptions{})
+		_, err := ri.Create(ctx, u, metav1.CreateOptions{})
 		if err != nil {
 			return false, err
 		}
@@ -298,7 +167,7 @@ func (d ValidatingWebhookXray) check(ctx context.Context) (bool, error) {
 
 		return false, admreg.ErrWebhookNotActivated
 	case v1.Delete:
-		_, err := ri.Create(ctx, &u, metav1.CreateOptions{})
+		_, err := ri.Create(ctx, u, metav1.CreateOptions{})
 		if err != nil {
 			return false, err
 		}
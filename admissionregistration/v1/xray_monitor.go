@@ -0,0 +1,144 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// Prober checks an admission webhook once. It is implemented by ValidatingWebhookXray and MutatingWebhookXray.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// XrayMonitor probes admission webhooks periodically and reports whether all of them are active.
+// It can be used as a readiness endpoint, so that a webhook that silently stops working is noticed.
+type XrayMonitor struct {
+	interval time.Duration
+
+	mu      sync.RWMutex
+	probers map[string]Prober
+	results map[string]error
+}
+
+// DefaultXrayInterval is used by XrayMonitor when the interval is not positive.
+const DefaultXrayInterval = time.Minute
+
+// NewXrayMonitor returns a XrayMonitor that probes the webhooks at the given interval.
+func NewXrayMonitor(interval time.Duration) *XrayMonitor {
+	if interval <= 0 {
+		interval = DefaultXrayInterval
+	}
+	return &XrayMonitor{
+		interval: interval,
+		probers:  map[string]Prober{},
+		results:  map[string]error{},
+	}
+}
+
+// Add registers a webhook to be probed under the given name.
+func (m *XrayMonitor) Add(name string, p Prober) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.probers[name] = p
+}
+
+// Run probes all the webhooks immediately and then at every interval, until the context is done.
+func (m *XrayMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.ProbeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeAll probes all the webhooks once. Conflicts and throttling by the API server keep the previous result,
+// any other error, including a failure to call the webhook, marks the webhook as not active.
+func (m *XrayMonitor) ProbeAll(ctx context.Context) {
+	m.mu.RLock()
+	probers := make(map[string]Prober, len(m.probers))
+	for name, p := range m.probers {
+		probers[name] = p
+	}
+	m.mu.RUnlock()
+
+	for name, p := range probers {
+		err := p.Probe(ctx)
+		if err != nil && transientProbeError(err) {
+			klog.V(3).Infof("transient failure while probing webhook %s: %v", name, err)
+			m.mu.Lock()
+			if _, found := m.results[name]; !found {
+				m.results[name] = err
+			}
+			m.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			klog.Warningf("webhook %s is not active: %v", name, err)
+		}
+		m.mu.Lock()
+		m.results[name] = err
+		m.mu.Unlock()
+	}
+}
+
+// Check returns an error if any webhook is not active or not probed yet. Its signature matches
+// the controller-runtime healthz.Checker, so it can be added as a readiness check.
+func (m *XrayMonitor) Check(_ *http.Request) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var msgs []string
+	for name := range m.probers {
+		err, found := m.results[name]
+		switch {
+		case !found:
+			msgs = append(msgs, fmt.Sprintf("%s: not probed yet", name))
+		case err != nil:
+			msgs = append(msgs, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("inactive webhooks: %s", strings.Join(msgs, "; "))
+}
+
+// ServeHTTP serves a readiness endpoint that returns 200 if all the webhooks are active, 503 otherwise.
+func (m *XrayMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := m.Check(r); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = fmt.Fprintln(w, err)
+		return
+	}
+	_, _ = fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,149 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	admreg "kmodules.xyz/client-go/admissionregistration"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+type fakeProber struct {
+	err error
+}
+
+func (p *fakeProber) Probe(context.Context) error {
+	return p.err
+}
+
+func TestXrayMonitor(t *testing.T) {
+	ctx := context.TODO()
+	m := NewXrayMonitor(0)
+	validating := &fakeProber{}
+	mutating := &fakeProber{}
+	m.Add("validating", validating)
+	m.Add("mutating", mutating)
+
+	if err := m.Check(nil); err == nil {
+		t.Fatalf("expected an error before the first probe")
+	}
+
+	m.ProbeAll(ctx)
+	if err := m.Check(nil); err != nil {
+		t.Fatalf("expected all webhooks to be active, got %v", err)
+	}
+
+	// conflicts and throttling keep the previous result
+	for _, err := range []error{
+		kerr.NewConflict(schema.GroupResource{Resource: "configmaps"}, "test", errors.New("object was modified")),
+		kerr.NewTooManyRequests("throttled", 1),
+	} {
+		mutating.err = err
+		m.ProbeAll(ctx)
+		if err := m.Check(nil); err != nil {
+			t.Fatalf("expected a transient failure to be ignored, got %v", err)
+		}
+	}
+
+	mutating.err = admreg.ErrWebhookNotActivated
+	m.ProbeAll(ctx)
+	if err := m.Check(nil); err == nil {
+		t.Fatalf("expected the mutating webhook to be inactive")
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", rec.Code)
+	}
+
+	mutating.err = nil
+	m.ProbeAll(ctx)
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+}
+
+func TestXrayMonitorWebhookDown(t *testing.T) {
+	ctx := context.TODO()
+	for _, err := range []error{
+		kerr.NewInternalError(errors.New(`failed calling webhook "validators.example.com": failed to call webhook: Post "https://example.svc:443/validate": dial tcp 10.96.0.10:443: connect: connection refused`)),
+		kerr.NewInternalError(errors.New(`failed calling webhook "validators.example.com": failed to call webhook: Post "https://example.svc:443/validate": context deadline exceeded`)),
+		kerr.NewTimeoutError("request did not complete within the allowed duration", 0),
+		kerr.NewServiceUnavailable("unavailable"),
+	} {
+		m := NewXrayMonitor(0)
+		p := &fakeProber{}
+		m.Add("validating", p)
+		m.ProbeAll(ctx)
+
+		p.err = err
+		m.ProbeAll(ctx)
+		if m.Check(nil) == nil {
+			t.Errorf("expected the webhook to be inactive on %v", err)
+		}
+	}
+}
+
+func TestProbeRequiresCreateXray(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	transform := func(runtime.Object) {}
+
+	if err := NewUpdateValidatingWebhookXray(&rest.Config{}, "v1.example.com", obj, transform, nil).Probe(context.TODO()); !errors.Is(err, admreg.ErrProbeNotDryRun) {
+		t.Errorf("expected update validating xray to be refused, got %v", err)
+	}
+	if err := NewDeleteValidatingWebhookXray(&rest.Config{}, "v1.example.com", obj, transform, nil).Probe(context.TODO()); !errors.Is(err, admreg.ErrProbeNotDryRun) {
+		t.Errorf("expected delete validating xray to be refused, got %v", err)
+	}
+	if err := NewUpdateMutatingWebhookXray(&rest.Config{}, APIServiceTarget(&rest.Config{}, "v1.example.com"), obj, transform, nil, nil).Probe(context.TODO()); !errors.Is(err, admreg.ErrProbeNotDryRun) {
+		t.Errorf("expected update mutating xray to be refused, got %v", err)
+	}
+}
+
+func TestFieldsChanged(t *testing.T) {
+	submitted := &unstructured.Unstructured{}
+	submitted.SetGroupVersionKind(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	submitted.SetName("test")
+	submitted.SetLabels(map[string]string{"app": "test"})
+
+	returned := submitted.DeepCopy()
+	_ = unstructured.SetNestedField(returned.Object, "true", "data", "defaulted")
+	if DefaultMutatedFn(submitted, returned) {
+		t.Errorf("data changes must not be reported by DefaultMutatedFn")
+	}
+	if !FieldsChanged("data")(submitted, returned) {
+		t.Errorf("expected data to be changed")
+	}
+
+	returned.SetLabels(map[string]string{"app": "test", "injected": "true"})
+	if !DefaultMutatedFn(submitted, returned) {
+		t.Errorf("expected label changes to be reported")
+	}
+}
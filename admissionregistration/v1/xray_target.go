@@ -0,0 +1,351 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	admreg "kmodules.xyz/client-go/admissionregistration"
+	apireg_util "kmodules.xyz/client-go/apiregistration/v1"
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/discovery"
+	meta_util "kmodules.xyz/client-go/meta"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	apiregistration "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	apireg_cs "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
+	kutil "kmodules.xyz/client-go"
+)
+
+// XrayTarget is the object that registers an admission webhook. It decides when the webhook server
+// is ready to be probed and records the result of the probe.
+type XrayTarget interface {
+	Ready(ctx context.Context) (bool, error)
+	Record(ctx context.Context, err error) error
+}
+
+type apiServiceTarget struct {
+	config *rest.Config
+	name   string
+}
+
+// APIServiceTarget returns a XrayTarget for webhooks served by an aggregated APIService.
+// The result is recorded as annotations on the APIService.
+func APIServiceTarget(config *rest.Config, name string) XrayTarget {
+	return &apiServiceTarget{config: config, name: name}
+}
+
+func (t *apiServiceTarget) Ready(ctx context.Context) (bool, error) {
+	apireg, err := apireg_cs.NewForConfig(t.config)
+	if err != nil {
+		return false, err
+	}
+	apisvc, err := apireg.ApiregistrationV1().APIServices().Get(ctx, t.name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, cond := range apisvc.Status.Conditions {
+		if cond.Type == apiregistration.Available && cond.Status == apiregistration.ConditionTrue {
+			// Kubernetes is slow to update APIService.status. So, we double check that the pods are running and ready.
+			if apisvc.Spec.Service != nil {
+				return servicePodsReady(ctx, t.config, apisvc.Spec.Service.Namespace, apisvc.Spec.Service.Name)
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *apiServiceTarget) Record(ctx context.Context, err error) error {
+	apireg, e2 := apireg_cs.NewForConfig(t.config)
+	if e2 != nil {
+		return e2
+	}
+	apisvc, e2 := apireg.ApiregistrationV1().APIServices().Get(ctx, t.name, metav1.GetOptions{})
+	if e2 != nil {
+		return e2
+	}
+	_, _, e2 = apireg_util.PatchAPIService(ctx, apireg, apisvc, func(in *apiregistration.APIService) *apiregistration.APIService {
+		in.Annotations = xrayAnnotations(in.Annotations, err)
+		return in
+	}, metav1.PatchOptions{})
+	return e2
+}
+
+type webhookConfigurationTarget struct {
+	config   *rest.Config
+	name     string
+	mutating bool
+}
+
+// ValidatingWebhookConfigurationTarget returns a XrayTarget for the webhooks of a ValidatingWebhookConfiguration.
+// Webhooks with a Service clientConfig are ready once the pods of the Service are ready. Webhooks with a URL
+// clientConfig are always considered ready. The result is recorded as annotations on the configuration.
+func ValidatingWebhookConfigurationTarget(config *rest.Config, name string) XrayTarget {
+	return &webhookConfigurationTarget{config: config, name: name}
+}
+
+// MutatingWebhookConfigurationTarget returns a XrayTarget for the webhooks of a MutatingWebhookConfiguration.
+// See ValidatingWebhookConfigurationTarget.
+func MutatingWebhookConfigurationTarget(config *rest.Config, name string) XrayTarget {
+	return &webhookConfigurationTarget{config: config, name: name, mutating: true}
+}
+
+func (t *webhookConfigurationTarget) Ready(ctx context.Context) (bool, error) {
+	kc, err := kubernetes.NewForConfig(t.config)
+	if err != nil {
+		return false, err
+	}
+
+	var services []*v1.ServiceReference
+	if t.mutating {
+		cur, err := kc.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, t.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, w := range cur.Webhooks {
+			services = append(services, w.ClientConfig.Service)
+		}
+	} else {
+		cur, err := kc.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, t.name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		for _, w := range cur.Webhooks {
+			services = append(services, w.ClientConfig.Service)
+		}
+	}
+
+	for _, svc := range services {
+		if svc == nil {
+			continue
+		}
+		ready, err := servicePodsReady(ctx, t.config, svc.Namespace, svc.Name)
+		if !ready || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (t *webhookConfigurationTarget) Record(ctx context.Context, err error) error {
+	kc, e2 := kubernetes.NewForConfig(t.config)
+	if e2 != nil {
+		return e2
+	}
+	if t.mutating {
+		cur, e2 := kc.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, t.name, metav1.GetOptions{})
+		if e2 != nil {
+			return e2
+		}
+		_, _, e2 = PatchMutatingWebhookConfiguration(ctx, kc, cur, func(in *v1.MutatingWebhookConfiguration) *v1.MutatingWebhookConfiguration {
+			in.Annotations = xrayAnnotations(in.Annotations, err)
+			return in
+		}, metav1.PatchOptions{})
+		return e2
+	}
+	cur, e2 := kc.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, t.name, metav1.GetOptions{})
+	if e2 != nil {
+		return e2
+	}
+	_, _, e2 = PatchValidatingWebhookConfiguration(ctx, kc, cur, func(in *v1.ValidatingWebhookConfiguration) *v1.ValidatingWebhookConfiguration {
+		in.Annotations = xrayAnnotations(in.Annotations, err)
+		return in
+	}, metav1.PatchOptions{})
+	return e2
+}
+
+func servicePodsReady(ctx context.Context, config *rest.Config, namespace, name string) (bool, error) {
+	kc, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return false, err
+	}
+	svc, err := kc.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+	if len(svc.Spec.Selector) == 0 {
+		// endpoints are managed externally
+		return true, nil
+	}
+	pods, err := kc.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(pods.Items) == 0 {
+		return false, nil
+	}
+	for _, pod := range pods.Items {
+		ready, _ := core_util.PodRunningAndReady(pod)
+		if !ready {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// xrayAnnotations sets the xray result annotations, including in the last applied configuration if present.
+func xrayAnnotations(annotations map[string]string, err error) map[string]string {
+	fn := func(annotations map[string]string) map[string]string {
+		if len(annotations) == 0 {
+			annotations = map[string]string{}
+		}
+		if err == nil {
+			annotations[admreg.KeyAdmissionWebhookActive] = "true"
+			annotations[admreg.KeyAdmissionWebhookStatus] = ""
+		} else {
+			annotations[admreg.KeyAdmissionWebhookActive] = "false"
+			annotations[admreg.KeyAdmissionWebhookStatus] = string(kerr.ReasonForError(err)) + "|" + err.Error()
+		}
+		return annotations
+	}
+
+	if data, ok := annotations[meta_util.LastAppliedConfigAnnotation]; ok {
+		if u, e2 := runtime.Decode(unstructured.UnstructuredJSONScheme, []byte(data)); e2 == nil {
+			if m, e2 := meta.Accessor(u); e2 == nil {
+				m.SetAnnotations(fn(m.GetAnnotations()))
+				if mod, err := runtime.Encode(unstructured.UnstructuredJSONScheme, u); err == nil {
+					annotations[meta_util.LastAppliedConfigAnnotation] = string(mod)
+				}
+			}
+		}
+	}
+	return fn(annotations)
+}
+
+// waitUntilActive probes the webhook until it is active or fails with a non transient error.
+func waitUntilActive(stopCh <-chan struct{}, kind string, target XrayTarget, check func(context.Context) (bool, error)) error {
+	attempt := 0
+	var failures []string
+	return wait.PollUntilContextCancel(wait.ContextForChannel(stopCh), kutil.RetryInterval, true, func(ctx context.Context) (bool, error) {
+		ready, err := target.Ready(ctx)
+		if err != nil {
+			return false, retry(err)
+		}
+		if !ready {
+			return false, nil
+		}
+
+		attempt++
+		active, err := check(ctx)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("Attempt %d to detect %s activation failed due to %s", attempt, kind, err.Error()))
+		}
+		err = retry(err)
+		if active || err != nil {
+			_ = target.Record(ctx, err)
+		}
+		if err != nil {
+			// log failures only if xray fails, otherwise don't confuse users with intermediate failures.
+			for _, msg := range failures {
+				klog.Warningln(msg)
+			}
+		}
+		return active, err
+	})
+}
+
+// probe checks the webhook once. Conflicts and throttling by the API server are returned without being recorded.
+func probe(ctx context.Context, target XrayTarget, check func(context.Context) (bool, error)) error {
+	ready, err := target.Ready(ctx)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return admreg.ErrWebhookNotReady
+	}
+	active, err := check(ctx)
+	if err == nil && !active {
+		err = admreg.ErrWebhookNotActivated
+	}
+	if !transientProbeError(err) {
+		_ = target.Record(ctx, err)
+	}
+	return err
+}
+
+// transientProbeError returns true if the probe failed because of the API server, not the webhook.
+// Unlike retry, failures to call the webhook, eg, timeouts or refused connections, are not transient
+// for a probe, as they mean the webhook is down.
+func transientProbeError(err error) bool {
+	return kerr.IsConflict(err) || kerr.IsTooManyRequests(err)
+}
+
+// testResource returns the client for the test object and the object as unstructured and json.
+func testResource(config *rest.Config, testObj runtime.Object, kind string) (dynamic.ResourceInterface, *unstructured.Unstructured, []byte, metav1.Object, error) {
+	kc, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	dc, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	gvk := testObj.GetObjectKind().GroupVersionKind()
+	if gvk.Version == "" {
+		return nil, nil, nil, nil, admreg.ErrMissingVersion
+	}
+	if gvk.Kind == "" {
+		return nil, nil, nil, nil, admreg.ErrMissingKind
+	}
+
+	gvr, err := discovery.ResourceForGVK(kc.Discovery(), gvk)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	klog.Infof("testing %s using an object with GVR = %s", kind, gvr.String())
+
+	accessor, err := meta.Accessor(testObj)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var ri dynamic.ResourceInterface
+	if accessor.GetNamespace() != "" {
+		ri = dc.Resource(gvr).Namespace(accessor.GetNamespace())
+	} else {
+		ri = dc.Resource(gvr)
+	}
+
+	objJson, err := json.Marshal(testObj)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	u := unstructured.Unstructured{}
+	_, _, err = unstructured.UnstructuredJSONScheme.Decode(objJson, nil, &u)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return ri, &u, objJson, accessor, nil
+}
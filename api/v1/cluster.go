@@ -35,7 +35,9 @@ const (
 	HostingProviderExoscale     HostingProvider = "Exoscale"
 	HostingProviderGeneric      HostingProvider = "Generic"
 	HostingProviderGKE          HostingProvider = "GKE"
+	HostingProviderIKS          HostingProvider = "IKS"
 	HostingProviderLinode       HostingProvider = "Linode"
+	HostingProviderOKE          HostingProvider = "OKE"
 	HostingProviderAkamai       HostingProvider = "Akamai"
 	HostingProviderPacket       HostingProvider = "Packet"
 	HostingProviderRancher      HostingProvider = "Rancher"
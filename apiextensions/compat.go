@@ -0,0 +1,342 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// UpgradePolicy decides what happens when a CRD upgrade contains breaking changes.
+type UpgradePolicy string
+
+const (
+	// UpgradePolicyRefuse refuses to update a CRD with breaking changes.
+	UpgradePolicyRefuse UpgradePolicy = "Refuse"
+	// UpgradePolicyWarn logs the breaking changes and updates the CRD anyway.
+	UpgradePolicyWarn UpgradePolicy = "Warn"
+	// UpgradePolicyForce updates the CRD without checking for breaking changes.
+	UpgradePolicyForce UpgradePolicy = "Force"
+)
+
+// ChangeType identifies a kind of schema change between two revisions of a CRD.
+type ChangeType string
+
+const (
+	ChangeFieldRemoved           ChangeType = "FieldRemoved"
+	ChangeFieldTypeChanged       ChangeType = "FieldTypeChanged"
+	ChangeEnumNarrowed           ChangeType = "EnumNarrowed"
+	ChangeFieldRequired          ChangeType = "FieldRequired"
+	ChangeVersionRemoved         ChangeType = "VersionRemoved"
+	ChangeServedVersionDropped   ChangeType = "ServedVersionDropped"
+	ChangeStorageVersionSwitched ChangeType = "StorageVersionSwitched"
+)
+
+// SchemaChange describes a single difference between the existing and the new CRD.
+type SchemaChange struct {
+	Version  string
+	Path     string
+	Type     ChangeType
+	Breaking bool
+	Message  string
+}
+
+func (c SchemaChange) String() string {
+	level := "warning"
+	if c.Breaking {
+		level = "breaking"
+	}
+	if c.Path == "" {
+		return fmt.Sprintf("[%s] %s %s: %s", level, c.Version, c.Type, c.Message)
+	}
+	return fmt.Sprintf("[%s] %s %s %s: %s", level, c.Version, c.Path, c.Type, c.Message)
+}
+
+// CompatibilityReport lists the changes between the existing and the new revision of a CRD.
+type CompatibilityReport struct {
+	Name    string
+	Changes []SchemaChange
+}
+
+// HasBreakingChanges returns true if any change is breaking.
+func (r CompatibilityReport) HasBreakingChanges() bool {
+	for _, c := range r.Changes {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// BreakingChanges returns the breaking changes.
+func (r CompatibilityReport) BreakingChanges() []SchemaChange {
+	var out []SchemaChange
+	for _, c := range r.Changes {
+		if c.Breaking {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (r CompatibilityReport) String() string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "CRD %s has %d change(s)", r.Name, len(r.Changes))
+	for _, c := range r.Changes {
+		sb.WriteString("\n  ")
+		sb.WriteString(c.String())
+	}
+	return sb.String()
+}
+
+// IncompatibleUpgradeError is returned when UpgradePolicyRefuse blocks a CRD update.
+type IncompatibleUpgradeError struct {
+	Reports []CompatibilityReport
+}
+
+func (e *IncompatibleUpgradeError) Error() string {
+	msgs := make([]string, 0, len(e.Reports))
+	for _, r := range e.Reports {
+		msgs = append(msgs, r.String())
+	}
+	return "refusing to upgrade CRDs with breaking changes:\n" + strings.Join(msgs, "\n")
+}
+
+// CompareCRDs compares the existing revision of a CRD with the new one. Structural schemas are compared per version.
+// Removed fields, changed types, narrowed enums and newly required fields are breaking. Dropping or no longer serving
+// a version that is listed in the existing status.storedVersions, or switching the storage version without a
+// webhook conversion, is breaking too.
+func CompareCRDs(existing, desired *crdv1.CustomResourceDefinition) CompatibilityReport {
+	report := CompatibilityReport{Name: desired.Name}
+
+	oldVersions := map[string]crdv1.CustomResourceDefinitionVersion{}
+	for _, v := range existing.Spec.Versions {
+		oldVersions[v.Name] = v
+	}
+	newVersions := map[string]crdv1.CustomResourceDefinitionVersion{}
+	for _, v := range desired.Spec.Versions {
+		newVersions[v.Name] = v
+	}
+
+	names := make([]string, 0, len(oldVersions))
+	for name := range oldVersions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		ov := oldVersions[name]
+		stored := slices.Contains(existing.Status.StoredVersions, name)
+		nv, found := newVersions[name]
+		switch {
+		case !found:
+			report.Changes = append(report.Changes, SchemaChange{
+				Version:  name,
+				Type:     ChangeVersionRemoved,
+				Breaking: stored || ov.Served,
+				Message:  versionDropMessage("is removed", stored),
+			})
+			continue
+		case ov.Served && !nv.Served:
+			report.Changes = append(report.Changes, SchemaChange{
+				Version:  name,
+				Type:     ChangeServedVersionDropped,
+				Breaking: stored,
+				Message:  versionDropMessage("is no longer served", stored),
+			})
+		}
+		if ov.Schema != nil && ov.Schema.OpenAPIV3Schema != nil && nv.Schema != nil && nv.Schema.OpenAPIV3Schema != nil {
+			report.Changes = append(report.Changes, compareSchemas(name, "", ov.Schema.OpenAPIV3Schema, nv.Schema.OpenAPIV3Schema)...)
+		}
+	}
+
+	oldStorage, newStorage := storageVersion(existing), storageVersion(desired)
+	if oldStorage != "" && newStorage != "" && oldStorage != newStorage {
+		webhook := desired.Spec.Conversion != nil && desired.Spec.Conversion.Strategy == crdv1.WebhookConverter
+		msg := fmt.Sprintf("storage version switched from %s to %s", oldStorage, newStorage)
+		if !webhook {
+			msg += " without a webhook conversion"
+		}
+		report.Changes = append(report.Changes, SchemaChange{
+			Version:  newStorage,
+			Type:     ChangeStorageVersionSwitched,
+			Breaking: !webhook,
+			Message:  msg,
+		})
+	}
+	return report
+}
+
+func versionDropMessage(what string, stored bool) string {
+	if stored {
+		return fmt.Sprintf("version %s but objects are still stored in it according to status.storedVersions", what)
+	}
+	return fmt.Sprintf("version %s", what)
+}
+
+func storageVersion(crd *crdv1.CustomResourceDefinition) string {
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			return v.Name
+		}
+	}
+	return ""
+}
+
+func compareSchemas(version, path string, old, nu *crdv1.JSONSchemaProps) []SchemaChange {
+	var changes []SchemaChange
+	add := func(t ChangeType, breaking bool, format string, args ...any) {
+		p := path
+		if p == "" {
+			p = "."
+		}
+		changes = append(changes, SchemaChange{
+			Version:  version,
+			Path:     p,
+			Type:     t,
+			Breaking: breaking,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if old.Type != "" && nu.Type != "" && old.Type != nu.Type {
+		add(ChangeFieldTypeChanged, true, "type changed from %s to %s", old.Type, nu.Type)
+		return changes
+	}
+
+	if len(nu.Enum) > 0 {
+		if len(old.Enum) == 0 {
+			add(ChangeEnumNarrowed, true, "enum added to a previously unrestricted field")
+		} else {
+			allowed := map[string]bool{}
+			for _, e := range nu.Enum {
+				allowed[string(e.Raw)] = true
+			}
+			var removed []string
+			for _, e := range old.Enum {
+				if !allowed[string(e.Raw)] {
+					removed = append(removed, string(e.Raw))
+				}
+			}
+			if len(removed) > 0 {
+				add(ChangeEnumNarrowed, true, "enum values removed: %s", strings.Join(removed, ", "))
+			}
+		}
+	}
+
+	for _, r := range nu.Required {
+		if !slices.Contains(old.Required, r) {
+			changes = append(changes, SchemaChange{
+				Version:  version,
+				Path:     path + "." + r,
+				Type:     ChangeFieldRequired,
+				Breaking: true,
+				Message:  "field is newly required",
+			})
+		}
+	}
+
+	preserveUnknown := nu.XPreserveUnknownFields != nil && *nu.XPreserveUnknownFields
+	props := make([]string, 0, len(old.Properties))
+	for name := range old.Properties {
+		props = append(props, name)
+	}
+	sort.Strings(props)
+	for _, name := range props {
+		op := old.Properties[name]
+		np, found := nu.Properties[name]
+		if !found {
+			changes = append(changes, SchemaChange{
+				Version:  version,
+				Path:     path + "." + name,
+				Type:     ChangeFieldRemoved,
+				Breaking: !preserveUnknown,
+				Message:  "field is removed from the schema",
+			})
+			continue
+		}
+		changes = append(changes, compareSchemas(version, path+"."+name, &op, &np)...)
+	}
+
+	if old.Items != nil && old.Items.Schema != nil && nu.Items != nil && nu.Items.Schema != nil {
+		changes = append(changes, compareSchemas(version, path+"[*]", old.Items.Schema, nu.Items.Schema)...)
+	}
+	if old.AdditionalProperties != nil && old.AdditionalProperties.Schema != nil &&
+		nu.AdditionalProperties != nil && nu.AdditionalProperties.Schema != nil {
+		changes = append(changes, compareSchemas(version, path+"[*]", old.AdditionalProperties.Schema, nu.AdditionalProperties.Schema)...)
+	}
+	return changes
+}
+
+// CheckCRDUpgrades compares the CRDs in the cluster with the ones that would be applied by RegisterWithOpts
+// or UpdateWithOpts. CRDs that do not exist yet are skipped.
+func CheckCRDUpgrades(client crd_cs.Interface, crds []*CustomResourceDefinition, preserveConversion bool) ([]CompatibilityReport, error) {
+	var reports []CompatibilityReport
+	for _, crd := range crds {
+		if crd.V1 == nil {
+			continue
+		}
+		existing, err := client.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), crd.V1.Name, metav1.GetOptions{})
+		if kerr.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		desired := transform(crd, preserveConversion)(existing.DeepCopy())
+		if report := CompareCRDs(existing, desired); len(report.Changes) > 0 {
+			reports = append(reports, report)
+		}
+	}
+	return reports, nil
+}
+
+func checkUpgradePolicy(client crd_cs.Interface, crds []*CustomResourceDefinition, preserveConversion bool, policy UpgradePolicy) error {
+	if policy == UpgradePolicyForce {
+		return nil
+	}
+	reports, err := CheckCRDUpgrades(client, crds, preserveConversion)
+	if err != nil {
+		if policy == UpgradePolicyWarn {
+			// the check is advisory, never block the upgrade on it
+			klog.Warningf("failed to check CRD upgrades: %v", err)
+			return nil
+		}
+		return err
+	}
+	var breaking []CompatibilityReport
+	for _, r := range reports {
+		if r.HasBreakingChanges() {
+			breaking = append(breaking, r)
+			klog.Warningln(r.String())
+		} else {
+			klog.Infoln(r.String())
+		}
+	}
+	if len(breaking) > 0 && policy == UpgradePolicyRefuse {
+		return &IncompatibleUpgradeError{Reports: breaking}
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"errors"
+	"testing"
+
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func enum(values ...string) []crdv1.JSON {
+	out := make([]crdv1.JSON, 0, len(values))
+	for _, v := range values {
+		out = append(out, crdv1.JSON{Raw: []byte(`"` + v + `"`)})
+	}
+	return out
+}
+
+func testCRD(versions ...crdv1.CustomResourceDefinitionVersion) *crdv1.CustomResourceDefinition {
+	return &crdv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "foos.example.com"},
+		Spec: crdv1.CustomResourceDefinitionSpec{
+			Group:    "example.com",
+			Names:    crdv1.CustomResourceDefinitionNames{Plural: "foos", Kind: "Foo"},
+			Scope:    crdv1.NamespaceScoped,
+			Versions: versions,
+		},
+	}
+}
+
+func testVersion(name string, served, storage bool, spec crdv1.JSONSchemaProps) crdv1.CustomResourceDefinitionVersion {
+	return crdv1.CustomResourceDefinitionVersion{
+		Name:    name,
+		Served:  served,
+		Storage: storage,
+		Schema: &crdv1.CustomResourceValidation{
+			OpenAPIV3Schema: &crdv1.JSONSchemaProps{
+				Type:       "object",
+				Properties: map[string]crdv1.JSONSchemaProps{"spec": spec},
+			},
+		},
+	}
+}
+
+func changeTypes(r CompatibilityReport) map[ChangeType]SchemaChange {
+	out := map[ChangeType]SchemaChange{}
+	for _, c := range r.Changes {
+		out[c.Type] = c
+	}
+	return out
+}
+
+func TestCompareCRDs(t *testing.T) {
+	oldSpec := crdv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]crdv1.JSONSchemaProps{
+			"mode":     {Type: "string", Enum: enum("A", "B")},
+			"replicas": {Type: "integer"},
+			"image":    {Type: "string"},
+			"tier":     {Type: "string"},
+		},
+	}
+	newSpec := crdv1.JSONSchemaProps{
+		Type:     "object",
+		Required: []string{"image"},
+		Properties: map[string]crdv1.JSONSchemaProps{
+			"mode":     {Type: "string", Enum: enum("A")},
+			"replicas": {Type: "string"},
+			"image":    {Type: "string"},
+			"tier":     {Type: "string", Enum: enum("gold")},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		existing *crdv1.CustomResourceDefinition
+		desired  *crdv1.CustomResourceDefinition
+		stored   []string
+		want     map[ChangeType]string
+		breaking bool
+	}{
+		{
+			name:     "identical",
+			existing: testCRD(testVersion("v1", true, true, oldSpec)),
+			desired:  testCRD(testVersion("v1", true, true, oldSpec)),
+			want:     map[ChangeType]string{},
+		},
+		{
+			name:     "schema changes",
+			existing: testCRD(testVersion("v1", true, true, oldSpec)),
+			desired:  testCRD(testVersion("v1", true, true, newSpec)),
+			want: map[ChangeType]string{
+				ChangeEnumNarrowed:     ".spec.tier",
+				ChangeFieldTypeChanged: ".spec.replicas",
+				ChangeFieldRequired:    ".spec.image",
+			},
+			breaking: true,
+		},
+		{
+			name:     "field removed",
+			existing: testCRD(testVersion("v1", true, true, oldSpec)),
+			desired:  testCRD(testVersion("v1", true, true, crdv1.JSONSchemaProps{Type: "object"})),
+			want:     map[ChangeType]string{ChangeFieldRemoved: ".spec.tier"},
+			breaking: true,
+		},
+		{
+			name:     "served version dropped but not stored",
+			existing: testCRD(testVersion("v1alpha1", true, false, oldSpec), testVersion("v1", true, true, oldSpec)),
+			desired:  testCRD(testVersion("v1alpha1", false, false, oldSpec), testVersion("v1", true, true, oldSpec)),
+			stored:   []string{"v1"},
+			want:     map[ChangeType]string{ChangeServedVersionDropped: ""},
+		},
+		{
+			name:     "served version dropped while stored",
+			existing: testCRD(testVersion("v1alpha1", true, false, oldSpec), testVersion("v1", true, true, oldSpec)),
+			desired:  testCRD(testVersion("v1alpha1", false, false, oldSpec), testVersion("v1", true, true, oldSpec)),
+			stored:   []string{"v1alpha1", "v1"},
+			want:     map[ChangeType]string{ChangeServedVersionDropped: ""},
+			breaking: true,
+		},
+		{
+			name:     "storage version switched",
+			existing: testCRD(testVersion("v1alpha1", true, true, oldSpec), testVersion("v1", true, false, oldSpec)),
+			desired:  testCRD(testVersion("v1alpha1", true, false, oldSpec), testVersion("v1", true, true, oldSpec)),
+			want:     map[ChangeType]string{ChangeStorageVersionSwitched: ""},
+			breaking: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.existing.Status.StoredVersions = tt.stored
+			report := CompareCRDs(tt.existing, tt.desired)
+			got := changeTypes(report)
+			if len(got) != len(tt.want) {
+				t.Fatalf("unexpected changes: %s", report)
+			}
+			for ct, path := range tt.want {
+				c, ok := got[ct]
+				if !ok {
+					t.Errorf("missing change %s in %s", ct, report)
+					continue
+				}
+				if c.Path != path {
+					t.Errorf("change %s: expected path %q, got %q", ct, path, c.Path)
+				}
+			}
+			if report.HasBreakingChanges() != tt.breaking {
+				t.Errorf("expected breaking=%v, got report %s", tt.breaking, report)
+			}
+		})
+	}
+}
+
+func TestCompareCRDsWebhookConversion(t *testing.T) {
+	spec := crdv1.JSONSchemaProps{Type: "object"}
+	existing := testCRD(testVersion("v1alpha1", true, true, spec), testVersion("v1", true, false, spec))
+	desired := testCRD(testVersion("v1alpha1", true, false, spec), testVersion("v1", true, true, spec))
+	desired.Spec.Conversion = &crdv1.CustomResourceConversion{Strategy: crdv1.WebhookConverter}
+
+	report := CompareCRDs(existing, desired)
+	if len(report.Changes) != 1 || report.HasBreakingChanges() {
+		t.Errorf("expected a non breaking storage version switch, got %s", report)
+	}
+}
+
+func TestRegisterWithPolicy(t *testing.T) {
+	spec := crdv1.JSONSchemaProps{
+		Type:       "object",
+		Properties: map[string]crdv1.JSONSchemaProps{"image": {Type: "string"}},
+	}
+	existing := testCRD(testVersion("v1", true, true, spec))
+	client := fake.NewSimpleClientset(existing)
+
+	crds := []*CustomResourceDefinition{{V1: testCRD(testVersion("v1", true, true, crdv1.JSONSchemaProps{Type: "object"}))}}
+	err := RegisterWithPolicy(client, crds, false, UpgradePolicyRefuse)
+	var incompatible *IncompatibleUpgradeError
+	if !errors.As(err, &incompatible) {
+		t.Fatalf("expected IncompatibleUpgradeError, got %v", err)
+	}
+	if len(incompatible.Reports) != 1 || incompatible.Reports[0].Name != existing.Name {
+		t.Errorf("unexpected reports: %v", incompatible.Reports)
+	}
+
+	reports, err := CheckCRDUpgrades(client, crds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || !reports[0].HasBreakingChanges() {
+		t.Errorf("unexpected reports: %v", reports)
+	}
+}
+
+func TestCheckUpgradePolicyIgnoresErrorsInWarnMode(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("get", "customresourcedefinitions", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerr.NewForbidden(crdv1.Resource("customresourcedefinitions"), "foos.example.com", errors.New("rbac"))
+	})
+	crds := []*CustomResourceDefinition{{V1: testCRD(testVersion("v1", true, true, crdv1.JSONSchemaProps{Type: "object"}))}}
+
+	if err := checkUpgradePolicy(client, crds, false, UpgradePolicyWarn); err != nil {
+		t.Errorf("expected warn policy to ignore the failed check, got %v", err)
+	}
+	if err := checkUpgradePolicy(client, crds, false, UpgradePolicyRefuse); err == nil {
+		t.Error("expected refuse policy to fail on the failed check")
+	}
+}
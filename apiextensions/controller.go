@@ -18,110 +18,346 @@ package apiextensions
 
 import (
 	"context"
+	"slices"
+	"strings"
 	"sync"
 
+	"gomodules.xyz/pointer"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type (
 	SetupFn func(context.Context, ctrl.Manager)
 	TestFn  func(meta.RESTMapper, *apiextensionsv1.CustomResourceDefinition) bool
+
+	// StopFn stops the controllers started by a DynamicSetupFn.
+	StopFn func()
+	// DynamicSetupFn starts controllers for a CRD and returns a function to stop them.
+	// It is called again if the CRD is recreated or its served versions change.
+	DynamicSetupFn func(context.Context, ctrl.Manager) (StopFn, error)
 )
 
 type setupGroup struct {
 	gks []schema.GroupKind
-	fn  SetupFn
+	fn  DynamicSetupFn
+	// once is set for setups registered via RegisterSetup or MultiRegisterSetup. They are never stopped or run again.
+	once bool
+}
+
+type activeSetup struct {
+	group *setupGroup
+	// crd name and served versions of every GroupKind of the group, used to detect changes
+	crds     map[schema.GroupKind]string
+	versions map[schema.GroupKind]string
+	stop     StopFn
 }
 
 type crdParamKey struct{}
 
-var (
-	setupFns  = make(map[schema.GroupKind]setupGroup)
-	testFns   = make(map[schema.GroupKind]TestFn)
-	setupDone = map[schema.GroupKind]bool{}
-	CRDParam  = crdParamKey{}
-	mu        sync.Mutex
-)
+var CRDParam = crdParamKey{}
+
+// SetupRegistry keeps the setup functions of controllers that depend on CRDs and tracks
+// the ones that are running.
+type SetupRegistry struct {
+	// syncMu serializes sync and teardown, mu guards the maps
+	syncMu   sync.Mutex
+	mu       sync.Mutex
+	setupFns map[schema.GroupKind]*setupGroup
+	testFns  map[schema.GroupKind]TestFn
+	active   map[schema.GroupKind]*activeSetup
+	done     map[schema.GroupKind]bool
+}
+
+func NewSetupRegistry() *SetupRegistry {
+	return &SetupRegistry{
+		setupFns: map[schema.GroupKind]*setupGroup{},
+		testFns:  map[schema.GroupKind]TestFn{},
+		active:   map[schema.GroupKind]*activeSetup{},
+		done:     map[schema.GroupKind]bool{},
+	}
+}
+
+// DefaultSetupRegistry is used by RegisterSetup, MultiRegisterSetup and NewReconciler.
+var DefaultSetupRegistry = NewSetupRegistry()
 
 type Reconciler struct {
-	ctx context.Context
-	mgr ctrl.Manager
+	ctx      context.Context
+	mgr      ctrl.Manager
+	registry *SetupRegistry
 }
 
 func NewReconciler(ctx context.Context, mgr ctrl.Manager) *Reconciler {
-	return &Reconciler{ctx: ctx, mgr: mgr}
+	return DefaultSetupRegistry.NewReconciler(ctx, mgr)
+}
+
+// NewReconciler returns a Reconciler that runs the setup functions of this registry.
+func (r *SetupRegistry) NewReconciler(ctx context.Context, mgr ctrl.Manager) *Reconciler {
+	return &Reconciler{ctx: ctx, mgr: mgr, registry: r}
 }
 
 func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 	var crd apiextensionsv1.CustomResourceDefinition
-	if err := r.mgr.GetClient().Get(ctx, req.NamespacedName, &crd); err != nil {
+	if err := r.mgr.GetClient().Get(ctx, req.NamespacedName, &crd); kerr.IsNotFound(err) {
+		r.registry.teardown(ctx, req.Name)
+		return ctrl.Result{}, nil
+	} else if err != nil {
 		log.Error(err, "unable to fetch CustomResourceDefinition")
-		return ctrl.Result{}, client.IgnoreNotFound(err)
+		return ctrl.Result{}, err
 	}
+	if crd.DeletionTimestamp != nil {
+		r.registry.teardown(ctx, crd.Name)
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, r.registry.sync(r.ctx, ctx, r.mgr, r.mgr.GetRESTMapper(), &crd)
+}
+
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&apiextensionsv1.CustomResourceDefinition{}).
+		Complete(r)
+}
 
+// sync runs the setup of the CRD's GroupKind if it is not running, or restarts it if the served versions changed.
+// Setups registered via RegisterSetup or MultiRegisterSetup run only once.
+func (r *SetupRegistry) sync(setupCtx, ctx context.Context, mgr ctrl.Manager, mapper meta.RESTMapper, crd *apiextensionsv1.CustomResourceDefinition) error {
 	gk := schema.GroupKind{
 		Group: crd.Spec.Group,
 		Kind:  crd.Spec.Names.Kind,
 	}
-	mu.Lock()
-	defer mu.Unlock()
-	_, found := setupDone[gk]
-	if found {
-		return ctrl.Result{}, nil
+	versions := servedVersions(crd)
+
+	// setup and stop functions are called without holding r.mu, so that they can use the registry
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	r.mu.Lock()
+	if r.done[gk] {
+		r.mu.Unlock()
+		return nil
 	}
+	var stale *activeSetup
+	if a, found := r.active[gk]; found {
+		v, recorded := a.versions[gk]
+		if !recorded {
+			// another CRD of the group triggered the setup
+			a.crds[gk] = crd.Name
+			a.versions[gk] = versions
+			r.mu.Unlock()
+			return nil
+		}
+		if v == versions {
+			r.mu.Unlock()
+			return nil
+		}
+		log.FromContext(ctx).Info("served versions changed, restarting controllers", "groupKind", gk, "versions", versions)
+		r.deactivate(a)
+		stale = a
+	}
+	setup, setupFnExists := r.setupFns[gk]
+	testFn := r.testFns[gk]
+	r.mu.Unlock()
 
-	setup, setupFnExists := setupFns[gk]
+	if stale != nil && stale.stop != nil {
+		stale.stop()
+	}
 	if !setupFnExists {
-		return ctrl.Result{}, nil
+		return nil
 	}
-	if !testFns[gk](r.mgr.GetRESTMapper(), &crd) {
-		return ctrl.Result{}, nil
+	if !testFn(mapper, crd) {
+		return nil
 	}
 
-	ctxSetup := context.WithValue(r.ctx, CRDParam, &crd)
-	setup.fn(ctxSetup, r.mgr)
+	ctxSetup := context.WithValue(setupCtx, CRDParam, crd)
+	stop, err := setup.fn(ctxSetup, mgr)
+	if err != nil {
+		return err
+	}
 
-	for _, gk := range setup.gks {
-		setupDone[gk] = true
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if setup.once {
+		for _, g := range setup.gks {
+			r.done[g] = true
+		}
+		return nil
+	}
+	a := &activeSetup{
+		group:    setup,
+		crds:     map[schema.GroupKind]string{},
+		versions: map[schema.GroupKind]string{},
+		stop:     stop,
+	}
+	for _, g := range setup.gks {
+		r.active[g] = a
 	}
-	return ctrl.Result{}, nil
+	a.crds[gk] = crd.Name
+	a.versions[gk] = versions
+	return nil
 }
 
-func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&apiextensionsv1.CustomResourceDefinition{}).
-		Complete(r)
+// teardown stops the setup of the deleted CRD and of every GroupKind that was set up together with it.
+func (r *SetupRegistry) teardown(ctx context.Context, crdName string) {
+	r.syncMu.Lock()
+	defer r.syncMu.Unlock()
+
+	r.mu.Lock()
+	var stale *activeSetup
+	for gk, a := range r.active {
+		if a.crds[gk] == crdName {
+			log.FromContext(ctx).Info("CustomResourceDefinition removed, stopping controllers", "groupKind", gk)
+			r.deactivate(a)
+			stale = a
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	if stale != nil && stale.stop != nil {
+		stale.stop()
+	}
 }
 
-func RegisterSetup(gk schema.GroupKind, fn SetupFn, tn ...TestFn) {
-	mu.Lock()
-	defer mu.Unlock()
+// deactivate removes the setup from the active ones. r.mu must be held.
+func (r *SetupRegistry) deactivate(a *activeSetup) {
+	for _, g := range a.group.gks {
+		if r.active[g] == a {
+			delete(r.active, g)
+		}
+	}
+}
 
-	setupFns[gk] = setupGroup{
-		gks: []schema.GroupKind{gk},
-		fn:  fn,
+// Active returns true if the setup for the GroupKind is running.
+func (r *SetupRegistry) Active(gk schema.GroupKind) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, found := r.active[gk]
+	return found || r.done[gk]
+}
+
+// RegisterSetup registers a setup function that runs once the CRD of the GroupKind is available.
+// It is never run again, even if the CRD is removed and recreated, as controllers added to the
+// manager can't be stopped. Use RegisterDynamicSetup for setups that must be torn down.
+func (r *SetupRegistry) RegisterSetup(gk schema.GroupKind, fn SetupFn, tn ...TestFn) {
+	r.register([]schema.GroupKind{gk}, legacySetup(fn), true, andTestFn(tn...))
+}
+
+// MultiRegisterSetup registers a setup function that runs once the CRDs of all the GroupKinds are available.
+// Like RegisterSetup, it is never run again.
+func (r *SetupRegistry) MultiRegisterSetup(gks []schema.GroupKind, fn SetupFn, tn ...TestFn) {
+	r.register(gks, legacySetup(fn), true, andTestFn(append(tn, allCRDPresent(gks))...))
+}
+
+// RegisterDynamicSetup registers a setup function that runs once the CRD of the GroupKind is available.
+// The returned StopFn is called when the CRD is removed and before the setup is run again because
+// the served versions changed.
+func (r *SetupRegistry) RegisterDynamicSetup(gk schema.GroupKind, fn DynamicSetupFn, tn ...TestFn) {
+	r.register([]schema.GroupKind{gk}, fn, false, andTestFn(tn...))
+}
+
+// MultiRegisterDynamicSetup registers a setup function that runs once the CRDs of all the GroupKinds are
+// available. The setup is stopped when any of the CRDs is removed.
+func (r *SetupRegistry) MultiRegisterDynamicSetup(gks []schema.GroupKind, fn DynamicSetupFn, tn ...TestFn) {
+	r.register(gks, fn, false, andTestFn(append(tn, allCRDPresent(gks))...))
+}
+
+func (r *SetupRegistry) register(gks []schema.GroupKind, fn DynamicSetupFn, once bool, testFn TestFn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	setup := &setupGroup{
+		gks:  gks,
+		fn:   fn,
+		once: once,
+	}
+	for _, gk := range gks {
+		r.setupFns[gk] = setup
+		r.testFns[gk] = testFn
 	}
-	testFns[gk] = andTestFn(tn...)
+}
+
+func RegisterSetup(gk schema.GroupKind, fn SetupFn, tn ...TestFn) {
+	DefaultSetupRegistry.RegisterSetup(gk, fn, tn...)
 }
 
 func MultiRegisterSetup(gks []schema.GroupKind, fn SetupFn, tn ...TestFn) {
-	mu.Lock()
-	defer mu.Unlock()
+	DefaultSetupRegistry.MultiRegisterSetup(gks, fn, tn...)
+}
 
-	testFN := andTestFn(append(tn, allCRDPresent(gks))...)
-	for _, gk := range gks {
-		setupFns[gk] = setupGroup{
-			gks: gks,
-			fn:  fn,
+func RegisterDynamicSetup(gk schema.GroupKind, fn DynamicSetupFn, tn ...TestFn) {
+	DefaultSetupRegistry.RegisterDynamicSetup(gk, fn, tn...)
+}
+
+func MultiRegisterDynamicSetup(gks []schema.GroupKind, fn DynamicSetupFn, tn ...TestFn) {
+	DefaultSetupRegistry.MultiRegisterDynamicSetup(gks, fn, tn...)
+}
+
+func legacySetup(fn SetupFn) DynamicSetupFn {
+	return func(ctx context.Context, mgr ctrl.Manager) (StopFn, error) {
+		fn(ctx, mgr)
+		return nil, nil
+	}
+}
+
+// StartController creates a controller that is not managed by the manager and starts it. The returned StopFn
+// stops the controller and removes the informers of objs from the manager's cache. Use it from a DynamicSetupFn,
+// eg,
+//
+//	return apiextensions.StartController(ctx, mgr, "foo", controller.Options{Reconciler: r}, func(c controller.Controller) error {
+//		return c.Watch(source.Kind(mgr.GetCache(), &Foo{}, &handler.TypedEnqueueRequestForObject[*Foo]{}))
+//	}, &Foo{})
+func StartController(ctx context.Context, mgr ctrl.Manager, name string, opts controller.Options, watch func(controller.Controller) error, objs ...client.Object) (StopFn, error) {
+	if opts.SkipNameValidation == nil {
+		// the same name is used again when the controller is restarted
+		opts.SkipNameValidation = pointer.TrueP()
+	}
+	if opts.Logger.GetSink() == nil {
+		opts.Logger = mgr.GetLogger().WithValues("controller", name)
+	}
+	c, err := controller.NewUnmanaged(name, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := watch(c); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := c.Start(ctx); err != nil {
+			opts.Logger.Error(err, "controller stopped")
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+		for _, obj := range objs {
+			if err := mgr.GetCache().RemoveInformer(context.Background(), obj); err != nil {
+				opts.Logger.Error(err, "failed to remove informer")
+			}
+		}
+	}, nil
+}
+
+func servedVersions(crd *apiextensionsv1.CustomResourceDefinition) string {
+	var versions []string
+	for _, v := range crd.Spec.Versions {
+		if v.Served {
+			versions = append(versions, v.Name)
 		}
-		testFns[gk] = testFN
 	}
+	slices.Sort(versions)
+	return strings.Join(versions, ",")
 }
 
 func allCRDPresent(gks []schema.GroupKind) TestFn {
@@ -0,0 +1,163 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"context"
+	"testing"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+func setupTestCRD(kind, plural string, versions ...string) *apiextensionsv1.CustomResourceDefinition {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: plural + ".example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "example.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Kind: kind, Plural: plural},
+		},
+	}
+	for _, v := range versions {
+		crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: v, Served: true})
+	}
+	return crd
+}
+
+type setupCounter struct {
+	started, stopped int
+}
+
+func (s *setupCounter) setup(ctx context.Context, _ ctrl.Manager) (StopFn, error) {
+	s.started++
+	return func() { s.stopped++ }, nil
+}
+
+func alwaysTrue(meta.RESTMapper, *apiextensionsv1.CustomResourceDefinition) bool { return true }
+
+func TestSetupRegistryLifecycle(t *testing.T) {
+	ctx := context.TODO()
+	gk := schema.GroupKind{Group: "example.com", Kind: "Foo"}
+	r := NewSetupRegistry()
+	var counter setupCounter
+	r.RegisterDynamicSetup(gk, counter.setup, alwaysTrue)
+
+	crd := setupTestCRD("Foo", "foos", "v1alpha1")
+	steps := []struct {
+		name             string
+		do               func() error
+		started, stopped int
+		active           bool
+	}{
+		{"first", func() error { return r.sync(ctx, ctx, nil, nil, crd) }, 1, 0, true},
+		{"unchanged", func() error { return r.sync(ctx, ctx, nil, nil, crd) }, 1, 0, true},
+		{"version added", func() error { return r.sync(ctx, ctx, nil, nil, setupTestCRD("Foo", "foos", "v1alpha1", "v1")) }, 2, 1, true},
+		{"deleted", func() error { r.teardown(ctx, crd.Name); return nil }, 2, 2, false},
+		{"deleted again", func() error { r.teardown(ctx, crd.Name); return nil }, 2, 2, false},
+		{"recreated", func() error { return r.sync(ctx, ctx, nil, nil, crd) }, 3, 2, true},
+	}
+	for _, s := range steps {
+		if err := s.do(); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if counter.started != s.started || counter.stopped != s.stopped || r.Active(gk) != s.active {
+			t.Fatalf("%s: expected started=%d stopped=%d active=%v, got %+v active=%v",
+				s.name, s.started, s.stopped, s.active, counter, r.Active(gk))
+		}
+	}
+}
+
+func TestSetupRegistryMultiGroup(t *testing.T) {
+	ctx := context.TODO()
+	foo := schema.GroupKind{Group: "example.com", Kind: "Foo"}
+	bar := schema.GroupKind{Group: "example.com", Kind: "Bar"}
+	r := NewSetupRegistry()
+	var counter setupCounter
+	r.MultiRegisterDynamicSetup([]schema.GroupKind{foo, bar}, counter.setup)
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "example.com", Version: "v1"}})
+	fooCRD := setupTestCRD("Foo", "foos", "v1")
+	barCRD := setupTestCRD("Bar", "bars", "v1")
+	if err := r.sync(ctx, ctx, nil, mapper, fooCRD); err != nil {
+		t.Fatal(err)
+	}
+	if counter.started != 0 {
+		t.Fatalf("setup must wait for all the CRDs")
+	}
+
+	mapper.Add(foo.WithVersion("v1"), meta.RESTScopeNamespace)
+	mapper.Add(bar.WithVersion("v1"), meta.RESTScopeNamespace)
+	for _, crd := range []*apiextensionsv1.CustomResourceDefinition{fooCRD, barCRD} {
+		if err := r.sync(ctx, ctx, nil, mapper, crd); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if counter.started != 1 || !r.Active(foo) || !r.Active(bar) {
+		t.Fatalf("expected a single setup for the group, got %+v", counter)
+	}
+
+	r.teardown(ctx, barCRD.Name)
+	if counter.stopped != 1 || r.Active(foo) || r.Active(bar) {
+		t.Fatalf("expected the group to be stopped, got %+v", counter)
+	}
+}
+
+func TestSetupRegistryLegacySetupRunsOnce(t *testing.T) {
+	ctx := context.TODO()
+	gk := schema.GroupKind{Group: "example.com", Kind: "Foo"}
+	r := NewSetupRegistry()
+	calls := 0
+	r.RegisterSetup(gk, func(ctx context.Context, _ ctrl.Manager) { calls++ }, alwaysTrue)
+
+	crd := setupTestCRD("Foo", "foos", "v1alpha1")
+	for _, do := range []func() error{
+		func() error { return r.sync(ctx, ctx, nil, nil, crd) },
+		func() error { return r.sync(ctx, ctx, nil, nil, setupTestCRD("Foo", "foos", "v1alpha1", "v1")) },
+		func() error { r.teardown(ctx, crd.Name); return nil },
+		func() error { return r.sync(ctx, ctx, nil, nil, crd) },
+	} {
+		if err := do(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 || !r.Active(gk) {
+		t.Fatalf("expected the legacy setup to run once and stay active, got calls=%d active=%v", calls, r.Active(gk))
+	}
+}
+
+func TestSetupRegistryCallbacksDoNotHoldLock(t *testing.T) {
+	ctx := context.TODO()
+	gk := schema.GroupKind{Group: "example.com", Kind: "Foo"}
+	r := NewSetupRegistry()
+	var activeOnStop bool
+	r.RegisterDynamicSetup(gk, func(ctx context.Context, _ ctrl.Manager) (StopFn, error) {
+		r.Active(gk)
+		return func() { activeOnStop = r.Active(gk) }, nil
+	}, alwaysTrue)
+
+	crd := setupTestCRD("Foo", "foos", "v1")
+	if err := r.sync(ctx, ctx, nil, nil, crd); err != nil {
+		t.Fatal(err)
+	}
+	r.teardown(ctx, crd.Name)
+	if activeOnStop {
+		t.Error("expected the setup to be inactive while it is stopped")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversiontest
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	fuzz "github.com/google/gofuzz"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+const defaultFuzzIterations = 100
+
+type fuzzOptions struct {
+	iterations int
+	seed       int64
+	funcs      []any
+}
+
+// FuzzOption configures RoundTrip.
+type FuzzOption func(*fuzzOptions)
+
+// WithIterations sets the number of random objects tested per spoke. Defaults to 100.
+func WithIterations(n int) FuzzOption {
+	return func(o *fuzzOptions) {
+		o.iterations = n
+	}
+}
+
+// WithSeed sets the seed of the fuzzer, so that a failure can be reproduced.
+func WithSeed(seed int64) FuzzOption {
+	return func(o *fuzzOptions) {
+		o.seed = seed
+	}
+}
+
+// WithFuzzFuncs adds custom fuzz functions, eg, to generate valid values for fields that are
+// defaulted or normalized during conversion. See fuzz.Fuzzer.Funcs.
+func WithFuzzFuncs(funcs ...any) FuzzOption {
+	return func(o *fuzzOptions) {
+		o.funcs = append(o.funcs, funcs...)
+	}
+}
+
+// RoundTrip fills every spoke and the hub with random values and checks that
+// spoke -> hub -> spoke and hub -> spoke -> hub conversions are lossless.
+func RoundTrip(t testing.TB, hub conversion.Hub, spokes []conversion.Convertible, opts ...FuzzOption) {
+	t.Helper()
+
+	o := &fuzzOptions{iterations: defaultFuzzIterations, seed: rand.Int63()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	f := fuzz.NewWithSeed(o.seed).NilChance(0.2).NumElements(0, 3).Funcs(append([]any{
+		func(tm *metav1.TypeMeta, _ fuzz.Continue) {
+			// set by the webhook
+			*tm = metav1.TypeMeta{}
+		},
+		func(om *metav1.ObjectMeta, c fuzz.Continue) {
+			c.FuzzNoCustom(om)
+			// the apiserver stores timestamps in seconds
+			om.CreationTimestamp = metav1.Unix(c.Int63n(1<<32), 0)
+			om.DeletionTimestamp = nil
+			om.ManagedFields = nil
+		},
+		func(t *metav1.Time, c fuzz.Continue) {
+			*t = metav1.Unix(c.Int63n(1<<32), 0)
+		},
+	}, o.funcs...)...)
+
+	for _, spoke := range spokes {
+		name := reflect.TypeOf(spoke).Elem().Name()
+		for i := 0; i < o.iterations; i++ {
+			original := newOf(spoke).(conversion.Convertible)
+			f.Fuzz(original)
+			h := newOf(hub).(conversion.Hub)
+			if err := original.ConvertTo(h); err != nil {
+				t.Fatalf("seed %d: %s -> hub: %v", o.seed, name, err)
+			}
+			out := newOf(spoke).(conversion.Convertible)
+			if err := out.ConvertFrom(h); err != nil {
+				t.Fatalf("seed %d: hub -> %s: %v", o.seed, name, err)
+			}
+			if !apiequality.Semantic.DeepEqual(original, out) {
+				t.Fatalf("seed %d: %s -> hub -> %s is lossy (-original +converted):\n%s", o.seed, name, name, cmp.Diff(original, out))
+			}
+
+			originalHub := newOf(hub).(conversion.Hub)
+			f.Fuzz(originalHub)
+			s := newOf(spoke).(conversion.Convertible)
+			if err := s.ConvertFrom(originalHub); err != nil {
+				t.Fatalf("seed %d: hub -> %s: %v", o.seed, name, err)
+			}
+			outHub := newOf(hub).(conversion.Hub)
+			if err := s.ConvertTo(outHub); err != nil {
+				t.Fatalf("seed %d: %s -> hub: %v", o.seed, name, err)
+			}
+			if !apiequality.Semantic.DeepEqual(originalHub, outHub) {
+				t.Fatalf("seed %d: hub -> %s -> hub is lossy (-original +converted):\n%s", o.seed, name, cmp.Diff(originalHub, outHub))
+			}
+		}
+	}
+}
+
+func newOf(obj runtime.Object) runtime.Object {
+	return reflect.New(reflect.TypeOf(obj).Elem()).Interface().(runtime.Object)
+}
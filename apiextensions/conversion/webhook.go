@@ -0,0 +1,179 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversion
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// Webhook serves ConversionReview v1 requests for the types registered in a runtime.Scheme.
+// Types implementing conversion.Hub and conversion.Convertible are converted via the hub version.
+// Any other types are converted using the conversion funcs registered in the scheme.
+type Webhook struct {
+	scheme  *runtime.Scheme
+	decoder runtime.Decoder
+}
+
+var _ http.Handler = &Webhook{}
+
+// NewWebhook returns a conversion webhook for the types registered in the scheme.
+func NewWebhook(scheme *runtime.Scheme) *Webhook {
+	return &Webhook{
+		scheme:  scheme,
+		decoder: serializer.NewCodecFactory(scheme).UniversalDeserializer(),
+	}
+}
+
+func (wh *Webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var review apiextensionsv1.ConversionReview
+	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+		klog.Errorln("failed to decode ConversionReview:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if review.Request == nil {
+		http.Error(w, "ConversionReview has no request", http.StatusBadRequest)
+		return
+	}
+
+	out := &apiextensionsv1.ConversionReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+			Kind:       "ConversionReview",
+		},
+		Response: wh.Review(review.Request),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		klog.Errorln("failed to encode ConversionReview:", err)
+	}
+}
+
+// Review converts the objects of a ConversionRequest to the desired API version.
+func (wh *Webhook) Review(req *apiextensionsv1.ConversionRequest) *apiextensionsv1.ConversionResponse {
+	resp := &apiextensionsv1.ConversionResponse{UID: req.UID}
+
+	gv, err := schema.ParseGroupVersion(req.DesiredAPIVersion)
+	if err != nil {
+		resp.Result = failure(err)
+		return resp
+	}
+	resp.ConvertedObjects = make([]runtime.RawExtension, 0, len(req.Objects))
+	for _, raw := range req.Objects {
+		src, _, err := wh.decoder.Decode(raw.Raw, nil, nil)
+		if err != nil {
+			resp.ConvertedObjects = nil
+			resp.Result = failure(err)
+			return resp
+		}
+		dst, err := wh.Convert(src, gv)
+		if err != nil {
+			resp.ConvertedObjects = nil
+			resp.Result = failure(err)
+			return resp
+		}
+		resp.ConvertedObjects = append(resp.ConvertedObjects, runtime.RawExtension{Object: dst})
+	}
+	resp.Result = metav1.Status{Status: metav1.StatusSuccess}
+	return resp
+}
+
+// Convert converts an object to the same kind in the given API version.
+func (wh *Webhook) Convert(src runtime.Object, gv schema.GroupVersion) (runtime.Object, error) {
+	srcGVK := src.GetObjectKind().GroupVersionKind()
+	if srcGVK.Empty() {
+		gvks, _, err := wh.scheme.ObjectKinds(src)
+		if err != nil {
+			return nil, err
+		}
+		srcGVK = gvks[0]
+	}
+	if srcGVK.GroupVersion() == gv {
+		return src, nil
+	}
+	if srcGVK.Group != gv.Group {
+		return nil, fmt.Errorf("can't convert %s to a different group %s", srcGVK, gv.Group)
+	}
+
+	dstGVK := gv.WithKind(srcGVK.Kind)
+	dst, err := wh.scheme.New(dstGVK)
+	if err != nil {
+		return nil, err
+	}
+
+	srcHub, srcIsHub := src.(conversion.Hub)
+	dstHub, dstIsHub := dst.(conversion.Hub)
+	srcSpoke, srcIsSpoke := src.(conversion.Convertible)
+	dstSpoke, dstIsSpoke := dst.(conversion.Convertible)
+	switch {
+	case srcIsHub && dstIsSpoke:
+		err = dstSpoke.ConvertFrom(srcHub)
+	case srcIsSpoke && dstIsHub:
+		err = srcSpoke.ConvertTo(dstHub)
+	case srcIsSpoke && dstIsSpoke:
+		var hub conversion.Hub
+		if hub, err = wh.hubFor(srcGVK.GroupKind()); err == nil {
+			if err = srcSpoke.ConvertTo(hub); err == nil {
+				err = dstSpoke.ConvertFrom(hub)
+			}
+		}
+	default:
+		err = wh.scheme.Convert(src, dst, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to %s: %w", srcGVK, gv, err)
+	}
+	dst.GetObjectKind().SetGroupVersionKind(dstGVK)
+	return dst, nil
+}
+
+func (wh *Webhook) hubFor(gk schema.GroupKind) (conversion.Hub, error) {
+	var hub conversion.Hub
+	for _, gv := range wh.scheme.VersionsForGroupKind(gk) {
+		obj, err := wh.scheme.New(gv.WithKind(gk.Kind))
+		if err != nil {
+			continue
+		}
+		if h, ok := obj.(conversion.Hub); ok {
+			if hub != nil {
+				return nil, fmt.Errorf("multiple hub versions found for %s", gk)
+			}
+			hub = h
+		}
+	}
+	if hub == nil {
+		return nil, fmt.Errorf("no hub version found for %s", gk)
+	}
+	return hub, nil
+}
+
+func failure(err error) metav1.Status {
+	return metav1.Status{
+		Status:  metav1.StatusFailure,
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,211 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conversion
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kmodules.xyz/client-go/apiextensions/conversion/conversiontest"
+
+	fuzz "github.com/google/gofuzz"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// Foo v2 is the hub. v1 stores the name as a single string and v1beta1 splits it.
+
+type FooV2 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              FooV2Spec `json:"spec"`
+}
+
+type FooV2Spec struct {
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Replicas *int32 `json:"replicas,omitempty"`
+}
+
+func (*FooV2) Hub() {}
+
+func (in *FooV2) DeepCopyObject() runtime.Object {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	if in.Spec.Replicas != nil {
+		r := *in.Spec.Replicas
+		out.Spec.Replicas = &r
+	}
+	return &out
+}
+
+type FooV1 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              FooV1Spec `json:"spec"`
+}
+
+type FooV1Spec struct {
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Replicas int32  `json:"replicas"`
+}
+
+func (in *FooV1) DeepCopyObject() runtime.Object {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (in *FooV1) ConvertTo(h conversion.Hub) error {
+	dst := h.(*FooV2)
+	dst.ObjectMeta = in.ObjectMeta
+	dst.Spec = FooV2Spec{First: in.Spec.First, Last: in.Spec.Last}
+	if in.Spec.Replicas != 0 {
+		r := in.Spec.Replicas
+		dst.Spec.Replicas = &r
+	}
+	return nil
+}
+
+func (in *FooV1) ConvertFrom(h conversion.Hub) error {
+	src := h.(*FooV2)
+	in.ObjectMeta = src.ObjectMeta
+	in.Spec = FooV1Spec{First: src.Spec.First, Last: src.Spec.Last}
+	if src.Spec.Replicas != nil {
+		in.Spec.Replicas = *src.Spec.Replicas
+	}
+	return nil
+}
+
+type FooV1beta1 struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              FooV1beta1Spec `json:"spec"`
+}
+
+type FooV1beta1Spec struct {
+	Name string `json:"name"`
+}
+
+func (in *FooV1beta1) DeepCopyObject() runtime.Object {
+	out := *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	return &out
+}
+
+func (in *FooV1beta1) ConvertTo(h conversion.Hub) error {
+	dst := h.(*FooV2)
+	dst.ObjectMeta = in.ObjectMeta
+	first, last, _ := strings.Cut(in.Spec.Name, " ")
+	dst.Spec = FooV2Spec{First: first, Last: last}
+	return nil
+}
+
+func (in *FooV1beta1) ConvertFrom(h conversion.Hub) error {
+	src := h.(*FooV2)
+	in.ObjectMeta = src.ObjectMeta
+	in.Spec.Name = src.Spec.First + " " + src.Spec.Last
+	return nil
+}
+
+func testScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Group: "example.com", Version: "v1beta1", Kind: "Foo"}, &FooV1beta1{})
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Foo"}, &FooV1{})
+	scheme.AddKnownTypeWithName(schema.GroupVersionKind{Group: "example.com", Version: "v2", Kind: "Foo"}, &FooV2{})
+	return scheme
+}
+
+func TestWebhook(t *testing.T) {
+	srv := httptest.NewServer(NewWebhook(testScheme()))
+	defer srv.Close()
+
+	review := apiextensionsv1.ConversionReview{
+		Request: &apiextensionsv1.ConversionRequest{
+			UID:               types.UID("1234"),
+			DesiredAPIVersion: "example.com/v1",
+			Objects: []runtime.RawExtension{
+				{Raw: []byte(`{"apiVersion":"example.com/v1beta1","kind":"Foo","metadata":{"name":"a"},"spec":{"name":"John Doe"}}`)},
+				{Raw: []byte(`{"apiVersion":"example.com/v2","kind":"Foo","metadata":{"name":"b"},"spec":{"first":"Jane","last":"Roe","replicas":3}}`)},
+			},
+		},
+	}
+	data, err := json.Marshal(review)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(srv.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+
+	var out struct {
+		Response struct {
+			UID              types.UID     `json:"uid"`
+			Result           metav1.Status `json:"result"`
+			ConvertedObjects []FooV1       `json:"convertedObjects"`
+		} `json:"response"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Response.UID != "1234" || out.Response.Result.Status != metav1.StatusSuccess {
+		t.Fatalf("unexpected response: %+v", out.Response)
+	}
+	want := []FooV1Spec{{First: "John", Last: "Doe"}, {First: "Jane", Last: "Roe", Replicas: 3}}
+	for i, obj := range out.Response.ConvertedObjects {
+		if obj.APIVersion != "example.com/v1" || obj.Kind != "Foo" {
+			t.Errorf("object %d has unexpected type %s", i, obj.GroupVersionKind())
+		}
+		if obj.Spec != want[i] {
+			t.Errorf("object %d: expected %+v, got %+v", i, want[i], obj.Spec)
+		}
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	resp := NewWebhook(testScheme()).Review(&apiextensionsv1.ConversionRequest{
+		UID:               types.UID("1234"),
+		DesiredAPIVersion: "example.com/v3",
+		Objects:           []runtime.RawExtension{{Raw: []byte(`{"apiVersion":"example.com/v1","kind":"Foo","metadata":{"name":"a"}}`)}},
+	})
+	if resp.Result.Status != metav1.StatusFailure || resp.ConvertedObjects != nil {
+		t.Errorf("expected a failure, got %+v", resp)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	conversiontest.RoundTrip(t, &FooV2{}, []conversion.Convertible{&FooV1{}}, conversiontest.WithSeed(1), conversiontest.WithFuzzFuncs(
+		func(s *FooV2Spec, c fuzz.Continue) {
+			c.FuzzNoCustom(s)
+			// v1 can't distinguish an unset replicas from 0
+			if s.Replicas != nil && *s.Replicas == 0 {
+				s.Replicas = nil
+			}
+		},
+	))
+}
@@ -37,7 +37,18 @@ func RegisterCRDs(client crd_cs.Interface, crds []*CustomResourceDefinition) err
 	return RegisterWithOpts(client, crds, false)
 }
 
+// RegisterWithOpts creates or updates the CRDs without checking for breaking changes.
+// Use RegisterWithPolicy to check them.
 func RegisterWithOpts(client crd_cs.Interface, crds []*CustomResourceDefinition, preserveConversion bool) error {
+	return RegisterWithPolicy(client, crds, preserveConversion, UpgradePolicyForce)
+}
+
+// RegisterWithPolicy creates or updates the CRDs. Existing CRDs are first compared with the new
+// definitions and the policy decides whether an upgrade with breaking changes is applied.
+func RegisterWithPolicy(client crd_cs.Interface, crds []*CustomResourceDefinition, preserveConversion bool, policy UpgradePolicy) error {
+	if err := checkUpgradePolicy(client, crds, preserveConversion, policy); err != nil {
+		return err
+	}
 	for _, crd := range crds {
 		// Use crd v1 for k8s >= 1.16, if available
 		// ref: https://github.com/kubernetes/kubernetes/issues/91395
@@ -63,7 +74,18 @@ func RegisterWithOpts(client crd_cs.Interface, crds []*CustomResourceDefinition,
 	return WaitForCRDReady(client, crds)
 }
 
+// UpdateWithOpts updates the CRDs that already exist without checking for breaking changes.
+// Use UpdateWithPolicy to check them.
 func UpdateWithOpts(client crd_cs.Interface, crds []*CustomResourceDefinition, preserveConversion bool) error {
+	return UpdateWithPolicy(client, crds, preserveConversion, UpgradePolicyForce)
+}
+
+// UpdateWithPolicy updates the CRDs that already exist. The policy decides whether an upgrade
+// with breaking changes is applied.
+func UpdateWithPolicy(client crd_cs.Interface, crds []*CustomResourceDefinition, preserveConversion bool, policy UpgradePolicy) error {
+	if err := checkUpgradePolicy(client, crds, preserveConversion, policy); err != nil {
+		return err
+	}
 	for _, crd := range crds {
 		// Use crd v1 for k8s >= 1.16, if available
 		// ref: https://github.com/kubernetes/kubernetes/issues/91395
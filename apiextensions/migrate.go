@@ -0,0 +1,215 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	kutil "kmodules.xyz/client-go"
+	v1 "kmodules.xyz/client-go/apiextensions/v1"
+
+	"github.com/pkg/errors"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog/v2"
+)
+
+// DefaultMigrationPageSize is the number of objects listed per request during a storage version migration.
+const DefaultMigrationPageSize = 500
+
+// MigrationProgress reports the state of a storage version migration.
+type MigrationProgress struct {
+	CRD            string
+	StorageVersion string
+	// Migrated is the number of objects rewritten at the storage version.
+	Migrated int
+	// Skipped is the number of objects deleted while the migration was running.
+	Skipped int
+	// Failed is the number of objects that could not be rewritten.
+	Failed int
+	// Remaining is the estimated number of objects not listed yet, or nil if unknown.
+	Remaining *int64
+	// PrunedStoredVersions is true once status.storedVersions only contains the storage version.
+	PrunedStoredVersions bool
+}
+
+type migrationOptions struct {
+	pageSize   int64
+	progress   func(MigrationProgress)
+	skipPrune  bool
+	updateOpts metav1.UpdateOptions
+}
+
+// MigrationOption configures MigrateStorageVersion.
+type MigrationOption func(*migrationOptions)
+
+// WithPageSize sets the number of objects listed per request. Defaults to DefaultMigrationPageSize.
+func WithPageSize(n int64) MigrationOption {
+	return func(o *migrationOptions) {
+		o.pageSize = n
+	}
+}
+
+// WithProgress sets a function called after every page of objects is migrated and once the migration completes.
+func WithProgress(fn func(MigrationProgress)) MigrationOption {
+	return func(o *migrationOptions) {
+		o.progress = fn
+	}
+}
+
+// WithoutPruning keeps status.storedVersions unchanged after all the objects are migrated.
+func WithoutPruning() MigrationOption {
+	return func(o *migrationOptions) {
+		o.skipPrune = true
+	}
+}
+
+// WithFieldManager sets the field manager used for the no-op updates.
+func WithFieldManager(manager string) MigrationOption {
+	return func(o *migrationOptions) {
+		o.updateOpts.FieldManager = manager
+	}
+}
+
+// MigrateStorageVersion rewrites every object of the named CRD so that it is encoded at the current storage
+// version. Objects are listed page by page and updated without changes, retrying on conflicts. Once every
+// object is migrated, status.storedVersions of the CRD is pruned to the storage version.
+func MigrateStorageVersion(ctx context.Context, crdClient crd_cs.Interface, dc dynamic.Interface, name string, opts ...MigrationOption) (*MigrationProgress, error) {
+	o := &migrationOptions{pageSize: DefaultMigrationPageSize}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	crd, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	storage := storageVersion(crd)
+	if storage == "" {
+		return nil, fmt.Errorf("CustomResourceDefinition %s has no storage version", name)
+	}
+	gvr := schema.GroupVersionResource{
+		Group:    crd.Spec.Group,
+		Version:  storage,
+		Resource: crd.Spec.Names.Plural,
+	}
+	progress := &MigrationProgress{CRD: name, StorageVersion: storage}
+	report := func() {
+		if o.progress != nil {
+			o.progress(*progress)
+		}
+	}
+
+	ri := dc.Resource(gvr)
+	listOpts := metav1.ListOptions{Limit: o.pageSize}
+	for {
+		list, err := ri.List(ctx, listOpts)
+		if kerr.IsResourceExpired(err) && listOpts.Continue != "" {
+			// objects rewritten already are updated again, which is harmless
+			klog.Warningf("list of %s expired, restarting storage version migration", gvr.GroupResource())
+			listOpts.Continue = ""
+			continue
+		} else if err != nil {
+			return progress, err
+		}
+
+		for i := range list.Items {
+			if err := migrateObject(ctx, ri, &list.Items[i], o.updateOpts); kerr.IsNotFound(err) {
+				progress.Skipped++
+			} else if err != nil {
+				progress.Failed++
+				klog.Errorf("failed to migrate %s %s/%s: %v", gvr.GroupResource(), list.Items[i].GetNamespace(), list.Items[i].GetName(), err)
+			} else {
+				progress.Migrated++
+			}
+		}
+		progress.Remaining = list.GetRemainingItemCount()
+		report()
+
+		listOpts.Continue = list.GetContinue()
+		if listOpts.Continue == "" {
+			break
+		}
+	}
+
+	if progress.Failed > 0 {
+		return progress, fmt.Errorf("failed to migrate %d %s to storage version %s", progress.Failed, gvr.GroupResource(), storage)
+	}
+	if o.skipPrune {
+		return progress, nil
+	}
+	if err := pruneStoredVersions(ctx, crdClient, name, storage); err != nil {
+		return progress, err
+	}
+	progress.PrunedStoredVersions = true
+	report()
+	return progress, nil
+}
+
+func migrateObject(ctx context.Context, ri dynamic.NamespaceableResourceInterface, obj *unstructured.Unstructured, opts metav1.UpdateOptions) error {
+	c := ri.Namespace(obj.GetNamespace())
+	cur := obj
+	attempt := 0
+	var lastErr error
+	err := wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, v1.RetryTimeout, true, func(ctx context.Context) (bool, error) {
+		attempt++
+		if cur == nil {
+			var e2 error
+			if cur, e2 = c.Get(ctx, obj.GetName(), metav1.GetOptions{}); e2 != nil {
+				return false, e2
+			}
+		}
+		_, lastErr = c.Update(ctx, cur, opts)
+		if kerr.IsConflict(lastErr) {
+			cur = nil
+			return false, nil
+		}
+		return true, lastErr
+	})
+	if wait.Interrupted(err) && lastErr != nil {
+		err = errors.Errorf("failed to update %s/%s after %d attempts due to %v", obj.GetNamespace(), obj.GetName(), attempt, lastErr)
+	}
+	return err
+}
+
+func pruneStoredVersions(ctx context.Context, c crd_cs.Interface, name, storage string) error {
+	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, v1.RetryTimeout, true, func(ctx context.Context) (bool, error) {
+		cur, err := c.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if storageVersion(cur) != storage {
+			return false, fmt.Errorf("storage version of CustomResourceDefinition %s changed to %s during migration", name, storageVersion(cur))
+		}
+		if slices.Equal(cur.Status.StoredVersions, []string{storage}) {
+			return true, nil
+		}
+		cur.Status.StoredVersions = []string{storage}
+		_, err = c.ApiextensionsV1().CustomResourceDefinitions().UpdateStatus(ctx, cur, metav1.UpdateOptions{})
+		if kerr.IsConflict(err) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+}
@@ -0,0 +1,82 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiextensions
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func TestMigrateStorageVersion(t *testing.T) {
+	spec := crdv1.JSONSchemaProps{Type: "object"}
+	crd := testCRD(testVersion("v1alpha1", true, false, spec), testVersion("v1", true, true, spec))
+	crd.Status.StoredVersions = []string{"v1alpha1", "v1"}
+	crdClient := fake.NewSimpleClientset(crd)
+
+	var objs []runtime.Object
+	for _, name := range []string{"a", "b", "c"} {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion("example.com/v1")
+		u.SetKind("Foo")
+		u.SetNamespace("default")
+		u.SetName(name)
+		objs = append(objs, u)
+	}
+	gvr := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "foos"}
+	dc := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{gvr: "FooList"}, objs...)
+
+	var reports []MigrationProgress
+	progress, err := MigrateStorageVersion(context.TODO(), crdClient, dc, crd.Name, WithProgress(func(p MigrationProgress) {
+		reports = append(reports, p)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if progress.Migrated != 3 || progress.Failed != 0 || !progress.PrunedStoredVersions {
+		t.Errorf("unexpected progress: %+v", progress)
+	}
+	if len(reports) == 0 || !reports[len(reports)-1].PrunedStoredVersions {
+		t.Errorf("expected a final progress report, got %+v", reports)
+	}
+
+	updated := 0
+	for _, a := range dc.Actions() {
+		if a.GetVerb() == "update" {
+			updated++
+		}
+	}
+	if updated != 3 {
+		t.Errorf("expected 3 updates, got %d", updated)
+	}
+
+	cur, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(context.TODO(), crd.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cur.Status.StoredVersions, []string{"v1"}) {
+		t.Errorf("expected storedVersions [v1], got %v", cur.Status.StoredVersions)
+	}
+}
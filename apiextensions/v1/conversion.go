@@ -0,0 +1,147 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	api "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/klog/v2"
+	kutil "kmodules.xyz/client-go"
+)
+
+// UpdateConversionWebhookCABundle waits for the CustomResourceDefinition to exist and sets the caBundle
+// of its conversion webhook to the CA data of the rest config.
+func UpdateConversionWebhookCABundle(config *rest.Config, crdName string, extraConditions ...watchtools.ConditionFunc) error {
+	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(ctx, kutil.ReadinessTimeout)
+	defer cancel()
+
+	err := rest.LoadTLSFiles(config)
+	if err != nil {
+		return err
+	}
+
+	c := cs.NewForConfigOrDie(config)
+	conditions := append([]watchtools.ConditionFunc{
+		func(event watch.Event) (bool, error) {
+			switch event.Type {
+			case watch.Deleted:
+				return false, nil
+			case watch.Error:
+				return false, errors.New("error watching")
+			case watch.Added, watch.Modified:
+				err := patchConversionCABundle(ctx, c, event.Object.(*api.CustomResourceDefinition), config.CAData)
+				if err != nil {
+					klog.Warning(err)
+				}
+				return err == nil, err
+			default:
+				return false, fmt.Errorf("unexpected event type: %v", event.Type)
+			}
+		},
+	}, extraConditions...)
+
+	_, err = watchtools.UntilWithSync(ctx,
+		crdListWatch(ctx, c, crdName),
+		&api.CustomResourceDefinition{},
+		nil,
+		conditions...,
+	)
+	return err
+}
+
+// SyncConversionWebhookCABundle keeps the caBundle of the conversion webhook of the CustomResourceDefinition
+// in sync with the CA data of the rest config until cancel is called.
+func SyncConversionWebhookCABundle(config *rest.Config, crdName string) (cancel context.CancelFunc, err error) {
+	ctx := context.Background()
+	ctx, cancel = context.WithCancel(ctx)
+
+	err = rest.LoadTLSFiles(config)
+	if err != nil {
+		return
+	}
+
+	c := cs.NewForConfigOrDie(config)
+	go func() {
+		_, err := watchtools.UntilWithSync(
+			ctx,
+			crdListWatch(ctx, c, crdName),
+			&api.CustomResourceDefinition{},
+			nil,
+			func(event watch.Event) (bool, error) {
+				switch event.Type {
+				case watch.Deleted:
+					return false, nil
+				case watch.Error:
+					return false, errors.New("error watching")
+				case watch.Added, watch.Modified:
+					err := patchConversionCABundle(ctx, c, event.Object.(*api.CustomResourceDefinition), config.CAData)
+					if err != nil {
+						klog.Warning(err)
+					}
+					return false, nil // continue
+				default:
+					return false, fmt.Errorf("unexpected event type: %v", event.Type)
+				}
+			})
+		utilruntime.Must(err)
+	}()
+	return
+}
+
+func crdListWatch(ctx context.Context, c cs.Interface, crdName string) *cache.ListWatch {
+	return &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fields.OneTermEqualSelector(kutil.ObjectNameField, crdName).String()
+			return c.ApiextensionsV1().CustomResourceDefinitions().List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fields.OneTermEqualSelector(kutil.ObjectNameField, crdName).String()
+			return c.ApiextensionsV1().CustomResourceDefinitions().Watch(ctx, options)
+		},
+	}
+}
+
+func patchConversionCABundle(ctx context.Context, c cs.Interface, cur *api.CustomResourceDefinition, caBundle []byte) error {
+	conv := cur.Spec.Conversion
+	if conv == nil || conv.Strategy != api.WebhookConverter || conv.Webhook == nil || conv.Webhook.ClientConfig == nil {
+		return fmt.Errorf("CustomResourceDefinition %s does not use a conversion webhook", cur.Name)
+	}
+	if bytes.Equal(conv.Webhook.ClientConfig.CABundle, caBundle) {
+		return nil
+	}
+	_, err := TryUpdateCustomResourceDefinition(ctx, c, cur.Name, func(in *api.CustomResourceDefinition) *api.CustomResourceDefinition {
+		if in.Spec.Conversion != nil && in.Spec.Conversion.Webhook != nil && in.Spec.Conversion.Webhook.ClientConfig != nil {
+			in.Spec.Conversion.Webhook.ClientConfig.CABundle = caBundle
+		}
+		return in
+	}, metav1.UpdateOptions{})
+	return err
+}
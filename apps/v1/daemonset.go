@@ -29,6 +29,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/readiness"
 )
 
 func CreateOrPatchDaemonSet(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*apps.DaemonSet) *apps.DaemonSet, opts metav1.PatchOptions) (*apps.DaemonSet, kutil.VerbType, error) {
@@ -99,16 +100,9 @@ func TryUpdateDaemonSet(ctx context.Context, c kubernetes.Interface, meta metav1
 	return
 }
 
-func WaitUntilDaemonSetReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
-	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, kutil.ReadinessTimeout, true, func(ctx context.Context) (bool, error) {
-		// It takes some time to populate .status field of the DaemonSet after it is being created.
-		// If this function is called just after creating a DaemonSet, the Get methond returns an obj with .status field is defaulted to their default values.
-		// At this time, "obj.Status.DesiredNumberScheduled" and "obj.Status.NumberReady" both are defaulted to 0 and "obj.Status.DesiredNumberScheduled == obj.Status.NumberReady"
-		// returns "true" which is not expected behavior. Hence, we have to ensure that "obj.Status.DesiredNumberScheduled" has been populated with actual value.
-		// Warning: If the DaemonSet has any affinity that results no schedulable pod, this function will stuck until timeout.
-		if obj, err := c.AppsV1().DaemonSets(meta.Namespace).Get(ctx, meta.Name, metav1.GetOptions{}); err == nil && obj.Status.DesiredNumberScheduled != 0 {
-			return obj.Status.DesiredNumberScheduled == obj.Status.NumberReady, nil
-		}
-		return false, nil
-	})
+// WaitUntilDaemonSetReady waits until the latest generation of the DaemonSet is ready on every scheduled node.
+// Warning: If the DaemonSet has any affinity that results no schedulable pod, this function will wait until timeout.
+func WaitUntilDaemonSetReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, opts ...readiness.Option) error {
+	_, err := readiness.Wait(ctx, c.AppsV1().DaemonSets(meta.Namespace), meta.Name, readiness.DaemonSetReady, opts...)
+	return err
 }
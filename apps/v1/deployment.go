@@ -33,6 +33,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/readiness"
 )
 
 func CreateOrPatchDeployment(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*apps.Deployment) *apps.Deployment, opts metav1.PatchOptions) (*apps.Deployment, kutil.VerbType, error) {
@@ -120,13 +121,11 @@ func DeploymentsAreReady(items []*apps.Deployment) (bool, string) {
 	return true, "All desired replicas are ready."
 }
 
-func WaitUntilDeploymentReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
-	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, kutil.ReadinessTimeout, true, func(ctx context.Context) (bool, error) {
-		if obj, err := c.AppsV1().Deployments(meta.Namespace).Get(ctx, meta.Name, metav1.GetOptions{}); err == nil {
-			return IsDeploymentReady(obj), nil
-		}
-		return false, nil
-	})
+// WaitUntilDeploymentReady waits until the latest generation of the Deployment is rolled out. It returns an error
+// explaining the last observed state if the rollout is stuck or does not finish within kutil.ReadinessTimeout.
+func WaitUntilDeploymentReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, opts ...readiness.Option) error {
+	_, err := readiness.Wait(ctx, c.AppsV1().Deployments(meta.Namespace), meta.Name, readiness.DeploymentReady, opts...)
+	return err
 }
 
 func DeleteDeployment(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
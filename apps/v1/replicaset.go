@@ -20,7 +20,6 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
-	"gomodules.xyz/pointer"
 	apps "k8s.io/api/apps/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,6 +29,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/readiness"
 )
 
 func CreateOrPatchReplicaSet(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*apps.ReplicaSet) *apps.ReplicaSet, opts metav1.PatchOptions) (*apps.ReplicaSet, kutil.VerbType, error) {
@@ -100,13 +100,11 @@ func TryUpdateReplicaSet(ctx context.Context, c kubernetes.Interface, meta metav
 	return
 }
 
-func WaitUntilReplicaSetReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
-	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, kutil.ReadinessTimeout, true, func(ctx context.Context) (bool, error) {
-		if obj, err := c.AppsV1().ReplicaSets(meta.Namespace).Get(ctx, meta.Name, metav1.GetOptions{}); err == nil {
-			return pointer.Int32(obj.Spec.Replicas) == obj.Status.ReadyReplicas, nil
-		}
-		return false, nil
-	})
+// WaitUntilReplicaSetReady waits until all replicas of the latest generation of the ReplicaSet are ready. It
+// returns an error explaining the last observed state if they are not ready within kutil.ReadinessTimeout.
+func WaitUntilReplicaSetReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, opts ...readiness.Option) error {
+	_, err := readiness.Wait(ctx, c.AppsV1().ReplicaSets(meta.Namespace), meta.Name, readiness.ReplicaSetReady, opts...)
+	return err
 }
 
 func IsOwnedByDeployment(refs []metav1.OwnerReference) bool {
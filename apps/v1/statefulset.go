@@ -33,6 +33,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/readiness"
 )
 
 func CreateOrPatchStatefulSet(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*apps.StatefulSet) *apps.StatefulSet, opts metav1.PatchOptions) (*apps.StatefulSet, kutil.VerbType, error) {
@@ -120,13 +121,11 @@ func StatefulSetsAreReady(items []*apps.StatefulSet) (bool, string) {
 	return true, "All desired replicas are ready."
 }
 
-func WaitUntilStatefulSetReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
-	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, kutil.ReadinessTimeout, true, func(ctx context.Context) (bool, error) {
-		if obj, err := c.AppsV1().StatefulSets(meta.Namespace).Get(ctx, meta.Name, metav1.GetOptions{}); err == nil {
-			return IsStatefulSetReady(obj), nil
-		}
-		return false, nil
-	})
+// WaitUntilStatefulSetReady waits until the latest generation of the StatefulSet is rolled out. It returns an error
+// explaining the last observed state if the rollout does not finish within kutil.ReadinessTimeout.
+func WaitUntilStatefulSetReady(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, opts ...readiness.Option) error {
+	_, err := readiness.Wait(ctx, c.AppsV1().StatefulSets(meta.Namespace), meta.Name, readiness.StatefulSetReady, opts...)
+	return err
 }
 
 func DeleteStatefulSet(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
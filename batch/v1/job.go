@@ -20,7 +20,6 @@ import (
 	"context"
 
 	"github.com/pkg/errors"
-	"gomodules.xyz/pointer"
 	batch "k8s.io/api/batch/v1"
 	kerr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -30,6 +29,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/readiness"
 )
 
 func CreateOrPatchJob(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*batch.Job) *batch.Job, opts metav1.PatchOptions) (*batch.Job, kutil.VerbType, error) {
@@ -100,19 +100,11 @@ func TryUpdateJob(ctx context.Context, c kubernetes.Interface, meta metav1.Objec
 	return
 }
 
-func WaitUntilJobCompletion(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
-	return wait.PollUntilContextCancel(ctx, kutil.RetryInterval, true, func(ctx context.Context) (bool, error) {
-		job, err := c.BatchV1().Jobs(meta.Namespace).Get(ctx, meta.Name, metav1.GetOptions{})
-		if err != nil {
-			if kerr.IsNotFound(err) {
-				return true, nil
-			}
-			return false, nil
-		}
-
-		if job.Status.Succeeded > 0 || job.Status.Failed > pointer.Int32(job.Spec.BackoffLimit) {
-			return true, nil
-		}
-		return false, nil
-	})
+// WaitUntilJobCompletion waits until the Job completes, fails or is deleted. A failed Job is not an error; use
+// readiness.Wait with readiness.JobComplete to fail on it. There is no timeout by default, use
+// readiness.WithTimeout to set one.
+func WaitUntilJobCompletion(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, opts ...readiness.Option) error {
+	opts = append([]readiness.Option{readiness.WithTimeout(0), readiness.ReadyIfNotFound()}, opts...)
+	_, err := readiness.Wait(ctx, c.BatchV1().Jobs(meta.Namespace), meta.Name, readiness.JobFinished, opts...)
+	return err
 }
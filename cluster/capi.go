@@ -0,0 +1,183 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	capiGroup = "cluster.x-k8s.io"
+
+	// CAPIKubeconfigSecretKey is the key of the kubeconfig in the <cluster>-kubeconfig Secret created by CAPI.
+	CAPIKubeconfigSecretKey = "value"
+)
+
+// CAPIVersions are the api versions of cluster.x-k8s.io Clusters supported, in order of preference.
+var CAPIVersions = []string{"v1beta2", "v1beta1"}
+
+// CAPICluster describes a cluster.x-k8s.io Cluster object.
+type CAPICluster struct {
+	kmapi.CAPIClusterInfo
+	// APIVersion is the version of the Cluster api served by the management cluster.
+	APIVersion string
+	Phase      string
+	// ControlPlaneEndpoint is the host:port of the api server of the workload cluster.
+	ControlPlaneEndpoint string
+	InfrastructureKind   string
+	ControlPlaneKind     string
+	// KubeconfigSecret refers to the Secret holding the admin kubeconfig of the workload cluster.
+	KubeconfigSecret types.NamespacedName
+}
+
+// ListCAPIClusters lists the cluster.x-k8s.io Clusters using the first of CAPIVersions served by the
+// api server. It returns nil if CAPI is not installed.
+func ListCAPIClusters(ctx context.Context, kc client.Reader, opts ...client.ListOption) ([]CAPICluster, error) {
+	list, version, err := listCAPIClusters(ctx, kc, opts...)
+	if err != nil || list == nil {
+		return nil, err
+	}
+
+	out := make([]CAPICluster, 0, len(list.Items))
+	for _, item := range list.Items {
+		c, err := capiClusterFrom(item.UnstructuredContent())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse Cluster %s/%s", item.GetNamespace(), item.GetName())
+		}
+		c.APIVersion = version
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+func listCAPIClusters(ctx context.Context, kc client.Reader, opts ...client.ListOption) (*unstructured.UnstructuredList, string, error) {
+	versions := CAPIVersions
+	if mc, ok := kc.(interface{ RESTMapper() meta.RESTMapper }); ok {
+		versions = servedCAPIVersions(mc.RESTMapper())
+	}
+
+	var result *unstructured.UnstructuredList
+	var resultVersion string
+	for _, version := range versions {
+		var list unstructured.UnstructuredList
+		list.SetGroupVersionKind(schema.GroupVersionKind{
+			Group:   capiGroup,
+			Version: version,
+			Kind:    "Cluster",
+		})
+		err := kc.List(ctx, &list, opts...)
+		if meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			return nil, "", err
+		}
+		if result == nil {
+			result, resultVersion = &list, version
+		}
+		if len(list.Items) > 0 {
+			return &list, version, nil
+		}
+	}
+	return result, resultVersion, nil
+}
+
+// servedCAPIVersions returns the CAPIVersions served by the api server, in order of preference.
+func servedCAPIVersions(mapper meta.RESTMapper) []string {
+	mappings, err := mapper.RESTMappings(schema.GroupKind{Group: capiGroup, Kind: "Cluster"})
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, version := range CAPIVersions {
+		for _, m := range mappings {
+			if m.GroupVersionKind.Version == version {
+				out = append(out, version)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func capiClusterFrom(obj map[string]any) (CAPICluster, error) {
+	var c CAPICluster
+	c.ClusterName, _, _ = unstructured.NestedString(obj, "metadata", "name")
+	c.Namespace, _, _ = unstructured.NestedString(obj, "metadata", "namespace")
+
+	var err error
+	if c.InfrastructureKind, _, err = unstructured.NestedString(obj, "spec", "infrastructureRef", "kind"); err != nil {
+		return c, err
+	}
+	if c.ControlPlaneKind, _, err = unstructured.NestedString(obj, "spec", "controlPlaneRef", "kind"); err != nil {
+		return c, err
+	}
+	if c.Phase, _, err = unstructured.NestedString(obj, "status", "phase"); err != nil {
+		return c, err
+	}
+	c.Provider = getProviderName(c.InfrastructureKind)
+	if c.Provider == "" {
+		c.Provider = getProviderName(c.ControlPlaneKind)
+	}
+
+	host, _, err := unstructured.NestedString(obj, "spec", "controlPlaneEndpoint", "host")
+	if err != nil {
+		return c, err
+	}
+	port, _, err := unstructured.NestedInt64(obj, "spec", "controlPlaneEndpoint", "port")
+	if err != nil {
+		return c, err
+	}
+	if host != "" {
+		c.ControlPlaneEndpoint = host
+		if port > 0 {
+			c.ControlPlaneEndpoint = host + ":" + strconv.FormatInt(port, 10)
+		}
+	}
+
+	c.KubeconfigSecret = types.NamespacedName{
+		Namespace: c.Namespace,
+		Name:      fmt.Sprintf("%s-kubeconfig", c.ClusterName),
+	}
+	return c, nil
+}
+
+// CAPIClusterConfig returns the rest.Config of a workload cluster, read from the kubeconfig Secret created by CAPI.
+func CAPIClusterConfig(ctx context.Context, kc client.Reader, c CAPICluster) (*rest.Config, error) {
+	var secret core.Secret
+	if err := kc.Get(ctx, c.KubeconfigSecret, &secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to get kubeconfig of Cluster %s/%s", c.Namespace, c.ClusterName)
+	}
+	data, ok := secret.Data[CAPIKubeconfigSecretKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", c.KubeconfigSecret, CAPIKubeconfigSecretKey)
+	}
+	return clientcmd.RESTConfigFromKubeConfig(data)
+}
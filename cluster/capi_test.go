@@ -0,0 +1,123 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const workloadKubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: prod
+  context: {cluster: prod, user: admin}
+current-context: prod
+`
+
+func newCAPICluster(name, infraKind string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{Object: map[string]any{
+		"spec": map[string]any{
+			"controlPlaneEndpoint": map[string]any{"host": name + ".example.com", "port": int64(6443)},
+			"infrastructureRef":    map[string]any{"kind": infraKind, "name": name},
+			"controlPlaneRef":      map[string]any{"kind": "KubeadmControlPlane", "name": name},
+		},
+		"status": map[string]any{"phase": "Provisioned"},
+	}}
+	obj.SetAPIVersion("cluster.x-k8s.io/v1beta1")
+	obj.SetKind("Cluster")
+	obj.SetNamespace("fleet")
+	obj.SetName(name)
+	return obj
+}
+
+func TestListCAPIClusters(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Group: "cluster.x-k8s.io", Version: "v1beta1"}})
+	mapper.Add(schema.GroupVersionKind{Group: "cluster.x-k8s.io", Version: "v1beta1", Kind: "Cluster"}, meta.RESTScopeNamespace)
+	mapper.Add(core.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+
+	kc := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithRESTMapper(mapper).
+		WithObjects(
+			newCAPICluster("prod", "HetznerCluster"),
+			newCAPICluster("stage", "DockerCluster"),
+			&core.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "prod-kubeconfig", Namespace: "fleet"},
+				Data:       map[string][]byte{CAPIKubeconfigSecretKey: []byte(workloadKubeconfig)},
+			},
+		).Build()
+
+	clusters, err := ListCAPIClusters(context.TODO(), kc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, found %d", len(clusters))
+	}
+	prod := clusters[0]
+	if prod.ClusterName != "prod" || prod.Provider != kmapi.CAPIProviderCAPH || prod.APIVersion != "v1beta1" ||
+		prod.Phase != "Provisioned" || prod.ControlPlaneEndpoint != "prod.example.com:6443" ||
+		prod.KubeconfigSecret.Name != "prod-kubeconfig" {
+		t.Errorf("unexpected cluster %+v", prod)
+	}
+	if clusters[1].Provider != "" || clusters[1].InfrastructureKind != "DockerCluster" {
+		t.Errorf("unexpected cluster %+v", clusters[1])
+	}
+
+	cfg, err := CAPIClusterConfig(context.TODO(), kc, prod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "https://prod.example.com:6443" || cfg.BearerToken != "secret" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if _, err := CAPIClusterConfig(context.TODO(), kc, clusters[1]); err == nil {
+		t.Error("expected an error for a missing kubeconfig secret")
+	}
+
+	if info, err := DetectCAPICluster(kc); err != nil || info != nil {
+		t.Errorf("expected no info for multiple clusters, got %v, %v", info, err)
+	}
+}
+
+func TestListCAPIClustersNotInstalled(t *testing.T) {
+	kc := fake.NewClientBuilder().WithRESTMapper(meta.NewDefaultRESTMapper(nil)).Build()
+	clusters, err := ListCAPIClusters(context.TODO(), kc)
+	if err != nil || clusters != nil {
+		t.Errorf("expected no clusters, got %v, %v", clusters, err)
+	}
+}
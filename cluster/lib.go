@@ -38,8 +38,12 @@ import (
 )
 
 func ClusterUID(c client.Reader) (string, error) {
+	return ClusterUIDWithContext(context.TODO(), c)
+}
+
+func ClusterUIDWithContext(ctx context.Context, c client.Reader) (string, error) {
 	var ns core.Namespace
-	err := c.Get(context.TODO(), client.ObjectKey{Name: metav1.NamespaceSystem}, &ns)
+	err := c.Get(ctx, client.ObjectKey{Name: metav1.NamespaceSystem}, &ns)
 	if err != nil {
 		return "", err
 	}
@@ -47,16 +51,20 @@ func ClusterUID(c client.Reader) (string, error) {
 }
 
 func ClusterMetadata(c client.Reader) (*kmapi.ClusterMetadata, error) {
+	return ClusterMetadataWithContext(context.TODO(), c)
+}
+
+func ClusterMetadataWithContext(ctx context.Context, c client.Reader) (*kmapi.ClusterMetadata, error) {
 	var ns core.Namespace
-	err := c.Get(context.TODO(), client.ObjectKey{Name: metav1.NamespaceSystem}, &ns)
+	err := c.Get(ctx, client.ObjectKey{Name: metav1.NamespaceSystem}, &ns)
 	if err != nil {
 		return nil, err
 	}
 
 	var cm core.ConfigMap
-	err = c.Get(context.TODO(), client.ObjectKey{Name: kmapi.AceInfoConfigMapName, Namespace: metav1.NamespacePublic}, &cm)
+	err = c.Get(ctx, client.ObjectKey{Name: kmapi.AceInfoConfigMapName, Namespace: metav1.NamespacePublic}, &cm)
 	if err == nil {
-		result, err := ClusterMetadataFromConfigMap(&cm, DetectClusterMode(&ns), string(ns.UID))
+		result, err := ClusterMetadataFromConfigMap(&cm, DetectClusterMode(&ns), string(ns.UID)) // nolint:staticcheck
 		if err == nil {
 			return result, nil
 		}
@@ -93,22 +101,16 @@ func LegacyClusterMetadataFromNamespace(ns *core.Namespace) (*kmapi.ClusterMetad
 	return md, nil
 }
 
+// ClusterMetadataFromConfigMap reads the cluster metadata from the ace-info ConfigMap.
+//
+// Deprecated: The mac of the ConfigMap is keyed by the cluster UID, which is readable by anyone who can
+// read the kube-system namespace, so the ConfigMap can be forged. Use VerifiedClusterMetadataFromConfigMap.
 func ClusterMetadataFromConfigMap(cm *core.ConfigMap, mode kmapi.ClusterMode, clusterUIDVerifier string) (*kmapi.ClusterMetadata, error) {
 	if cm.Name != kmapi.AceInfoConfigMapName || cm.Namespace != metav1.NamespacePublic {
 		return nil, fmt.Errorf("expected configmap %s/%s, found %s/%s", metav1.NamespacePublic, kmapi.AceInfoConfigMapName, cm.Namespace, cm.Name)
 	}
 
-	md := &kmapi.ClusterMetadata{
-		UID:                  cm.Data["uid"],
-		Name:                 cm.Data["name"],
-		DisplayName:          cm.Data["displayName"],
-		Provider:             kmapi.HostingProvider(cm.Data["provider"]),
-		OwnerID:              cm.Data["ownerID"],
-		OwnerType:            cm.Data["ownerType"],
-		APIEndpoint:          cm.Data["apiEndpoint"],
-		CABundle:             cm.Data["ca.crt"],
-		CloudServiceAuthMode: cm.Data["cloudServiceAuthMode"],
-	}
+	md := clusterMetadataFromData(cm.Data)
 
 	data, err := json.Marshal(md)
 	if err != nil {
@@ -169,18 +171,14 @@ func UpsertClusterMetadata(kc client.Client, md *kmapi.ClusterMetadata) error {
 	return err
 }
 
+// DetectCAPICluster returns the CAPI info of the cluster, if it holds a single cluster.x-k8s.io Cluster object
+// describing itself. Use ListCAPIClusters for management clusters.
 func DetectCAPICluster(kc client.Reader) (*kmapi.CAPIClusterInfo, error) {
-	var list unstructured.UnstructuredList
-	list.SetGroupVersionKind(schema.GroupVersionKind{
-		Group:   "cluster.x-k8s.io",
-		Version: "v1beta1",
-		Kind:    "Cluster",
-	})
-	err := kc.List(context.TODO(), &list)
-	if meta.IsNoMatchError(err) || len(list.Items) == 0 {
-		return nil, nil
-	} else if err != nil {
+	list, _, err := listCAPIClusters(context.TODO(), kc)
+	if err != nil {
 		return nil, err
+	} else if list == nil || len(list.Items) == 0 {
+		return nil, nil
 	} else if len(list.Items) > 1 {
 		klog.Warningln("multiple CAPI cluster object found")
 		return nil, nil
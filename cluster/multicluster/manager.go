@@ -0,0 +1,407 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	cu "kmodules.xyz/client-go/client"
+	"kmodules.xyz/client-go/cluster"
+	disco_util "kmodules.xyz/client-go/discovery"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+const (
+	// DefaultHealthCheckInterval is the interval between two health checks of the registered clusters.
+	DefaultHealthCheckInterval = time.Minute
+	// DefaultHealthCheckTimeout is the time allowed for the health check of a cluster and for each
+	// request made by Add to detect the uid and metadata of a cluster.
+	DefaultHealthCheckTimeout = 10 * time.Second
+	// DefaultParallelism is the number of clusters visited concurrently by ForEachCluster.
+	DefaultParallelism = 10
+)
+
+// Cluster holds the clients of a registered cluster.
+type Cluster struct {
+	Name     string
+	UID      string
+	Metadata *kmapi.ClusterMetadata
+	Config   *rest.Config
+
+	Client    client.Client
+	Discovery discovery.CachedDiscoveryInterface
+	Mapper    disco_util.ResourceMapper
+
+	mu          sync.RWMutex
+	healthy     bool
+	lastError   error
+	lastChecked time.Time
+}
+
+// Healthy returns true unless the last health check of the cluster failed.
+func (c *Cluster) Healthy() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.healthy
+}
+
+// LastError returns the error of the last failed health check.
+func (c *Cluster) LastError() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastError
+}
+
+// LastChecked returns the time of the last health check.
+func (c *Cluster) LastChecked() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastChecked
+}
+
+func (c *Cluster) setHealth(err error, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.healthy = err == nil
+	c.lastError = err
+	c.lastChecked = now
+}
+
+type options struct {
+	schemeFuncs         []func(*runtime.Scheme) error
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	parallelism         int
+}
+
+type Option func(*options)
+
+// WithSchemeFuncs registers additional types with the scheme of the clients.
+func WithSchemeFuncs(funcs ...func(*runtime.Scheme) error) Option {
+	return func(o *options) {
+		o.schemeFuncs = append(o.schemeFuncs, funcs...)
+	}
+}
+
+// WithHealthCheckInterval sets the interval between two health checks started by Run.
+// A non positive interval uses DefaultHealthCheckInterval.
+func WithHealthCheckInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.healthCheckInterval = d
+	}
+}
+
+// WithHealthCheckTimeout sets the time allowed for the health check of a cluster. It also bounds
+// the requests made by Add to detect the uid and metadata of a cluster. A non positive timeout uses DefaultHealthCheckTimeout.
+func WithHealthCheckTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.healthCheckTimeout = d
+	}
+}
+
+// WithParallelism sets the number of clusters visited concurrently by ForEachCluster and ListAcrossClusters.
+func WithParallelism(n int) Option {
+	return func(o *options) {
+		o.parallelism = n
+	}
+}
+
+// ClusterManager is a registry of clusters keyed by cluster UID. It builds and caches a client,
+// a discovery client and a ResourceMapper for every cluster.
+type ClusterManager struct {
+	opts options
+	// build creates the clients of a cluster, replaced in tests
+	build func(name string, cfg *rest.Config) (*Cluster, error)
+
+	mu       sync.RWMutex
+	clusters map[string]*Cluster
+}
+
+func NewClusterManager(opts ...Option) *ClusterManager {
+	o := options{
+		healthCheckInterval: DefaultHealthCheckInterval,
+		healthCheckTimeout:  DefaultHealthCheckTimeout,
+		parallelism:         DefaultParallelism,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.healthCheckInterval <= 0 {
+		o.healthCheckInterval = DefaultHealthCheckInterval
+	}
+	if o.healthCheckTimeout <= 0 {
+		o.healthCheckTimeout = DefaultHealthCheckTimeout
+	}
+	if o.parallelism <= 0 {
+		o.parallelism = 1
+	}
+	m := &ClusterManager{
+		opts:     o,
+		clusters: map[string]*Cluster{},
+	}
+	m.build = m.buildCluster
+	return m
+}
+
+func (m *ClusterManager) buildCluster(name string, cfg *rest.Config) (*Cluster, error) {
+	hc, err := rest.HTTPClientFor(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dc, err := discovery.NewDiscoveryClientForConfigAndClient(cfg, hc)
+	if err != nil {
+		return nil, err
+	}
+	mapper, err := apiutil.NewDynamicRESTMapper(cfg, hc)
+	if err != nil {
+		return nil, err
+	}
+	kc, err := cu.NewUncachedClient(cfg, m.opts.schemeFuncs...)
+	if err != nil {
+		return nil, err
+	}
+	return &Cluster{
+		Name:      name,
+		Config:    cfg,
+		Client:    kc,
+		Discovery: memory.NewMemCacheClient(dc),
+		Mapper:    disco_util.NewResourceMapper(mapper),
+		healthy:   true,
+	}, nil
+}
+
+// Add registers a cluster. If a cluster with the same UID is already registered, e.g., because two
+// kubeconfig contexts point to the same cluster, the registered cluster is returned.
+func (m *ClusterManager) Add(ctx context.Context, name string, cfg *rest.Config) (*Cluster, error) {
+	c, err := m.build(name, cfg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create clients for cluster %s", name)
+	}
+	if c.UID, err = m.clusterUID(ctx, c); err != nil {
+		return nil, errors.Wrapf(err, "failed to detect uid of cluster %s", name)
+	}
+	if md, err := m.clusterMetadata(ctx, c); err == nil {
+		c.Metadata = md
+	} else {
+		klog.V(3).Infof("failed to detect metadata of cluster %s: %v", name, err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.clusters[c.UID]; ok {
+		klog.V(3).Infof("cluster %s is already registered as %s", name, existing.Name)
+		return existing, nil
+	}
+	m.clusters[c.UID] = c
+	return c, nil
+}
+
+func (m *ClusterManager) clusterUID(ctx context.Context, c *Cluster) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.opts.healthCheckTimeout)
+	defer cancel()
+	return cluster.ClusterUIDWithContext(ctx, c.Client)
+}
+
+func (m *ClusterManager) clusterMetadata(ctx context.Context, c *Cluster) (*kmapi.ClusterMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.opts.healthCheckTimeout)
+	defer cancel()
+	return cluster.ClusterMetadataWithContext(ctx, c.Client)
+}
+
+// Load registers all the clusters of the source. Clusters that could not be registered are
+// skipped and reported in the returned error.
+func (m *ClusterManager) Load(ctx context.Context, src Source) error {
+	configs, err := src.Clusters(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, cc := range configs {
+		if _, err := m.Add(ctx, cc.Name, cc.Config); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Remove unregisters the cluster with the given UID.
+func (m *ClusterManager) Remove(uid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.clusters, uid)
+}
+
+// Get returns the cluster with the given UID.
+func (m *ClusterManager) Get(uid string) (*Cluster, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	c, ok := m.clusters[uid]
+	return c, ok
+}
+
+// GetByName returns the cluster registered with the given name.
+func (m *ClusterManager) GetByName(name string) (*Cluster, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, c := range m.clusters {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Clusters returns the registered clusters sorted by name.
+func (m *ClusterManager) Clusters() []*Cluster {
+	m.mu.RLock()
+	out := make([]*Cluster, 0, len(m.clusters))
+	for _, c := range m.clusters {
+		out = append(out, c)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// HealthyClusters returns the registered clusters that passed their last health check.
+func (m *ClusterManager) HealthyClusters() []*Cluster {
+	var out []*Cluster
+	for _, c := range m.Clusters() {
+		if c.Healthy() {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// CheckHealth checks whether the api server of every registered cluster is reachable.
+func (m *ClusterManager) CheckHealth(ctx context.Context) {
+	m.forEach(ctx, m.Clusters(), func(ctx context.Context, c *Cluster) error {
+		ctx, cancel := context.WithTimeout(ctx, m.opts.healthCheckTimeout)
+		defer cancel()
+		err := serverVersion(ctx, c.Discovery)
+		if err != nil {
+			klog.Warningf("health check of cluster %s failed: %v", c.Name, err)
+		}
+		c.setHealth(err, time.Now())
+		return nil
+	})
+}
+
+// serverVersion reads the version of the api server. Discovery clients without a REST client, eg, fakes,
+// do not support a context, so the context only bounds the wait for them.
+func serverVersion(ctx context.Context, dc discovery.DiscoveryInterface) error {
+	if rc := dc.RESTClient(); rc != nil {
+		return rc.Get().AbsPath("/version").Do(ctx).Error()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := dc.ServerVersion()
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run checks the health of the registered clusters periodically until the context is cancelled.
+func (m *ClusterManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		m.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ForEachCluster calls fn for every healthy cluster concurrently. Errors are aggregated and wrapped
+// with the name of the cluster.
+func (m *ClusterManager) ForEachCluster(ctx context.Context, fn func(ctx context.Context, c *Cluster) error) error {
+	return m.forEach(ctx, m.HealthyClusters(), fn)
+}
+
+func (m *ClusterManager) forEach(ctx context.Context, clusters []*Cluster, fn func(ctx context.Context, c *Cluster) error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	sem := make(chan struct{}, m.opts.parallelism)
+	for _, c := range clusters {
+		wg.Add(1)
+		go func(c *Cluster) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				return
+			}
+			if err := fn(ctx, c); err != nil {
+				mu.Lock()
+				errs = append(errs, errors.Wrapf(err, "cluster %s", c.Name))
+				mu.Unlock()
+			}
+		}(c)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ListAcrossClusters lists the objects of the type of list in every healthy cluster. The result is keyed by
+// cluster UID. Lists of clusters that failed are left out and their errors are aggregated.
+func (m *ClusterManager) ListAcrossClusters(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (map[string]client.ObjectList, error) {
+	var mu sync.Mutex
+	out := map[string]client.ObjectList{}
+	err := m.ForEachCluster(ctx, func(ctx context.Context, c *Cluster) error {
+		result := list.DeepCopyObject().(client.ObjectList)
+		if err := c.Client.List(ctx, result, opts...); err != nil {
+			return err
+		}
+		mu.Lock()
+		out[c.UID] = result
+		mu.Unlock()
+		return nil
+	})
+	return out, err
+}
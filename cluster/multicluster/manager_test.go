@@ -0,0 +1,226 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	disco_util "kmodules.xyz/client-go/discovery"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	kfake "k8s.io/client-go/kubernetes/fake"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const kubeconfig = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: a
+  cluster:
+    server: https://a.example.com
+- name: b
+  cluster:
+    server: https://b.example.com
+users:
+- name: admin
+  user:
+    token: secret
+contexts:
+- name: a
+  context: {cluster: a, user: admin}
+- name: a-alias
+  context: {cluster: a, user: admin}
+- name: b
+  context: {cluster: b, user: admin}
+`
+
+func newTestManager(down map[string]bool) *ClusterManager {
+	m := NewClusterManager()
+	m.build = func(name string, cfg *rest.Config) (*Cluster, error) {
+		host := cfg.Host
+		kc := fake.NewClientBuilder().WithScheme(clientsetscheme.Scheme).WithObjects(
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: metav1.NamespaceSystem, UID: types.UID("uid-" + host)}},
+			&core.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "demo"}},
+		).Build()
+		fd := kfake.NewSimpleClientset()
+		fd.PrependReactor("get", "version", func(clienttesting.Action) (bool, runtime.Object, error) {
+			if down[host] {
+				return true, nil, errors.New("connection refused")
+			}
+			return false, nil, nil
+		})
+		return &Cluster{
+			Name:      name,
+			Config:    cfg,
+			Client:    kc,
+			Discovery: memory.NewMemCacheClient(fd.Discovery()),
+			Mapper:    disco_util.NewResourceMapper(kc.RESTMapper()),
+			healthy:   true,
+		}, nil
+	}
+	return m
+}
+
+func TestClusterManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := newTestManager(map[string]bool{"https://b.example.com": true})
+	if err := m.Load(context.TODO(), KubeConfigSource(path)); err != nil {
+		t.Fatal(err)
+	}
+	clusters := m.Clusters()
+	if len(clusters) != 2 || clusters[0].Name != "a" || clusters[1].Name != "b" {
+		t.Fatalf("unexpected clusters %v", clusters)
+	}
+	if c, ok := m.Get("uid-https://a.example.com"); !ok || c.Name != "a" {
+		t.Errorf("cluster a not found by uid")
+	}
+
+	m.CheckHealth(context.TODO())
+	if clusters[1].Healthy() || clusters[1].LastError() == nil {
+		t.Errorf("expected cluster b to be unhealthy")
+	}
+
+	lists, err := m.ListAcrossClusters(context.TODO(), &core.NamespaceList{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lists) != 1 || len(lists["uid-https://a.example.com"].(*core.NamespaceList).Items) != 2 {
+		t.Errorf("unexpected lists %v", lists)
+	}
+
+	err = m.ForEachCluster(context.TODO(), func(ctx context.Context, c *Cluster) error {
+		return errors.New("boom")
+	})
+	if err == nil || err.Error() != "cluster a: boom" {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// blockingReader blocks every Get until the context is done, like an api server that does not respond.
+type blockingReader struct {
+	client.Client
+}
+
+func (c blockingReader) Get(ctx context.Context, _ client.ObjectKey, _ client.Object, _ ...client.GetOption) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestAddTimeout(t *testing.T) {
+	m := NewClusterManager(WithHealthCheckTimeout(50 * time.Millisecond))
+	m.build = func(name string, cfg *rest.Config) (*Cluster, error) {
+		return &Cluster{Name: name, Config: cfg, Client: blockingReader{}, healthy: true}, nil
+	}
+
+	start := time.Now()
+	if _, err := m.Add(context.TODO(), "a", &rest.Config{Host: "https://a.example.com"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the uid detection to time out, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("expected Add to return after the timeout, took %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	if _, err := m.Add(ctx, "a", &rest.Config{Host: "https://a.example.com"}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected Add to honor the canceled context, got %v", err)
+	}
+}
+
+func TestKubeConfigSourceReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src := KubeConfigSource(path)
+	configs, err := src.Clusters(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 3 {
+		t.Fatalf("expected 3 contexts, got %d", len(configs))
+	}
+
+	// the contexts are listed again when the kubeconfig changes
+	if err := os.WriteFile(path, []byte(strings.Split(kubeconfig, "- name: b\n  context:")[0]), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configs, err = src.Clusters(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 contexts, got %d", len(configs))
+	}
+}
+
+func TestRancherClusterURL(t *testing.T) {
+	for host, want := range map[string]string{
+		"https://rancher.example.com":                         "https://rancher.example.com/k8s/clusters/c-m-abc",
+		"https://rancher.example.com/k8s/clusters/local":      "https://rancher.example.com/k8s/clusters/c-m-abc",
+		"https://rancher.example.com:8443/k8s/clusters/c-xyz": "https://rancher.example.com:8443/k8s/clusters/c-m-abc",
+	} {
+		got, err := rancherClusterURL(host, "c-m-abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("rancherClusterURL(%s) = %s, want %s", host, got, want)
+		}
+	}
+}
+
+func TestCheckHealthTimeout(t *testing.T) {
+	m := NewClusterManager(WithHealthCheckInterval(0), WithHealthCheckTimeout(10*time.Millisecond))
+	if m.opts.healthCheckInterval != DefaultHealthCheckInterval {
+		t.Errorf("expected the default interval, got %s", m.opts.healthCheckInterval)
+	}
+
+	unblock := make(chan struct{})
+	defer close(unblock)
+	fd := kfake.NewSimpleClientset()
+	fd.PrependReactor("get", "version", func(clienttesting.Action) (bool, runtime.Object, error) {
+		<-unblock
+		return false, nil, nil
+	})
+	c := &Cluster{Name: "slow", Discovery: memory.NewMemCacheClient(fd.Discovery()), healthy: true}
+	m.clusters["uid-slow"] = c
+
+	m.CheckHealth(context.TODO())
+	if c.Healthy() || !errors.Is(c.LastError(), context.DeadlineExceeded) {
+		t.Errorf("expected the health check to time out, got %v", c.LastError())
+	}
+}
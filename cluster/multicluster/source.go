@@ -0,0 +1,180 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multicluster
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"sort"
+
+	"kmodules.xyz/client-go/cluster"
+
+	"github.com/pkg/errors"
+	rancher "github.com/rancher/rancher/pkg/client/generated/management/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ClusterConfig is a named rest.Config of a cluster found by a Source.
+type ClusterConfig struct {
+	Name   string
+	Config *rest.Config
+}
+
+// Source finds the clusters to be registered with a ClusterManager.
+type Source interface {
+	Clusters(ctx context.Context) ([]ClusterConfig, error)
+}
+
+// SourceFunc adapts a function to a Source.
+type SourceFunc func(ctx context.Context) ([]ClusterConfig, error)
+
+func (fn SourceFunc) Clusters(ctx context.Context) ([]ClusterConfig, error) {
+	return fn(ctx)
+}
+
+// KubeConfigSource returns a Source for the contexts of a kubeconfig file. All the contexts are
+// used if none is given. Clusters are named after their context.
+func KubeConfigSource(kubeconfigPath string, contexts ...string) Source {
+	return SourceFunc(func(_ context.Context) ([]ClusterConfig, error) {
+		cfg, err := clientcmd.LoadFromFile(kubeconfigPath)
+		if err != nil {
+			return nil, err
+		}
+		names := contexts
+		if len(names) == 0 {
+			names = make([]string, 0, len(cfg.Contexts))
+			for name := range cfg.Contexts {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		out := make([]ClusterConfig, 0, len(names))
+		for _, name := range names {
+			if _, ok := cfg.Contexts[name]; !ok {
+				return nil, errors.Errorf("context %s not found in %s", name, kubeconfigPath)
+			}
+			rc, err := clientcmd.NewNonInteractiveClientConfig(*cfg, name, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to build config for context %s", name)
+			}
+			out = append(out, ClusterConfig{Name: name, Config: rc})
+		}
+		return out, nil
+	})
+}
+
+// OCMSource returns a Source for the available ManagedClusters of an Open Cluster Management hub. The
+// clusters are reached via the cluster-proxy user server at proxyURL, using the credentials of base.
+func OCMSource(hub client.Reader, proxyURL string, base *rest.Config) Source {
+	return SourceFunc(func(ctx context.Context) ([]ClusterConfig, error) {
+		var list unstructured.UnstructuredList
+		list.SetAPIVersion("cluster.open-cluster-management.io/v1")
+		list.SetKind("ManagedCluster")
+		if err := hub.List(ctx, &list); err != nil {
+			return nil, err
+		}
+
+		var out []ClusterConfig
+		for _, item := range list.Items {
+			if !managedClusterAvailable(item) {
+				continue
+			}
+			host, err := joinURL(proxyURL, item.GetName())
+			if err != nil {
+				return nil, err
+			}
+			cfg := rest.CopyConfig(base)
+			cfg.Host = host
+			out = append(out, ClusterConfig{Name: item.GetName(), Config: cfg})
+		}
+		return out, nil
+	})
+}
+
+func managedClusterAvailable(obj unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, c := range conditions {
+		m, ok := c.(map[string]any)
+		if ok && m["type"] == "ManagedClusterConditionAvailable" && m["status"] == string(metav1.ConditionTrue) {
+			return true
+		}
+	}
+	return false
+}
+
+// RancherSource returns a Source for the active downstream clusters of the Rancher server that proxies the
+// given config. The clusters are reached via the Rancher cluster proxy, using the credentials of the config.
+func RancherSource(cfg *rest.Config) Source {
+	return SourceFunc(func(_ context.Context) ([]ClusterConfig, error) {
+		opts, found, err := cluster.DetectRancherProxy(rest.CopyConfig(cfg))
+		if err != nil {
+			return nil, err
+		} else if !found {
+			return nil, errors.Errorf("%s is not a Rancher managed cluster", cfg.Host)
+		}
+		rc, err := rancher.NewClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		clusters, err := rc.Cluster.ListAll(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var out []ClusterConfig
+		for _, c := range clusters.Data {
+			if c.State != "active" {
+				continue
+			}
+			host, err := rancherClusterURL(cfg.Host, c.ID)
+			if err != nil {
+				return nil, err
+			}
+			c2 := rest.CopyConfig(cfg)
+			c2.Host = host
+			out = append(out, ClusterConfig{Name: c.Name, Config: c2})
+		}
+		return out, nil
+	})
+}
+
+// rancherClusterURL returns the URL of the Rancher cluster proxy for the cluster. The path of host points
+// to the proxy of the cluster used to reach Rancher, eg, /k8s/clusters/local, so it is replaced.
+func rancherClusterURL(host, clusterID string) (string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	u.Path = "/k8s/clusters/" + clusterID
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+func joinURL(base string, elems ...string) (string, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return "", err
+	}
+	u.Path = path.Join(append([]string{"/", u.Path}, elems...)...)
+	return u.String(), nil
+}
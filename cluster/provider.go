@@ -0,0 +1,274 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Distribution is the Kubernetes distribution running a cluster.
+type Distribution string
+
+const (
+	DistributionOpenShift Distribution = "OpenShift"
+	DistributionK3s       Distribution = "k3s"
+	DistributionKind      Distribution = "kind"
+	DistributionRKE2      Distribution = "RKE2"
+	DistributionTalos     Distribution = "Talos"
+	DistributionKubeadm   Distribution = "kubeadm"
+)
+
+const (
+	// MinProviderConfidence is the confidence from which the provider reported by DetectHostingProvider
+	// can be trusted.
+	MinProviderConfidence = 0.5
+
+	// maxWeakConfidence caps the confidence of a provider that is only backed by weak signals.
+	maxWeakConfidence = 0.4
+)
+
+// ProviderSignal is a piece of evidence found by a ProviderDetector. Either Provider or Distribution or
+// both are set. Weight is the probability that the evidence is right, between 0 and 1.
+type ProviderSignal struct {
+	Provider     kmapi.HostingProvider
+	Distribution Distribution
+	// Version of the distribution, if the evidence includes it.
+	Version  string
+	Weight   float64
+	Evidence string
+	// Weak is set for evidence of a managed service that is also found on self-managed clusters running
+	// on the same cloud, e.g., the providerID of the nodes. Weak signals alone never reach MinProviderConfidence.
+	Weak bool
+}
+
+// ProviderInfo is the result of DetectHostingProvider.
+type ProviderInfo struct {
+	Provider kmapi.HostingProvider
+	// ProviderConfidence combines the weights of all the signals for the provider, between 0 and 1.
+	ProviderConfidence float64
+	Distribution       Distribution
+	// DistributionConfidence combines the weights of all the signals for the distribution, between 0 and 1.
+	DistributionConfidence float64
+	// Version is the version of the distribution if known, or the version of the api server otherwise.
+	Version  string
+	Evidence []string
+}
+
+// ClusterFacts holds the information about a cluster shared by all the ProviderDetectors. Facts that could
+// not be collected, e.g., due to missing RBAC permissions, are left empty.
+type ClusterFacts struct {
+	Config        *rest.Config
+	Mapper        meta.RESTMapper
+	ServerVersion *version.Info
+	Nodes         []core.Node
+	// KubeSystemWorkloads are the names of the Deployments and DaemonSets in the kube-system namespace.
+	KubeSystemWorkloads []string
+}
+
+// HasAPIGroup returns true if the api server serves the given group and kind.
+func (f *ClusterFacts) HasAPIGroup(group, kind string) bool {
+	if f.Mapper == nil {
+		return false
+	}
+	_, err := f.Mapper.RESTMappings(schema.GroupKind{Group: group, Kind: kind})
+	return err == nil
+}
+
+// ProviderDetector finds evidence of the hosting provider or distribution of a cluster.
+type ProviderDetector interface {
+	Name() string
+	Detect(ctx context.Context, facts *ClusterFacts) ([]ProviderSignal, error)
+}
+
+// ProviderDetectorFunc adapts a function to a ProviderDetector.
+type ProviderDetectorFunc struct {
+	DetectorName string
+	Fn           func(ctx context.Context, facts *ClusterFacts) ([]ProviderSignal, error)
+}
+
+func (d ProviderDetectorFunc) Name() string {
+	return d.DetectorName
+}
+
+func (d ProviderDetectorFunc) Detect(ctx context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+	return d.Fn(ctx, facts)
+}
+
+var (
+	detectorsMu sync.RWMutex
+	detectors   = []ProviderDetector{
+		certificateDetector,
+		versionDetector,
+		providerIDDetector,
+		nodeDetector,
+		workloadDetector,
+		apiGroupDetector,
+	}
+)
+
+// RegisterProviderDetector adds a detector used by DetectHostingProvider.
+func RegisterProviderDetector(d ProviderDetector) {
+	detectorsMu.Lock()
+	defer detectorsMu.Unlock()
+	detectors = append(detectors, d)
+}
+
+func registeredDetectors() []ProviderDetector {
+	detectorsMu.RLock()
+	defer detectorsMu.RUnlock()
+	return append([]ProviderDetector(nil), detectors...)
+}
+
+// CollectClusterFacts collects the information used by the ProviderDetectors. cfg, kc and mapper are optional.
+func CollectClusterFacts(ctx context.Context, cfg *rest.Config, kc client.Reader, mapper meta.RESTMapper) *ClusterFacts {
+	facts := &ClusterFacts{Config: cfg, Mapper: mapper}
+	if cfg != nil {
+		if dc, err := discovery.NewDiscoveryClientForConfig(cfg); err != nil {
+			klog.V(3).Infof("failed to create discovery client: %v", err)
+		} else if facts.ServerVersion, err = dc.ServerVersion(); err != nil {
+			klog.V(3).Infof("failed to detect server version: %v", err)
+		}
+	}
+	if kc == nil {
+		return facts
+	}
+
+	var nodes core.NodeList
+	if err := kc.List(ctx, &nodes, client.Limit(100)); err != nil {
+		klog.V(3).Infof("failed to list nodes: %v", err)
+	} else {
+		facts.Nodes = nodes.Items
+	}
+
+	var deployments apps.DeploymentList
+	if err := kc.List(ctx, &deployments, client.InNamespace(metav1.NamespaceSystem)); err != nil {
+		klog.V(3).Infof("failed to list deployments in %s: %v", metav1.NamespaceSystem, err)
+	}
+	for _, d := range deployments.Items {
+		facts.KubeSystemWorkloads = append(facts.KubeSystemWorkloads, d.Name)
+	}
+	var daemonsets apps.DaemonSetList
+	if err := kc.List(ctx, &daemonsets, client.InNamespace(metav1.NamespaceSystem)); err != nil {
+		klog.V(3).Infof("failed to list daemonsets in %s: %v", metav1.NamespaceSystem, err)
+	}
+	for _, ds := range daemonsets.Items {
+		facts.KubeSystemWorkloads = append(facts.KubeSystemWorkloads, ds.Name)
+	}
+	sort.Strings(facts.KubeSystemWorkloads)
+	return facts
+}
+
+// DetectHostingProvider runs the registered ProviderDetectors and combines their signals. The provider
+// and distribution with the highest confidence are returned. Clusters with a known distribution and no
+// provider, or a provider only backed by weak signals, are reported as HostingProviderGeneric.
+func DetectHostingProvider(ctx context.Context, cfg *rest.Config, kc client.Reader, mapper meta.RESTMapper) (*ProviderInfo, error) {
+	return DetectHostingProviderFromFacts(ctx, CollectClusterFacts(ctx, cfg, kc, mapper))
+}
+
+// DetectHostingProviderFromFacts is like DetectHostingProvider for already collected facts.
+func DetectHostingProviderFromFacts(ctx context.Context, facts *ClusterFacts) (*ProviderInfo, error) {
+	var signals []ProviderSignal
+	var errs []error
+	for _, d := range registeredDetectors() {
+		s, err := d.Detect(ctx, facts)
+		if err != nil {
+			klog.V(3).Infof("provider detector %s failed: %v", d.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", d.Name(), err))
+		}
+		signals = append(signals, s...)
+	}
+	info := combineSignals(signals)
+	if info.Version == "" && facts.ServerVersion != nil {
+		info.Version = facts.ServerVersion.GitVersion
+	}
+	if info.Provider == "" && info.Distribution == "" && len(errs) > 0 {
+		return info, utilerrors.NewAggregate(errs)
+	}
+	return info, nil
+}
+
+func combineSignals(signals []ProviderSignal) *ProviderInfo {
+	// weights are combined as independent evidences, so that the confidence never exceeds 1
+	providers := map[kmapi.HostingProvider]float64{}
+	strong := map[kmapi.HostingProvider]bool{}
+	distributions := map[Distribution]float64{}
+	for _, s := range signals {
+		if s.Provider != "" {
+			providers[s.Provider] = 1 - (1-providers[s.Provider])*(1-clamp(s.Weight))
+			strong[s.Provider] = strong[s.Provider] || !s.Weak
+		}
+		if s.Distribution != "" {
+			distributions[s.Distribution] = 1 - (1-distributions[s.Distribution])*(1-clamp(s.Weight))
+		}
+	}
+
+	info := &ProviderInfo{}
+	for p, c := range providers {
+		if !strong[p] {
+			c = min(c, maxWeakConfidence)
+		}
+		if c > info.ProviderConfidence || (c == info.ProviderConfidence && p < info.Provider) {
+			info.Provider, info.ProviderConfidence = p, c
+		}
+	}
+	for d, c := range distributions {
+		if c > info.DistributionConfidence || (c == info.DistributionConfidence && d < info.Distribution) {
+			info.Distribution, info.DistributionConfidence = d, c
+		}
+	}
+	if info.Distribution != "" && (info.Provider == "" || !strong[info.Provider]) {
+		info.Provider = kmapi.HostingProviderGeneric
+		info.ProviderConfidence = info.DistributionConfidence
+	}
+
+	var bestVersionWeight float64
+	for _, s := range signals {
+		if (s.Provider != "" && s.Provider == info.Provider) || (s.Distribution != "" && s.Distribution == info.Distribution) {
+			info.Evidence = append(info.Evidence, s.Evidence)
+			if s.Version != "" && s.Weight > bestVersionWeight {
+				info.Version, bestVersionWeight = s.Version, s.Weight
+			}
+		}
+	}
+	return info
+}
+
+func clamp(w float64) float64 {
+	if w < 0 {
+		return 0
+	} else if w > 1 {
+		return 1
+	}
+	return w
+}
@@ -0,0 +1,305 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+)
+
+var certificateDetector = ProviderDetectorFunc{
+	DetectorName: "certificate",
+	Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+		if facts.Config == nil {
+			return nil, nil
+		}
+		crt, err := APIServerCertificate(facts.Config)
+		if err != nil {
+			return nil, err
+		}
+		domains := []struct {
+			suffix   string
+			provider kmapi.HostingProvider
+		}{
+			{eksDomain, kmapi.HostingProviderEKS},
+			{aksDomain, kmapi.HostingProviderAKS},
+			{doDomain, kmapi.HostingProviderDigitalOcean},
+			{exoscaleDomain, kmapi.HostingProviderExoscale},
+			{lkeDomain, kmapi.HostingProviderLinode},
+			{scalewayDomain, kmapi.HostingProviderScaleway},
+			{vultrDomain, kmapi.HostingProviderVultr},
+		}
+		var signals []ProviderSignal
+		for _, host := range crt.DNSNames {
+			for _, d := range domains {
+				if strings.HasSuffix(host, d.suffix) {
+					signals = append(signals, ProviderSignal{
+						Provider: d.provider,
+						Weight:   0.9,
+						Evidence: "api server certificate is issued for " + host,
+					})
+				}
+			}
+		}
+		return signals, nil
+	},
+}
+
+var versionDetector = ProviderDetectorFunc{
+	DetectorName: "version",
+	Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+		if facts.ServerVersion == nil {
+			return nil, nil
+		}
+		if s, ok := signalFromVersion(facts.ServerVersion.GitVersion, 0.8, "api server version"); ok {
+			return []ProviderSignal{s}, nil
+		}
+		return nil, nil
+	},
+}
+
+// signalFromVersion detects the markers added to the kubernetes version by managed services and distributions.
+func signalFromVersion(v string, weight float64, source string) (ProviderSignal, bool) {
+	s := ProviderSignal{Weight: weight, Evidence: source + " is " + v}
+	switch {
+	case strings.Contains(v, "-eks-"):
+		s.Provider = kmapi.HostingProviderEKS
+	case strings.Contains(v, "-gke."):
+		s.Provider = kmapi.HostingProviderGKE
+	case strings.Contains(v, "+IKS"):
+		s.Provider = kmapi.HostingProviderIKS
+	case strings.Contains(v, "+k3s"):
+		s.Distribution = DistributionK3s
+		s.Version = v
+	case strings.Contains(v, "+rke2"):
+		s.Distribution = DistributionRKE2
+		s.Version = v
+	default:
+		return s, false
+	}
+	return s, true
+}
+
+var providerIDPrefixes = []struct {
+	prefix       string
+	provider     kmapi.HostingProvider
+	distribution Distribution
+	weight       float64
+	weak         bool
+}{
+	// self-managed clusters on these clouds use the same provider ids as the managed service
+	{"aws://", kmapi.HostingProviderEKS, "", 0.4, true},
+	{"azure://", kmapi.HostingProviderAKS, "", 0.4, true},
+	{"gce://", kmapi.HostingProviderGKE, "", 0.4, true},
+	{"digitalocean://", kmapi.HostingProviderDigitalOcean, "", 0.7, false},
+	{"linode://", kmapi.HostingProviderLinode, "", 0.7, false},
+	{"scaleway://", kmapi.HostingProviderScaleway, "", 0.7, false},
+	{"vultr://", kmapi.HostingProviderVultr, "", 0.7, false},
+	{"exoscale://", kmapi.HostingProviderExoscale, "", 0.7, false},
+	{"equinixmetal://", kmapi.HostingProviderPacket, "", 0.5, false},
+	{"packet://", kmapi.HostingProviderPacket, "", 0.5, false},
+	{"oci://", kmapi.HostingProviderOKE, "", 0.6, false},
+	{"ocid1.", kmapi.HostingProviderOKE, "", 0.6, false},
+	{"ibm://", kmapi.HostingProviderIKS, "", 0.6, false},
+	{"kind://", "", DistributionKind, 0.9, false},
+	{"k3s://", "", DistributionK3s, 0.9, false},
+	{"rke2://", "", DistributionRKE2, 0.9, false},
+}
+
+var providerIDDetector = ProviderDetectorFunc{
+	DetectorName: "providerID",
+	Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+		for _, node := range facts.Nodes {
+			for _, p := range providerIDPrefixes {
+				if strings.HasPrefix(node.Spec.ProviderID, p.prefix) {
+					return []ProviderSignal{{
+						Provider:     p.provider,
+						Distribution: p.distribution,
+						Weight:       p.weight,
+						Evidence:     "node " + node.Name + " has providerID " + node.Spec.ProviderID,
+						Weak:         p.weak,
+					}}, nil
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+var nodeLabels = []struct {
+	key          string
+	value        string
+	provider     kmapi.HostingProvider
+	distribution Distribution
+	weight       float64
+}{
+	{"eks.amazonaws.com/nodegroup", "", kmapi.HostingProviderEKS, "", 0.6},
+	{"eks.amazonaws.com/compute-type", "", kmapi.HostingProviderEKS, "", 0.6},
+	{"kubernetes.azure.com/cluster", "", kmapi.HostingProviderAKS, "", 0.6},
+	{"cloud.google.com/gke-nodepool", "", kmapi.HostingProviderGKE, "", 0.6},
+	{"doks.digitalocean.com/node-id", "", kmapi.HostingProviderDigitalOcean, "", 0.6},
+	{"lke.linode.com/pool-id", "", kmapi.HostingProviderLinode, "", 0.6},
+	{"k8s.scaleway.com/pool-name", "", kmapi.HostingProviderScaleway, "", 0.6},
+	{"vke.vultr.com/node-pool", "", kmapi.HostingProviderVultr, "", 0.6},
+	{"oci.oraclecloud.com/fault-domain", "", kmapi.HostingProviderOKE, "", 0.5},
+	{"ibm-cloud.kubernetes.io/worker-id", "", kmapi.HostingProviderIKS, "", 0.6},
+	{"node.openshift.io/os_id", "", "", DistributionOpenShift, 0.6},
+	{"node.kubernetes.io/instance-type", "k3s", "", DistributionK3s, 0.7},
+	{"node.kubernetes.io/instance-type", "rke2", "", DistributionRKE2, 0.7},
+}
+
+var nodeAnnotations = []struct {
+	key          string
+	distribution Distribution
+	weight       float64
+}{
+	{"k3s.io/hostname", DistributionK3s, 0.6},
+	{"rke2.io/hostname", DistributionRKE2, 0.6},
+	{"kubeadm.alpha.kubernetes.io/cri-socket", DistributionKubeadm, 0.5},
+}
+
+var talosVersion = regexp.MustCompile(`^Talos \((v[^)]+)\)`)
+
+var nodeDetector = ProviderDetectorFunc{
+	DetectorName: "node",
+	Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+		if len(facts.Nodes) == 0 {
+			return nil, nil
+		}
+		// labels of a single node are representative, since all the nodes of a cluster are set up alike
+		node := facts.Nodes[0]
+		var signals []ProviderSignal
+		for _, l := range nodeLabels {
+			v, ok := node.Labels[l.key]
+			if !ok || (l.value != "" && v != l.value) {
+				continue
+			}
+			signals = append(signals, ProviderSignal{
+				Provider:     l.provider,
+				Distribution: l.distribution,
+				Weight:       l.weight,
+				Evidence:     "node " + node.Name + " has label " + l.key,
+			})
+		}
+		for _, a := range nodeAnnotations {
+			if _, ok := node.Annotations[a.key]; ok {
+				signals = append(signals, ProviderSignal{
+					Distribution: a.distribution,
+					Weight:       a.weight,
+					Evidence:     "node " + node.Name + " has annotation " + a.key,
+				})
+			}
+		}
+
+		info := node.Status.NodeInfo
+		if m := talosVersion.FindStringSubmatch(info.OSImage); m != nil {
+			signals = append(signals, ProviderSignal{
+				Distribution: DistributionTalos,
+				Version:      m[1],
+				Weight:       0.9,
+				Evidence:     "node " + node.Name + " runs " + info.OSImage,
+			})
+		} else if strings.Contains(info.OSImage, "CoreOS") && strings.Contains(info.OSImage, "Red Hat") {
+			signals = append(signals, ProviderSignal{
+				Distribution: DistributionOpenShift,
+				Weight:       0.6,
+				Evidence:     "node " + node.Name + " runs " + info.OSImage,
+			})
+		}
+		if s, ok := signalFromVersion(info.KubeletVersion, 0.7, "kubelet version of node "+node.Name); ok {
+			signals = append(signals, s)
+		}
+		return signals, nil
+	},
+}
+
+var kubeSystemWorkloads = []struct {
+	name         string
+	provider     kmapi.HostingProvider
+	distribution Distribution
+	weight       float64
+	weak         bool
+}{
+	{"kindnet", "", DistributionKind, 0.8, false},
+	// the vpc cni and the azure cloud provider are also installed on self-managed clusters
+	{"aws-node", kmapi.HostingProviderEKS, "", 0.3, true},
+	{"eks-pod-identity-agent", kmapi.HostingProviderEKS, "", 0.6, false},
+	{"cloud-node-manager", kmapi.HostingProviderAKS, "", 0.3, true},
+	{"azure-ip-masq-agent", kmapi.HostingProviderAKS, "", 0.6, false},
+	{"gke-metadata-server", kmapi.HostingProviderGKE, "", 0.6, false},
+	{"ibm-master-proxy-static", kmapi.HostingProviderIKS, "", 0.6, false},
+	{"proxymux-client", kmapi.HostingProviderOKE, "", 0.6, false},
+	{"rke2-canal", "", DistributionRKE2, 0.6, false},
+	{"rke2-coredns-rke2-coredns", "", DistributionRKE2, 0.6, false},
+	{"local-path-provisioner", "", DistributionK3s, 0.3, false},
+	{"traefik", "", DistributionK3s, 0.2, false},
+}
+
+var workloadDetector = ProviderDetectorFunc{
+	DetectorName: "workload",
+	Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+		var signals []ProviderSignal
+		for _, w := range kubeSystemWorkloads {
+			if slices.Contains(facts.KubeSystemWorkloads, w.name) {
+				signals = append(signals, ProviderSignal{
+					Provider:     w.provider,
+					Distribution: w.distribution,
+					Weight:       w.weight,
+					Evidence:     "kube-system runs " + w.name,
+					Weak:         w.weak,
+				})
+			}
+		}
+		return signals, nil
+	},
+}
+
+var apiGroups = []struct {
+	group        string
+	kind         string
+	provider     kmapi.HostingProvider
+	distribution Distribution
+	weight       float64
+}{
+	{"config.openshift.io", "ClusterVersion", "", DistributionOpenShift, 0.9},
+	{"networking.gke.io", "Network", kmapi.HostingProviderGKE, "", 0.8},
+	{"vpcresources.k8s.aws", "SecurityGroupPolicy", kmapi.HostingProviderEKS, "", 0.6},
+	{"k3s.cattle.io", "Addon", "", DistributionK3s, 0.8},
+	{"management.cattle.io", "Cluster", kmapi.HostingProviderRancher, "", 0.3},
+}
+
+var apiGroupDetector = ProviderDetectorFunc{
+	DetectorName: "apiGroup",
+	Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+		var signals []ProviderSignal
+		for _, g := range apiGroups {
+			if facts.HasAPIGroup(g.group, g.kind) {
+				signals = append(signals, ProviderSignal{
+					Provider:     g.provider,
+					Distribution: g.distribution,
+					Weight:       g.weight,
+					Evidence:     "api server serves " + g.kind + "." + g.group,
+				})
+			}
+		}
+		return signals, nil
+	},
+}
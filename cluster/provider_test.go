@@ -0,0 +1,174 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"testing"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/version"
+)
+
+func TestDetectHostingProvider(t *testing.T) {
+	tests := []struct {
+		name         string
+		facts        ClusterFacts
+		provider     kmapi.HostingProvider
+		distribution Distribution
+		version      string
+	}{
+		{
+			name: "eks",
+			facts: ClusterFacts{
+				ServerVersion: &version.Info{GitVersion: "v1.30.4-eks-a737599"},
+				Nodes: []core.Node{{
+					ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-0-1", Labels: map[string]string{"eks.amazonaws.com/nodegroup": "default"}},
+					Spec:       core.NodeSpec{ProviderID: "aws:///us-east-1a/i-0123"},
+				}},
+				KubeSystemWorkloads: []string{"aws-node", "coredns", "kube-proxy"},
+			},
+			provider: kmapi.HostingProviderEKS,
+			version:  "v1.30.4-eks-a737599",
+		},
+		{
+			name: "k3s",
+			facts: ClusterFacts{
+				ServerVersion: &version.Info{GitVersion: "v1.30.4+k3s1"},
+				Nodes: []core.Node{{
+					ObjectMeta: metav1.ObjectMeta{Name: "server", Annotations: map[string]string{"k3s.io/hostname": "server"}},
+					Spec:       core.NodeSpec{ProviderID: "k3s://server"},
+				}},
+			},
+			provider:     kmapi.HostingProviderGeneric,
+			distribution: DistributionK3s,
+			version:      "v1.30.4+k3s1",
+		},
+		{
+			name: "talos on oke",
+			facts: ClusterFacts{
+				ServerVersion: &version.Info{GitVersion: "v1.31.0"},
+				Nodes: []core.Node{{
+					ObjectMeta: metav1.ObjectMeta{Name: "worker"},
+					Spec:       core.NodeSpec{ProviderID: "ocid1.instance.oc1.iad.abc"},
+					Status:     core.NodeStatus{NodeInfo: core.NodeSystemInfo{OSImage: "Talos (v1.8.0)"}},
+				}},
+			},
+			provider:     kmapi.HostingProviderOKE,
+			distribution: DistributionTalos,
+			version:      "v1.8.0",
+		},
+		{
+			name: "kind",
+			facts: ClusterFacts{
+				ServerVersion: &version.Info{GitVersion: "v1.31.0"},
+				Nodes: []core.Node{{
+					ObjectMeta: metav1.ObjectMeta{Name: "kind-control-plane", Annotations: map[string]string{"kubeadm.alpha.kubernetes.io/cri-socket": "unix:///run/containerd/containerd.sock"}},
+					Spec:       core.NodeSpec{ProviderID: "kind://docker/kind/kind-control-plane"},
+				}},
+				KubeSystemWorkloads: []string{"coredns", "kindnet", "kube-proxy"},
+			},
+			provider:     kmapi.HostingProviderGeneric,
+			distribution: DistributionKind,
+			version:      "v1.31.0",
+		},
+		{
+			name: "kubeadm on aws",
+			facts: ClusterFacts{
+				ServerVersion: &version.Info{GitVersion: "v1.31.0"},
+				Nodes: []core.Node{{
+					ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-0-1", Annotations: map[string]string{"kubeadm.alpha.kubernetes.io/cri-socket": "unix:///run/containerd/containerd.sock"}},
+					Spec:       core.NodeSpec{ProviderID: "aws:///us-east-1a/i-0123"},
+				}},
+				KubeSystemWorkloads: []string{"aws-node", "coredns", "kube-proxy"},
+			},
+			provider:     kmapi.HostingProviderGeneric,
+			distribution: DistributionKubeadm,
+			version:      "v1.31.0",
+		},
+		{
+			name:  "unknown",
+			facts: ClusterFacts{ServerVersion: &version.Info{GitVersion: "v1.31.0"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := DetectHostingProviderFromFacts(context.TODO(), &tt.facts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Provider != tt.provider || info.Distribution != tt.distribution {
+				t.Errorf("expected %s/%s, got %s/%s", tt.provider, tt.distribution, info.Provider, info.Distribution)
+			}
+			if tt.provider != "" && info.ProviderConfidence < MinProviderConfidence {
+				t.Errorf("expected confidence >= %v, got %v: %v", MinProviderConfidence, info.ProviderConfidence, info.Evidence)
+			}
+			if tt.version != "" && info.Version != tt.version {
+				t.Errorf("expected version %s, got %s", tt.version, info.Version)
+			}
+		})
+	}
+}
+
+func TestWeakSignalsBelowMinConfidence(t *testing.T) {
+	info, err := DetectHostingProviderFromFacts(context.TODO(), &ClusterFacts{
+		Nodes: []core.Node{{
+			ObjectMeta: metav1.ObjectMeta{Name: "ip-10-0-0-1"},
+			Spec:       core.NodeSpec{ProviderID: "aws:///us-east-1a/i-0123"},
+		}},
+		KubeSystemWorkloads: []string{"aws-node", "cloud-node-manager"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Provider != kmapi.HostingProviderEKS || info.ProviderConfidence >= MinProviderConfidence {
+		t.Errorf("expected %s with confidence < %v, got %s with %v: %v", kmapi.HostingProviderEKS, MinProviderConfidence, info.Provider, info.ProviderConfidence, info.Evidence)
+	}
+}
+
+func TestRegisterProviderDetector(t *testing.T) {
+	saved := registeredDetectors()
+	defer func() {
+		detectorsMu.Lock()
+		detectors = saved
+		detectorsMu.Unlock()
+	}()
+
+	RegisterProviderDetector(ProviderDetectorFunc{
+		DetectorName: "hetzner",
+		Fn: func(_ context.Context, facts *ClusterFacts) ([]ProviderSignal, error) {
+			for _, n := range facts.Nodes {
+				if n.Labels["instance.hetzner.cloud/provided-by"] != "" {
+					return []ProviderSignal{{Provider: "Hetzner", Weight: 0.8, Evidence: "hetzner node label"}}, nil
+				}
+			}
+			return nil, nil
+		},
+	})
+	info, err := DetectHostingProviderFromFacts(context.TODO(), &ClusterFacts{
+		Nodes: []core.Node{{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"instance.hetzner.cloud/provided-by": "cloud"}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Provider != "Hetzner" {
+		t.Errorf("expected Hetzner, got %s", info.Provider)
+	}
+}
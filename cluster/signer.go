@@ -0,0 +1,451 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	cu "kmodules.xyz/client-go/client"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// SignatureAlgorithmEd25519 is the algorithm of the signatures made by Ed25519Signer.
+	SignatureAlgorithmEd25519 = "ed25519"
+
+	// SigningKeySecretPrivateKey is the key of the active private key in the signing key Secret.
+	SigningKeySecretPrivateKey = "private.pem"
+	// SigningKeySecretPublicKeys is the key of the accepted public keys in the signing key Secret, newest first.
+	SigningKeySecretPublicKeys = "public.pem"
+	// DefaultMaxSigningKeys is the number of public keys kept in the signing key Secret after a rotation.
+	DefaultMaxSigningKeys = 3
+	// DefaultSignatureMaxAge is the age after which VerifiedClusterMetadataFromConfigMap rejects a signature,
+	// unless WithMaxAge is used.
+	DefaultSignatureMaxAge = 30 * 24 * time.Hour
+
+	aceInfoKeySignature = "signature"
+	aceInfoKeyKeyID     = "keyID"
+	aceInfoKeyAlgorithm = "signatureAlgorithm"
+	aceInfoKeySignedAt  = "signedAt"
+
+	pemTypePrivateKey = "PRIVATE KEY"
+	pemTypePublicKey  = "PUBLIC KEY"
+	pemHeaderCreated  = "Created"
+)
+
+// MetadataSigner signs cluster metadata. Implement it to keep the private key in an external signer, e.g., a KMS.
+type MetadataSigner interface {
+	KeyID() string
+	Algorithm() string
+	Sign(ctx context.Context, message []byte) ([]byte, error)
+}
+
+// MetadataVerifier verifies the signature of cluster metadata made by the key with the given id.
+type MetadataVerifier interface {
+	Verify(keyID, algorithm string, message, signature []byte) error
+}
+
+// Ed25519Signer signs cluster metadata with an Ed25519 private key.
+type Ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+var _ MetadataSigner = &Ed25519Signer{}
+
+func NewEd25519Signer(key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{
+		keyID: Ed25519KeyID(key.Public().(ed25519.PublicKey)),
+		key:   key,
+	}
+}
+
+func (s *Ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s *Ed25519Signer) Algorithm() string {
+	return SignatureAlgorithmEd25519
+}
+
+func (s *Ed25519Signer) Sign(_ context.Context, message []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, message), nil
+}
+
+// Ed25519KeyID returns the id of a public key, the hex encoded first 8 bytes of its sha256 sum.
+func Ed25519KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyRing is a MetadataVerifier accepting signatures made by any of its Ed25519 public keys. Keep the
+// previous public keys in the KeyRing after a key rotation, until all the metadata is signed again.
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[string]ed25519.PublicKey
+}
+
+var _ MetadataVerifier = &KeyRing{}
+
+func NewKeyRing(keys ...ed25519.PublicKey) *KeyRing {
+	r := &KeyRing{keys: map[string]ed25519.PublicKey{}}
+	for _, key := range keys {
+		r.Add(key)
+	}
+	return r
+}
+
+func (r *KeyRing) Add(key ed25519.PublicKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.keys[Ed25519KeyID(key)] = key
+}
+
+func (r *KeyRing) Remove(keyID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, keyID)
+}
+
+func (r *KeyRing) Verify(keyID, algorithm string, message, signature []byte) error {
+	if algorithm != SignatureAlgorithmEd25519 {
+		return fmt.Errorf("unsupported signature algorithm %q", algorithm)
+	}
+	r.mu.RLock()
+	key, ok := r.keys[keyID]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("unknown signing key %s", keyID)
+	}
+	if !ed25519.Verify(key, message, signature) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// signedMessage returns the bytes signed for the cluster metadata. The key id and the signing time are
+// included, so that neither can be changed without invalidating the signature.
+func signedMessage(md *kmapi.ClusterMetadata, keyID, signedAt string) ([]byte, error) {
+	return json.Marshal(struct {
+		Metadata *kmapi.ClusterMetadata `json:"metadata"`
+		KeyID    string                 `json:"keyID"`
+		SignedAt string                 `json:"signedAt"`
+	}{md, keyID, signedAt})
+}
+
+// UpsertSignedClusterMetadata is like UpsertClusterMetadata, but the ConfigMap is also signed with the
+// signer along with the signing time. Use VerifiedClusterMetadataFromConfigMap to read it.
+func UpsertSignedClusterMetadata(ctx context.Context, kc client.Client, md *kmapi.ClusterMetadata, signer MetadataSigner) error {
+	// only the fields stored in the ConfigMap are signed, as the readers rebuild the metadata from them
+	md = clusterMetadataFromData(clusterMetadataToData(md))
+	data, err := json.Marshal(md)
+	if err != nil {
+		return err
+	}
+	hasher := hmac.New(sha256.New, []byte(md.UID))
+	hasher.Write(data)
+	messageMAC := hasher.Sum(nil)
+
+	signedAt := time.Now().UTC().Format(time.RFC3339)
+	msg, err := signedMessage(md, signer.KeyID(), signedAt)
+	if err != nil {
+		return err
+	}
+	signature, err := signer.Sign(ctx, msg)
+	if err != nil {
+		return errors.Wrap(err, "failed to sign cluster metadata")
+	}
+
+	obj := core.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      kmapi.AceInfoConfigMapName,
+			Namespace: metav1.NamespacePublic,
+		},
+	}
+	_, err = cu.CreateOrPatch(ctx, kc, &obj, func(o client.Object, createOp bool) client.Object {
+		cm := o.(*core.ConfigMap)
+		cm.Data = clusterMetadataToData(md)
+		cm.Data[aceInfoKeyKeyID] = signer.KeyID()
+		cm.Data[aceInfoKeyAlgorithm] = signer.Algorithm()
+		cm.Data[aceInfoKeySignedAt] = signedAt
+		cm.BinaryData = map[string][]byte{
+			"mac":               messageMAC,
+			aceInfoKeySignature: signature,
+		}
+		return cm
+	})
+	return err
+}
+
+func clusterMetadataToData(md *kmapi.ClusterMetadata) map[string]string {
+	return map[string]string{
+		"uid":                  md.UID,
+		"name":                 md.Name,
+		"displayName":          md.DisplayName,
+		"provider":             string(md.Provider),
+		"ownerID":              md.OwnerID,
+		"ownerType":            md.OwnerType,
+		"apiEndpoint":          md.APIEndpoint,
+		"ca.crt":               md.CABundle,
+		"cloudServiceAuthMode": md.CloudServiceAuthMode,
+	}
+}
+
+func clusterMetadataFromData(data map[string]string) *kmapi.ClusterMetadata {
+	return &kmapi.ClusterMetadata{
+		UID:                  data["uid"],
+		Name:                 data["name"],
+		DisplayName:          data["displayName"],
+		Provider:             kmapi.HostingProvider(data["provider"]),
+		OwnerID:              data["ownerID"],
+		OwnerType:            data["ownerType"],
+		APIEndpoint:          data["apiEndpoint"],
+		CABundle:             data["ca.crt"],
+		CloudServiceAuthMode: data["cloudServiceAuthMode"],
+	}
+}
+
+type verifyOptions struct {
+	maxAge    time.Duration
+	clockSkew time.Duration
+	now       func() time.Time
+}
+
+type VerifyOption func(*verifyOptions)
+
+// WithMaxAge rejects signatures older than d, so that old metadata can not be replayed. The metadata must
+// then be signed again before it gets older than d. A non positive d uses DefaultSignatureMaxAge.
+func WithMaxAge(d time.Duration) VerifyOption {
+	return func(o *verifyOptions) {
+		o.maxAge = d
+	}
+}
+
+// WithClockSkew sets how far in the future a signing time may be. Defaults to 5 minutes.
+func WithClockSkew(d time.Duration) VerifyOption {
+	return func(o *verifyOptions) {
+		o.clockSkew = d
+	}
+}
+
+// VerifiedClusterMetadataFromConfigMap reads the cluster metadata from the ace-info ConfigMap written by
+// UpsertSignedClusterMetadata. Unlike ClusterMetadataFromConfigMap, unsigned ConfigMaps are rejected.
+// Signatures older than DefaultSignatureMaxAge are rejected too, so the metadata must be signed again
+// periodically.
+func VerifiedClusterMetadataFromConfigMap(cm *core.ConfigMap, mode kmapi.ClusterMode, verifier MetadataVerifier, opts ...VerifyOption) (*kmapi.ClusterMetadata, error) {
+	o := verifyOptions{
+		maxAge:    DefaultSignatureMaxAge,
+		clockSkew: 5 * time.Minute,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxAge <= 0 {
+		o.maxAge = DefaultSignatureMaxAge
+	}
+
+	if cm.Name != kmapi.AceInfoConfigMapName || cm.Namespace != metav1.NamespacePublic {
+		return nil, fmt.Errorf("expected configmap %s/%s, found %s/%s", metav1.NamespacePublic, kmapi.AceInfoConfigMapName, cm.Namespace, cm.Name)
+	}
+	signature, ok := cm.BinaryData[aceInfoKeySignature]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s/%s is not signed", cm.Namespace, cm.Name)
+	}
+	keyID := cm.Data[aceInfoKeyKeyID]
+	signedAt := cm.Data[aceInfoKeySignedAt]
+	ts, err := time.Parse(time.RFC3339, signedAt)
+	if err != nil {
+		return nil, fmt.Errorf("configmap %s/%s has invalid signing time %q", cm.Namespace, cm.Name, signedAt)
+	}
+
+	md := clusterMetadataFromData(cm.Data)
+	msg, err := signedMessage(md, keyID, signedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifier.Verify(keyID, cm.Data[aceInfoKeyAlgorithm], msg, signature); err != nil {
+		return nil, errors.Wrapf(err, "configmap %s/%s fails validation", cm.Namespace, cm.Name)
+	}
+
+	now := o.now()
+	if ts.After(now.Add(o.clockSkew)) {
+		return nil, fmt.Errorf("configmap %s/%s is signed in the future at %s", cm.Namespace, cm.Name, signedAt)
+	}
+	if now.Sub(ts) > o.maxAge {
+		return nil, fmt.Errorf("signature of configmap %s/%s made at %s has expired", cm.Namespace, cm.Name, signedAt)
+	}
+
+	if md.Name == "" {
+		md.Name = ClusterName()
+	}
+	md.Mode = mode
+	return md, nil
+}
+
+// LoadOrCreateSigningKey returns a signer for the active private key and a KeyRing of the accepted public
+// keys stored in the Secret. A new key pair is generated and stored if the Secret does not exist.
+func LoadOrCreateSigningKey(ctx context.Context, kc client.Client, key types.NamespacedName) (*Ed25519Signer, *KeyRing, error) {
+	var secret core.Secret
+	err := kc.Get(ctx, key, &secret)
+	if kerr.IsNotFound(err) {
+		return RotateSigningKey(ctx, kc, key, DefaultMaxSigningKeys)
+	} else if err != nil {
+		return nil, nil, err
+	}
+	return signingKeysFromSecret(&secret)
+}
+
+// LoadKeyRing returns a KeyRing of the accepted public keys stored in the signing key Secret.
+func LoadKeyRing(ctx context.Context, kc client.Reader, key types.NamespacedName) (*KeyRing, error) {
+	var secret core.Secret
+	if err := kc.Get(ctx, key, &secret); err != nil {
+		return nil, err
+	}
+	keys, _, err := decodePublicKeys(secret.Data[SigningKeySecretPublicKeys])
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyRing(keys...), nil
+}
+
+// RotateSigningKey generates a new active key pair in the Secret. The previous public keys are still
+// accepted, up to maxKeys public keys in total. Metadata signed with older keys fails verification.
+func RotateSigningKey(ctx context.Context, kc client.Client, key types.NamespacedName, maxKeys int) (*Ed25519Signer, *KeyRing, error) {
+	if maxKeys < 1 {
+		maxKeys = 1
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, nil, err
+	}
+	newPub := pem.EncodeToMemory(&pem.Block{
+		Type:    pemTypePublicKey,
+		Headers: map[string]string{pemHeaderCreated: time.Now().UTC().Format(time.RFC3339)},
+		Bytes:   pubDER,
+	})
+
+	var result core.Secret
+	secret := core.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+	}
+	var transformErr error
+	_, err = cu.CreateOrPatch(ctx, kc, &secret, func(o client.Object, createOp bool) client.Object {
+		s := o.(*core.Secret)
+		_, blocks, err := decodePublicKeys(s.Data[SigningKeySecretPublicKeys])
+		if err != nil {
+			transformErr = err
+			return s
+		}
+		pubs := newPub
+		for i := 0; i < len(blocks) && i < maxKeys-1; i++ {
+			pubs = append(pubs, pem.EncodeToMemory(blocks[i])...)
+		}
+		if s.Data == nil {
+			s.Data = map[string][]byte{}
+		}
+		s.Type = core.SecretTypeOpaque
+		s.Data[SigningKeySecretPrivateKey] = pem.EncodeToMemory(&pem.Block{Type: pemTypePrivateKey, Bytes: privDER})
+		s.Data[SigningKeySecretPublicKeys] = pubs
+		result = *s
+		return s
+	})
+	if err != nil {
+		return nil, nil, err
+	} else if transformErr != nil {
+		return nil, nil, transformErr
+	}
+	return signingKeysFromSecret(&result)
+}
+
+func signingKeysFromSecret(secret *core.Secret) (*Ed25519Signer, *KeyRing, error) {
+	block, _ := pem.Decode(secret.Data[SigningKeySecretPrivateKey])
+	if block == nil || block.Type != pemTypePrivateKey {
+		return nil, nil, fmt.Errorf("secret %s/%s has no private key", secret.Namespace, secret.Name)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("secret %s/%s does not hold an ed25519 private key", secret.Namespace, secret.Name)
+	}
+
+	pubs, _, err := decodePublicKeys(secret.Data[SigningKeySecretPublicKeys])
+	if err != nil {
+		return nil, nil, err
+	}
+	ring := NewKeyRing(pubs...)
+	// the active key is always accepted
+	ring.Add(priv.Public().(ed25519.PublicKey))
+	return NewEd25519Signer(priv), ring, nil
+}
+
+func decodePublicKeys(data []byte) ([]ed25519.PublicKey, []*pem.Block, error) {
+	var keys []ed25519.PublicKey
+	var blocks []*pem.Block
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return keys, blocks, nil
+		}
+		if block.Type != pemTypePublicKey {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, nil, errors.New("public key is not an ed25519 key")
+		}
+		keys = append(keys, pub)
+		blocks = append(blocks, block)
+	}
+}
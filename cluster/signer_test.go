@@ -0,0 +1,144 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSignedClusterMetadata(t *testing.T) {
+	ctx := context.TODO()
+	kc := fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).Build()
+	key := types.NamespacedName{Namespace: metav1.NamespaceSystem, Name: "ace-info-signing-key"}
+
+	signer, ring, err := LoadOrCreateSigningKey(ctx, kc, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := &kmapi.ClusterMetadata{
+		UID:      "0b7bd9a4-1e3b-4a8f-9c1a-3f4c7d2e8a10",
+		Name:     "prod",
+		Provider: kmapi.HostingProviderEKS,
+		OwnerID:  "42",
+		// not stored in the ConfigMap
+		ManagerID:    "7",
+		HubClusterID: "hub",
+		Mode:         kmapi.ClusterModeDev,
+	}
+	if err := UpsertSignedClusterMetadata(ctx, kc, md, signer); err != nil {
+		t.Fatal(err)
+	}
+	cm := getAceInfo(t, kc)
+
+	got, err := VerifiedClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, ring, WithMaxAge(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UID != md.UID || got.OwnerID != md.OwnerID || got.Mode != kmapi.ClusterModeProd {
+		t.Errorf("unexpected metadata %+v", got)
+	}
+	// readers of the legacy hmac still work
+	if _, err := ClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, md.UID); err != nil { // nolint:staticcheck
+		t.Errorf("legacy verification failed: %v", err)
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		in := cm.DeepCopy()
+		in.Data["ownerID"] = "43"
+		if _, err := VerifiedClusterMetadataFromConfigMap(in, kmapi.ClusterModeProd, ring); err == nil {
+			t.Error("expected tampered metadata to fail verification")
+		}
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		in := cm.DeepCopy()
+		delete(in.BinaryData, aceInfoKeySignature)
+		if _, err := VerifiedClusterMetadataFromConfigMap(in, kmapi.ClusterModeProd, ring); err == nil {
+			t.Error("expected unsigned metadata to fail verification")
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		later := func(o *verifyOptions) {
+			o.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+		}
+		if _, err := VerifiedClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, ring, WithMaxAge(time.Hour), later); err == nil {
+			t.Error("expected replayed metadata to fail verification")
+		}
+	})
+
+	t.Run("default max age", func(t *testing.T) {
+		later := func(o *verifyOptions) {
+			o.now = func() time.Time { return time.Now().Add(DefaultSignatureMaxAge + time.Hour) }
+		}
+		if _, err := VerifiedClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, ring, later); err == nil {
+			t.Error("expected metadata older than the default max age to fail verification")
+		}
+		if _, err := VerifiedClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, ring, WithMaxAge(0), later); err == nil {
+			t.Error("expected a zero max age to use the default max age")
+		}
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		next, nextRing, err := RotateSigningKey(ctx, kc, key, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.KeyID() == signer.KeyID() {
+			t.Fatal("expected a new signing key")
+		}
+		// metadata signed with the previous key is still accepted
+		if _, err := VerifiedClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, nextRing); err != nil {
+			t.Errorf("previous key rejected after rotation: %v", err)
+		}
+
+		if _, _, err := RotateSigningKey(ctx, kc, key, 2); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadKeyRing(ctx, kc, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifiedClusterMetadataFromConfigMap(cm, kmapi.ClusterModeProd, loaded); err == nil {
+			t.Error("expected key older than the rotation window to be rejected")
+		}
+		if err := UpsertSignedClusterMetadata(ctx, kc, md, next); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifiedClusterMetadataFromConfigMap(getAceInfo(t, kc), kmapi.ClusterModeProd, loaded); err != nil {
+			t.Errorf("previous key rejected after second rotation: %v", err)
+		}
+	})
+}
+
+func getAceInfo(t *testing.T, kc client.Reader) *core.ConfigMap {
+	t.Helper()
+	var cm core.ConfigMap
+	if err := kc.Get(context.TODO(), types.NamespacedName{Namespace: metav1.NamespacePublic, Name: kmapi.AceInfoConfigMapName}, &cm); err != nil {
+		t.Fatal(err)
+	}
+	return &cm
+}
@@ -0,0 +1,262 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// HistoryAnnotationKey is the annotation used to store the condition history of objects
+	// that do not have a status field for it.
+	HistoryAnnotationKey = "kmodules.xyz/condition-history"
+
+	// DefaultHistoryLimit is the number of transitions kept per condition type.
+	DefaultHistoryLimit = 10
+)
+
+// HistoryGetter interface defines methods that an object should implement to expose
+// the past transitions of its conditions, usually stored in a status sub-field.
+type HistoryGetter interface {
+	GetConditionHistory() kmapi.Conditions
+}
+
+// HistorySetter interface defines methods that an object should implement to opt in to
+// recording condition transitions. Set records every transition automatically for such objects.
+type HistorySetter interface {
+	HistoryGetter
+	SetConditionHistory(kmapi.Conditions)
+}
+
+// HistoryLimiter can be implemented by a HistorySetter to override DefaultHistoryLimit.
+type HistoryLimiter interface {
+	ConditionHistoryLimit() int
+}
+
+// TransitionHook is called by Set after a condition of the object transitioned to a new state.
+// previous is nil when the condition did not exist before.
+type TransitionHook func(obj Setter, previous, current *kmapi.Condition)
+
+type hookEntry struct {
+	hook TransitionHook
+}
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []*hookEntry
+)
+
+// AddTransitionHook registers a hook that is called on every condition transition made via Set.
+// The returned func removes the hook; calling it more than once is a no-op.
+func AddTransitionHook(hook TransitionHook) (remove func()) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	e := &hookEntry{hook: hook}
+	hooks = append(hooks, e)
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		hooks = slices.DeleteFunc(hooks, func(x *hookEntry) bool { return x == e })
+	}
+}
+
+// ResetTransitionHooks removes all the registered transition hooks.
+func ResetTransitionHooks() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = nil
+}
+
+func recordTransition(to Setter, previous, current *kmapi.Condition) {
+	if h, ok := to.(HistorySetter); ok {
+		limit := DefaultHistoryLimit
+		if l, ok := to.(HistoryLimiter); ok {
+			limit = l.ConditionHistoryLimit()
+		}
+		h.SetConditionHistory(AppendHistory(h.GetConditionHistory(), *current, limit))
+	}
+
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, e := range hooks {
+		e.hook(to, previous, current)
+	}
+}
+
+// AppendHistory appends a transition to the history, keeping at most limit entries per condition type.
+// The oldest entries of the same type are dropped first. The result is sorted by type and then by time.
+func AppendHistory(history kmapi.Conditions, c kmapi.Condition, limit int) kmapi.Conditions {
+	out := append(history.DeepCopy(), c)
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Type != out[j].Type {
+			return out[i].Type < out[j].Type
+		}
+		return out[i].LastTransitionTime.Before(&out[j].LastTransitionTime)
+	})
+	if limit <= 0 {
+		return out
+	}
+
+	count := map[kmapi.ConditionType]int{}
+	for _, h := range out {
+		count[h.Type]++
+	}
+	trimmed := make(kmapi.Conditions, 0, len(out))
+	for _, h := range out {
+		if count[h.Type] > limit {
+			count[h.Type]--
+			continue
+		}
+		trimmed = append(trimmed, h)
+	}
+	return trimmed
+}
+
+// AnnotationHistoryHook returns a TransitionHook that stores the condition history in the
+// HistoryAnnotationKey annotation of the object, keeping at most limit transitions per type.
+// Use it for objects which do not implement HistorySetter.
+//
+// NOTE: The hook changes the metadata of the object, not its status. Callers that only update the status
+// subresource lose the history; they must also patch the metadata, eg, via a separate Patch call.
+func AnnotationHistoryHook(limit int) TransitionHook {
+	return func(obj Setter, _, current *kmapi.Condition) {
+		if _, ok := obj.(HistorySetter); ok {
+			return
+		}
+		history, err := historyFromAnnotation(obj)
+		if err != nil {
+			klog.Warningf("failed to decode condition history of %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+		}
+		data, err := json.Marshal(AppendHistory(history, *current, limit))
+		if err != nil {
+			klog.Warningf("failed to encode condition history of %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+			return
+		}
+		annotations := obj.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		annotations[HistoryAnnotationKey] = string(data)
+		obj.SetAnnotations(annotations)
+	}
+}
+
+func historyFromAnnotation(obj metav1.Object) (kmapi.Conditions, error) {
+	data, ok := obj.GetAnnotations()[HistoryAnnotationKey]
+	if !ok || data == "" {
+		return nil, nil
+	}
+	var history kmapi.Conditions
+	if err := json.Unmarshal([]byte(data), &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// EventHook returns a TransitionHook that emits an Event for every condition transition.
+// Transitions to False with Error or Warning severity are reported as Warning events.
+func EventHook(recorder record.EventRecorder) TransitionHook {
+	return func(obj Setter, previous, current *kmapi.Condition) {
+		eventType := core.EventTypeNormal
+		if current.Status == metav1.ConditionFalse &&
+			(current.Severity == kmapi.ConditionSeverityError || current.Severity == kmapi.ConditionSeverityWarning) {
+			eventType = core.EventTypeWarning
+		}
+		reason := current.Reason
+		if reason == "" {
+			reason = string(current.Type)
+		}
+		from := metav1.ConditionStatus("None")
+		if previous != nil {
+			from = previous.Status
+		}
+		msg := fmt.Sprintf("Condition %s changed from %s to %s", current.Type, from, current.Status)
+		if current.Message != "" {
+			msg += ": " + current.Message
+		}
+		recorder.Event(obj, eventType, reason, msg)
+	}
+}
+
+// GetHistory returns the recorded transitions of the given condition type, oldest first.
+// The history is read from the status sub-field of a HistoryGetter, or from the HistoryAnnotationKey annotation.
+func GetHistory(from Getter, t kmapi.ConditionType) kmapi.Conditions {
+	var history kmapi.Conditions
+	if h, ok := from.(HistoryGetter); ok {
+		history = h.GetConditionHistory()
+	} else {
+		var err error
+		if history, err = historyFromAnnotation(from); err != nil {
+			klog.Warningf("failed to decode condition history of %s/%s: %v", from.GetNamespace(), from.GetName(), err)
+			return nil
+		}
+	}
+
+	out := make(kmapi.Conditions, 0, len(history))
+	for _, c := range history {
+		if c.Type == t {
+			out = append(out, c)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].LastTransitionTime.Before(&out[j].LastTransitionTime)
+	})
+	return out
+}
+
+// TimeInState returns how long the condition with the given type has been in its current state.
+// It returns 0 if the condition does not exist.
+func TimeInState(from Getter, t kmapi.ConditionType, now time.Time) time.Duration {
+	c := Get(from, t)
+	if c == nil || c.LastTransitionTime.IsZero() {
+		return 0
+	}
+	return now.Sub(c.LastTransitionTime.Time)
+}
+
+// TransitionsSince returns the number of recorded transitions of the given condition type
+// to the given status since the given time. An empty status counts every transition.
+func TransitionsSince(from Getter, t kmapi.ConditionType, status metav1.ConditionStatus, since time.Time) int {
+	n := 0
+	for _, c := range GetHistory(from, t) {
+		if c.LastTransitionTime.Time.Before(since) {
+			continue
+		}
+		if status == "" || c.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// IsFlapping returns true if the condition with the given type transitioned at least threshold times
+// within the window ending at now.
+func IsFlapping(from Getter, t kmapi.ConditionType, window time.Duration, threshold int, now time.Time) bool {
+	return TransitionsSince(from, t, "", now.Add(-window)) >= threshold
+}
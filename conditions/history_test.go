@@ -0,0 +1,158 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+type conditionedWithHistory struct {
+	*conditioned
+	history kmapi.Conditions
+}
+
+func (c *conditionedWithHistory) GetConditionHistory() kmapi.Conditions {
+	return c.history
+}
+
+func (c *conditionedWithHistory) SetConditionHistory(history kmapi.Conditions) {
+	c.history = history
+}
+
+func (c *conditionedWithHistory) ConditionHistoryLimit() int {
+	return 3
+}
+
+var _ HistorySetter = &conditionedWithHistory{}
+
+func TestSetRecordsHistory(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := &conditionedWithHistory{conditioned: newConditioned("test")}
+	MarkTrue(obj, kmapi.ReadyCondition)
+	MarkTrue(obj, kmapi.ReadyCondition) // no transition
+	MarkFalse(obj, kmapi.ReadyCondition, "DatabaseDown", kmapi.ConditionSeverityError, "primary is not reachable")
+	MarkTrue(obj, kmapi.ReadyCondition)
+	MarkFalse(obj, kmapi.ReadyCondition, "DatabaseDown", kmapi.ConditionSeverityError, "primary is not reachable")
+	MarkTrue(obj, "Provisioned")
+
+	history := GetHistory(obj, kmapi.ReadyCondition)
+	g.Expect(history).To(HaveLen(3))
+	g.Expect(history[0].Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(history[1].Status).To(Equal(metav1.ConditionTrue))
+	g.Expect(history[2].Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(GetHistory(obj, "Provisioned")).To(HaveLen(1))
+
+	now := time.Now()
+	g.Expect(TransitionsSince(obj, kmapi.ReadyCondition, metav1.ConditionFalse, now.Add(-time.Hour))).To(Equal(2))
+	g.Expect(IsFlapping(obj, kmapi.ReadyCondition, time.Hour, 3, now)).To(BeTrue())
+	g.Expect(IsFlapping(obj, "Provisioned", time.Hour, 3, now)).To(BeFalse())
+	g.Expect(TimeInState(obj, kmapi.ReadyCondition, now.Add(time.Minute))).To(BeNumerically(">=", time.Minute))
+}
+
+func TestSetSkipsMessageOnlyUpdates(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := &conditionedWithHistory{conditioned: newConditioned("test")}
+	MarkFalse(obj, kmapi.ReadyCondition, "Scaling", kmapi.ConditionSeverityInfo, "3/5 ready")
+	MarkFalse(obj, kmapi.ReadyCondition, "Scaling", kmapi.ConditionSeverityInfo, "4/5 ready")
+	MarkFalse(obj, kmapi.ReadyCondition, "Scaling", kmapi.ConditionSeverityInfo, "5/5 ready")
+
+	g.Expect(GetHistory(obj, kmapi.ReadyCondition)).To(HaveLen(1))
+	g.Expect(Get(obj, kmapi.ReadyCondition).Message).To(Equal("5/5 ready"))
+
+	MarkFalse(obj, kmapi.ReadyCondition, "Scaling", kmapi.ConditionSeverityWarning, "5/5 ready")
+	g.Expect(GetHistory(obj, kmapi.ReadyCondition)).To(HaveLen(2))
+}
+
+func TestTimeInStateIgnoresMessageOnlyUpdates(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := newConditioned("test")
+	MarkFalse(obj, kmapi.ReadyCondition, "Scaling", kmapi.ConditionSeverityInfo, "3/5 ready")
+	since := metav1.NewTime(time.Now().Add(-time.Hour).UTC().Truncate(time.Second))
+	c := Get(obj, kmapi.ReadyCondition)
+	c.LastTransitionTime = since
+	obj.SetConditions(kmapi.Conditions{*c})
+
+	MarkFalse(obj, kmapi.ReadyCondition, "Scaling", kmapi.ConditionSeverityInfo, "4/5 ready")
+	g.Expect(Get(obj, kmapi.ReadyCondition).Message).To(Equal("4/5 ready"))
+	g.Expect(Get(obj, kmapi.ReadyCondition).LastTransitionTime).To(Equal(since))
+	g.Expect(TimeInState(obj, kmapi.ReadyCondition, time.Now())).To(BeNumerically(">=", time.Hour))
+}
+
+func TestAnnotationHistoryAndEventHooks(t *testing.T) {
+	g := NewWithT(t)
+	defer ResetTransitionHooks()
+
+	recorder := record.NewFakeRecorder(10)
+	AddTransitionHook(AnnotationHistoryHook(DefaultHistoryLimit))
+	AddTransitionHook(EventHook(recorder))
+
+	obj := newConditioned("test")
+	MarkTrue(obj, kmapi.ReadyCondition)
+	MarkFalse(obj, kmapi.ReadyCondition, "DatabaseDown", kmapi.ConditionSeverityError, "primary is not reachable")
+
+	g.Expect(obj.GetAnnotations()).To(HaveKey(HistoryAnnotationKey))
+	g.Expect(GetHistory(obj, kmapi.ReadyCondition)).To(HaveLen(2))
+
+	g.Expect(recorder.Events).To(HaveLen(2))
+	e1 := <-recorder.Events
+	g.Expect(strings.HasPrefix(e1, "Normal Ready Condition Ready changed from None to True")).To(BeTrue(), e1)
+	e2 := <-recorder.Events
+	g.Expect(strings.HasPrefix(e2, "Warning DatabaseDown Condition Ready changed from True to False")).To(BeTrue(), e2)
+}
+
+func TestRemoveTransitionHook(t *testing.T) {
+	g := NewWithT(t)
+	defer ResetTransitionHooks()
+
+	recorder := record.NewFakeRecorder(10)
+	remove := AddTransitionHook(EventHook(recorder))
+
+	obj := newConditioned("test")
+	MarkTrue(obj, kmapi.ReadyCondition)
+	remove()
+	remove()
+	MarkFalse(obj, kmapi.ReadyCondition, "DatabaseDown", kmapi.ConditionSeverityError, "primary is not reachable")
+
+	g.Expect(recorder.Events).To(HaveLen(1))
+}
+
+func TestAppendHistoryLimit(t *testing.T) {
+	g := NewWithT(t)
+
+	var history kmapi.Conditions
+	for i := 0; i < 5; i++ {
+		c := TrueCondition("A")
+		c.LastTransitionTime = metav1.NewTime(time.Unix(int64(i), 0))
+		history = AppendHistory(history, *c, 2)
+	}
+	history = AppendHistory(history, *TrueCondition("B"), 2)
+	g.Expect(history).To(HaveLen(3))
+	g.Expect(history[0].LastTransitionTime.Unix()).To(Equal(int64(3)))
+	g.Expect(history[1].LastTransitionTime.Unix()).To(Equal(int64(4)))
+	g.Expect(history[2].Type).To(Equal(kmapi.ConditionType("B")))
+}
@@ -0,0 +1,345 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+// ReasonSpec declares a Reason allowed for a condition type.
+type ReasonSpec struct {
+	Reason string
+	// Severity is the default severity used when the condition is marked False with this reason.
+	Severity kmapi.ConditionSeverity
+	// MessageFormat is the fmt format used to build the condition message.
+	MessageFormat string
+	Description   string
+}
+
+// TypeSpec declares a condition type and the reasons it can be set with.
+type TypeSpec struct {
+	Type        kmapi.ConditionType
+	Description string
+	Reasons     []ReasonSpec
+}
+
+// Registry is a catalogue of the condition types and reasons used by an operator.
+type Registry struct {
+	mu     sync.RWMutex
+	types  map[kmapi.ConditionType]TypeSpec
+	strict bool
+}
+
+// NewRegistry returns a Registry with the given types.
+func NewRegistry(specs ...TypeSpec) (*Registry, error) {
+	r := &Registry{types: map[kmapi.ConditionType]TypeSpec{}}
+	if err := r.Register(specs...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MustNewRegistry is like NewRegistry but panics on error.
+func MustNewRegistry(specs ...TypeSpec) *Registry {
+	r, err := NewRegistry(specs...)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Strict makes the package level MarkTrue, MarkFalse and MarkUnknown panic on conditions that are not
+// valid for the registry, when it is set via UseRegistry. Use it in tests, so that unregistered types and
+// reasons are caught before they are released.
+func (r *Registry) Strict() *Registry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.strict = true
+	return r
+}
+
+// Register adds condition types to the registry. Registering a type twice or a duplicate reason is an error.
+func (r *Registry) Register(specs ...TypeSpec) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, s := range specs {
+		if s.Type == "" {
+			return fmt.Errorf("condition type can't be empty")
+		}
+		if _, ok := r.types[s.Type]; ok {
+			return fmt.Errorf("condition type %s is already registered", s.Type)
+		}
+		seen := map[string]bool{}
+		for _, rs := range s.Reasons {
+			if rs.Reason == "" {
+				return fmt.Errorf("condition type %s has a reason with empty name", s.Type)
+			}
+			if strings.Contains(rs.Reason, "@") {
+				return fmt.Errorf("reason %s of condition type %s must not contain @", rs.Reason, s.Type)
+			}
+			if seen[rs.Reason] {
+				return fmt.Errorf("reason %s is registered twice for condition type %s", rs.Reason, s.Type)
+			}
+			seen[rs.Reason] = true
+		}
+		r.types[s.Type] = s
+	}
+	return nil
+}
+
+// Types returns the registered condition types sorted by name.
+func (r *Registry) Types() []TypeSpec {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]TypeSpec, 0, len(r.types))
+	for _, s := range r.types {
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Type < out[j].Type
+	})
+	return out
+}
+
+// Reason returns the spec of the reason for the given condition type.
+func (r *Registry) Reason(t kmapi.ConditionType, reason string) (ReasonSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.types[t]
+	if !ok {
+		return ReasonSpec{}, false
+	}
+	reason, _, _ = ParseLocalizedReason(reason)
+	for _, rs := range s.Reasons {
+		if rs.Reason == reason {
+			return rs, true
+		}
+	}
+	return ReasonSpec{}, false
+}
+
+// Validate checks that the condition type is registered and, for non True conditions,
+// that the reason is allowed for the type. Localized reasons are validated by their base reason.
+func (r *Registry) Validate(c *kmapi.Condition) error {
+	r.mu.RLock()
+	_, ok := r.types[c.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("condition type %s is not registered", c.Type)
+	}
+	if c.Status == metav1.ConditionTrue && c.Reason == "" {
+		return nil
+	}
+	if _, ok := r.Reason(c.Type, c.Reason); !ok {
+		return fmt.Errorf("reason %q is not registered for condition type %s", c.Reason, c.Type)
+	}
+	return nil
+}
+
+// FalseCondition returns a condition with Status=False using the registered severity and message format.
+func (r *Registry) FalseCondition(t kmapi.ConditionType, reason string, messageArgs ...any) (*kmapi.Condition, error) {
+	rs, ok := r.Reason(t, reason)
+	if !ok {
+		return nil, fmt.Errorf("reason %q is not registered for condition type %s", reason, t)
+	}
+	return FalseCondition(t, reason, rs.Severity, rs.MessageFormat, messageArgs...), nil
+}
+
+// UnknownCondition returns a condition with Status=Unknown using the registered message format.
+func (r *Registry) UnknownCondition(t kmapi.ConditionType, reason string, messageArgs ...any) (*kmapi.Condition, error) {
+	rs, ok := r.Reason(t, reason)
+	if !ok {
+		return nil, fmt.Errorf("reason %q is not registered for condition type %s", reason, t)
+	}
+	return UnknownCondition(t, reason, rs.MessageFormat, messageArgs...), nil
+}
+
+// MarkTrue sets Status=True for a registered condition type.
+func (r *Registry) MarkTrue(to Setter, t kmapi.ConditionType) error {
+	c := TrueCondition(t)
+	if err := r.Validate(c); err != nil {
+		return err
+	}
+	Set(to, c)
+	return nil
+}
+
+// MarkFalse sets Status=False for a registered condition type and reason.
+func (r *Registry) MarkFalse(to Setter, t kmapi.ConditionType, reason string, messageArgs ...any) error {
+	c, err := r.FalseCondition(t, reason, messageArgs...)
+	if err != nil {
+		return err
+	}
+	Set(to, c)
+	return nil
+}
+
+// MarkUnknown sets Status=Unknown for a registered condition type and reason.
+func (r *Registry) MarkUnknown(to Setter, t kmapi.ConditionType, reason string, messageArgs ...any) error {
+	c, err := r.UnknownCondition(t, reason, messageArgs...)
+	if err != nil {
+		return err
+	}
+	Set(to, c)
+	return nil
+}
+
+// OpenAPIEnums returns the enum values of the condition types and of all the registered reasons.
+func (r *Registry) OpenAPIEnums() (types []any, reasons []any) {
+	reasonSet := map[string]bool{}
+	for _, s := range r.Types() {
+		types = append(types, string(s.Type))
+		for _, rs := range s.Reasons {
+			reasonSet[rs.Reason] = true
+		}
+	}
+	names := make([]string, 0, len(reasonSet))
+	for reason := range reasonSet {
+		names = append(names, reason)
+	}
+	sort.Strings(names)
+	for _, reason := range names {
+		reasons = append(reasons, reason)
+	}
+	return types, reasons
+}
+
+// OpenAPISchema returns the schema of a kmapi.Condition with the type and the reason restricted to the
+// registered values. An empty reason is allowed for True conditions.
+//
+// NOTE: Localized reasons of conditions computed by merge operations, eg, SetSummary, do not match the enum.
+// Do not use the schema for status fields that store such conditions.
+func (r *Registry) OpenAPISchema() spec.Schema {
+	types, reasons := r.OpenAPIEnums()
+	reasonDesc := "The reason for the condition's last transition. One of: "
+	for i, reason := range reasons {
+		if i > 0 {
+			reasonDesc += ", "
+		}
+		reasonDesc += reason.(string)
+	}
+	reasonEnum := append([]any{""}, reasons...)
+	return spec.Schema{
+		SchemaProps: spec.SchemaProps{
+			Type:     []string{"object"},
+			Required: []string{"type", "status", "lastTransitionTime"},
+			Properties: map[string]spec.Schema{
+				"type": {
+					SchemaProps: spec.SchemaProps{Type: []string{"string"}, Enum: types},
+				},
+				"status": {
+					SchemaProps: spec.SchemaProps{Type: []string{"string"}, Enum: []any{"True", "False", "Unknown"}},
+				},
+				"observedGeneration": {
+					SchemaProps: spec.SchemaProps{Type: []string{"integer"}, Format: "int64"},
+				},
+				"severity": {
+					SchemaProps: spec.SchemaProps{Type: []string{"string"}, Enum: []any{"Error", "Warning", "Info", ""}},
+				},
+				"lastTransitionTime": {
+					SchemaProps: spec.SchemaProps{Type: []string{"string"}, Format: "date-time"},
+				},
+				"reason": {
+					SchemaProps: spec.SchemaProps{Type: []string{"string"}, Description: reasonDesc, Enum: reasonEnum},
+				},
+				"message": {
+					SchemaProps: spec.SchemaProps{Type: []string{"string"}},
+				},
+			},
+		},
+	}
+}
+
+// Markdown renders the catalogue as a markdown document.
+func (r *Registry) Markdown() string {
+	var sb strings.Builder
+	for _, s := range r.Types() {
+		_, _ = fmt.Fprintf(&sb, "## %s\n\n", s.Type)
+		if s.Description != "" {
+			_, _ = fmt.Fprintf(&sb, "%s\n\n", s.Description)
+		}
+		if len(s.Reasons) == 0 {
+			continue
+		}
+		sb.WriteString("| Reason | Severity | Description |\n")
+		sb.WriteString("|--------|----------|-------------|\n")
+		for _, rs := range s.Reasons {
+			severity := string(rs.Severity)
+			if severity == "" {
+				severity = "-"
+			}
+			_, _ = fmt.Fprintf(&sb, "| %s | %s | %s |\n", rs.Reason, severity, strings.ReplaceAll(rs.Description, "|", `\|`))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+var (
+	defaultRegistryMu sync.RWMutex
+	defaultRegistry   *Registry
+)
+
+// UseRegistry sets the registry used by MarkTrue, MarkFalse and MarkUnknown to validate conditions.
+// Violations are logged, since these functions can't return an error, or panic for a Strict registry.
+// Pass nil to disable validation.
+func UseRegistry(r *Registry) {
+	defaultRegistryMu.Lock()
+	defer defaultRegistryMu.Unlock()
+	defaultRegistry = r
+}
+
+func validateWithDefaultRegistry(c *kmapi.Condition) {
+	defaultRegistryMu.RLock()
+	r := defaultRegistry
+	defaultRegistryMu.RUnlock()
+	if r == nil {
+		return
+	}
+	if err := r.Validate(c); err != nil {
+		r.mu.RLock()
+		strict := r.strict
+		r.mu.RUnlock()
+		if strict {
+			panic(fmt.Sprintf("invalid condition: %v", err))
+		}
+		klog.Warningf("invalid condition: %v", err)
+	}
+}
+
+// ParseLocalizedReason splits a reason localized by merge operations, eg, "Failed @ Deployment/foo",
+// into the original reason and the kind and name of the object it originated from.
+func ParseLocalizedReason(reason string) (base string, kind string, name string) {
+	before, after, found := strings.Cut(reason, " @ ")
+	if !found {
+		return reason, "", ""
+	}
+	kind, name, _ = strings.Cut(after, "/")
+	return before, kind, name
+}
@@ -0,0 +1,130 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package conditions
+
+import (
+	"testing"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testRegistry() *Registry {
+	return MustNewRegistry(
+		TypeSpec{
+			Type:        kmapi.ReadyCondition,
+			Description: "Database is ready to accept connections.",
+			Reasons: []ReasonSpec{
+				{Reason: "DatabaseDown", Severity: kmapi.ConditionSeverityError, MessageFormat: "database %s is not reachable", Description: "Primary is not reachable."},
+				{Reason: "Provisioning", Severity: kmapi.ConditionSeverityInfo, MessageFormat: "provisioning %d replicas"},
+			},
+		},
+		TypeSpec{
+			Type: "Paused",
+		},
+	)
+}
+
+func TestRegistryRegister(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewRegistry(TypeSpec{Type: "A"}, TypeSpec{Type: "A"})
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = NewRegistry(TypeSpec{Type: "A", Reasons: []ReasonSpec{{Reason: "X"}, {Reason: "X"}}})
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = NewRegistry(TypeSpec{Type: "A", Reasons: []ReasonSpec{{Reason: "X @ Foo/bar"}}})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestRegistryMark(t *testing.T) {
+	g := NewWithT(t)
+	r := testRegistry()
+
+	obj := newConditioned("test")
+	g.Expect(r.MarkFalse(obj, kmapi.ReadyCondition, "DatabaseDown", "pg-0")).To(Succeed())
+	c := Get(obj, kmapi.ReadyCondition)
+	g.Expect(c.Status).To(Equal(metav1.ConditionFalse))
+	g.Expect(c.Severity).To(Equal(kmapi.ConditionSeverityError))
+	g.Expect(c.Message).To(Equal("database pg-0 is not reachable"))
+
+	g.Expect(r.MarkUnknown(obj, kmapi.ReadyCondition, "Provisioning", 3)).To(Succeed())
+	g.Expect(GetMessage(obj, kmapi.ReadyCondition)).To(Equal("provisioning 3 replicas"))
+
+	g.Expect(r.MarkFalse(obj, kmapi.ReadyCondition, "SomethingElse")).NotTo(Succeed())
+	g.Expect(r.MarkTrue(obj, "NotRegistered")).NotTo(Succeed())
+	g.Expect(r.MarkTrue(obj, "Paused")).To(Succeed())
+}
+
+func TestRegistryValidate(t *testing.T) {
+	g := NewWithT(t)
+	r := testRegistry()
+
+	g.Expect(r.Validate(TrueCondition(kmapi.ReadyCondition))).To(Succeed())
+	g.Expect(r.Validate(FalseCondition(kmapi.ReadyCondition, "DatabaseDown @ Postgres/pg", kmapi.ConditionSeverityError, ""))).To(Succeed())
+	g.Expect(r.Validate(FalseCondition(kmapi.ReadyCondition, "Unknown", kmapi.ConditionSeverityError, ""))).NotTo(Succeed())
+}
+
+func TestRegistryExport(t *testing.T) {
+	g := NewWithT(t)
+	r := testRegistry()
+
+	types, reasons := r.OpenAPIEnums()
+	g.Expect(types).To(Equal([]any{"Paused", "Ready"}))
+	g.Expect(reasons).To(Equal([]any{"DatabaseDown", "Provisioning"}))
+
+	schema := r.OpenAPISchema()
+	g.Expect(schema.Properties["type"].Enum).To(Equal(types))
+	g.Expect(schema.Properties["reason"].Enum).To(Equal([]any{"", "DatabaseDown", "Provisioning"}))
+
+	md := r.Markdown()
+	g.Expect(md).To(ContainSubstring("## Ready"))
+	g.Expect(md).To(ContainSubstring("| DatabaseDown | Error | Primary is not reachable. |"))
+}
+
+func TestParseLocalizedReason(t *testing.T) {
+	g := NewWithT(t)
+
+	reason, kind, name := ParseLocalizedReason("DatabaseDown @ Postgres/pg")
+	g.Expect(reason).To(Equal("DatabaseDown"))
+	g.Expect(kind).To(Equal("Postgres"))
+	g.Expect(name).To(Equal("pg"))
+
+	reason, kind, name = ParseLocalizedReason("DatabaseDown")
+	g.Expect(reason).To(Equal("DatabaseDown"))
+	g.Expect(kind).To(BeEmpty())
+	g.Expect(name).To(BeEmpty())
+}
+
+func TestStrictRegistry(t *testing.T) {
+	g := NewWithT(t)
+	defer UseRegistry(nil)
+
+	obj := newConditioned("test")
+	UseRegistry(testRegistry())
+	g.Expect(func() { MarkFalse(obj, kmapi.ReadyCondition, "SomethingElse", kmapi.ConditionSeverityError, "") }).NotTo(Panic())
+
+	UseRegistry(testRegistry().Strict())
+	g.Expect(func() { MarkFalse(obj, kmapi.ReadyCondition, "DatabaseDown", kmapi.ConditionSeverityError, "") }).NotTo(Panic())
+	g.Expect(func() { MarkFalse(obj, kmapi.ReadyCondition, "SomethingElse", kmapi.ConditionSeverityError, "") }).To(Panic())
+	g.Expect(func() { MarkUnknown(obj, kmapi.ReadyCondition, "SomethingElse", "") }).To(Panic())
+	g.Expect(func() { MarkTrue(obj, "NotRegistered") }).To(Panic())
+	g.Expect(func() { MarkTrue(obj, "Paused") }).NotTo(Panic())
+}
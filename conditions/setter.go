@@ -35,8 +35,10 @@ type Setter interface {
 
 // Set sets the given condition.
 //
-// NOTE: If a condition already exists, the LastTransitionTime is updated only if a change is detected
-// in any of the following fields: Status, Reason, Severity and Message.
+// NOTE: If a condition already exists, the LastTransitionTime is updated only on a transition, i.e., a change
+// in any of the following fields: Status, Reason and Severity. Transitions are recorded in the condition history
+// of objects implementing HistorySetter and passed to the registered TransitionHooks. Message only updates
+// change the message and keep the LastTransitionTime.
 func Set(to Setter, condition *kmapi.Condition) {
 	if to == nil || condition == nil {
 		return
@@ -49,12 +51,20 @@ func Set(to Setter, condition *kmapi.Condition) {
 	// transition (otherwise we should preserve the current last transition time)-
 	conditions := to.GetConditions()
 	exists := false
+	var previous *kmapi.Condition
+	transitioned := false
 	for i := range conditions {
 		existingCondition := conditions[i]
 		if existingCondition.Type == condition.Type {
 			exists = true
 			if !hasSameState(&existingCondition, condition) {
-				condition.LastTransitionTime = metav1.NewTime(time.Now().UTC().Truncate(time.Second))
+				transitioned = isTransition(&existingCondition, condition)
+				if transitioned {
+					condition.LastTransitionTime = metav1.NewTime(time.Now().UTC().Truncate(time.Second))
+					previous = &existingCondition
+				} else {
+					condition.LastTransitionTime = existingCondition.LastTransitionTime
+				}
 				conditions[i] = *condition
 				break
 			}
@@ -69,6 +79,7 @@ func Set(to Setter, condition *kmapi.Condition) {
 			condition.LastTransitionTime = metav1.NewTime(time.Now().UTC().Truncate(time.Second))
 		}
 		conditions = append(conditions, *condition)
+		transitioned = true
 	}
 
 	// Sorts conditions for convenience of the consumer, i.e. kubectl.
@@ -77,6 +88,10 @@ func Set(to Setter, condition *kmapi.Condition) {
 	})
 
 	to.SetConditions(conditions)
+
+	if transitioned {
+		recordTransition(to, previous, condition.DeepCopy())
+	}
 }
 
 // TrueCondition returns a condition with Status=True and the given type.
@@ -109,18 +124,27 @@ func UnknownCondition(t kmapi.ConditionType, reason string, messageFormat string
 }
 
 // MarkTrue sets Status=True for the condition with the given type.
+// The condition is validated against the registry set via UseRegistry, if any.
 func MarkTrue(to Setter, t kmapi.ConditionType) {
-	Set(to, TrueCondition(t))
+	c := TrueCondition(t)
+	validateWithDefaultRegistry(c)
+	Set(to, c)
 }
 
 // MarkUnknown sets Status=Unknown for the condition with the given type.
+// The condition is validated against the registry set via UseRegistry, if any.
 func MarkUnknown(to Setter, t kmapi.ConditionType, reason, messageFormat string, messageArgs ...any) {
-	Set(to, UnknownCondition(t, reason, messageFormat, messageArgs...))
+	c := UnknownCondition(t, reason, messageFormat, messageArgs...)
+	validateWithDefaultRegistry(c)
+	Set(to, c)
 }
 
 // MarkFalse sets Status=False for the condition with the given type.
+// The condition is validated against the registry set via UseRegistry, if any.
 func MarkFalse(to Setter, t kmapi.ConditionType, reason string, severity kmapi.ConditionSeverity, messageFormat string, messageArgs ...any) {
-	Set(to, FalseCondition(t, reason, severity, messageFormat, messageArgs...))
+	c := FalseCondition(t, reason, severity, messageFormat, messageArgs...)
+	validateWithDefaultRegistry(c)
+	Set(to, c)
 }
 
 // SetSummary sets a Ready condition with the summary of all the conditions existing
@@ -167,6 +191,14 @@ func lexicographicLess(i, j *kmapi.Condition) bool {
 	return (i.Type == kmapi.ReadyCondition || i.Type < j.Type) && j.Type != kmapi.ReadyCondition
 }
 
+// isTransition returns true if the condition moved to another state, as opposed to an update of its
+// message only, eg, a progress report like "3/5 ready". Only transitions are recorded in the history.
+func isTransition(previous, current *kmapi.Condition) bool {
+	return previous.Status != current.Status ||
+		previous.Reason != current.Reason ||
+		previous.Severity != current.Severity
+}
+
 // hasSameState returns true if a condition has the same state of another; state is defined
 // by the union of following fields: Type, Status, Reason, Severity and Message (it excludes LastTransitionTime).
 func hasSameState(i, j *kmapi.Condition) bool {
@@ -29,6 +29,7 @@ import (
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/klog/v2"
 	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/readiness"
 )
 
 func CreateOrPatchPod(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, transform func(*core.Pod) *core.Pod, opts metav1.PatchOptions) (*core.Pod, kutil.VerbType, error) {
@@ -142,42 +143,21 @@ func RestartPods(ctx context.Context, c kubernetes.Interface, namespace string,
 	})
 }
 
-func WaitUntilPodRunning(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta) error {
-	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, kutil.ReadinessTimeout, true, func(ctx context.Context) (bool, error) {
-		if pod, err := c.CoreV1().Pods(meta.Namespace).Get(ctx, meta.Name, metav1.GetOptions{}); err == nil {
-			runningAndReady, _ := PodRunningAndReady(*pod)
-			return runningAndReady, nil
-		}
-		return false, nil
-	})
+// WaitUntilPodRunning waits until the Pod is running and ready. It returns an error if the Pod reaches a
+// terminal phase or is not ready within kutil.ReadinessTimeout.
+func WaitUntilPodRunning(ctx context.Context, c kubernetes.Interface, meta metav1.ObjectMeta, opts ...readiness.Option) error {
+	_, err := readiness.Wait(ctx, c.CoreV1().Pods(meta.Namespace), meta.Name, readiness.PodRunningAndReady, opts...)
+	return err
 }
 
-func WaitUntilPodRunningBySelector(ctx context.Context, c kubernetes.Interface, namespace string, selector *metav1.LabelSelector, count int) error {
+// WaitUntilPodRunningBySelector waits until exactly count pods match the selector and all of them are running and ready.
+func WaitUntilPodRunningBySelector(ctx context.Context, c kubernetes.Interface, namespace string, selector *metav1.LabelSelector, count int, opts ...readiness.Option) error {
 	r, err := metav1.LabelSelectorAsSelector(selector)
 	if err != nil {
 		return err
 	}
-
-	return wait.PollUntilContextTimeout(ctx, kutil.RetryInterval, kutil.ReadinessTimeout, true, func(ctx context.Context) (bool, error) {
-		podList, err := c.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
-			LabelSelector: r.String(),
-		})
-		if err != nil {
-			return false, nil
-		}
-
-		if len(podList.Items) != count {
-			return false, nil
-		}
-
-		for _, pod := range podList.Items {
-			runningAndReady, _ := PodRunningAndReady(pod)
-			if !runningAndReady {
-				return false, nil
-			}
-		}
-		return true, nil
-	})
+	_, err = readiness.WaitForSelector(ctx, c.CoreV1().Pods(namespace), r, readiness.Each(count, readiness.PodRunningAndReady), opts...)
+	return err
 }
 
 func WaitUntilPodDeletedBySelector(ctx context.Context, c kubernetes.Interface, namespace string, selector *metav1.LabelSelector) error {
@@ -0,0 +1,378 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meta
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+const (
+	AnnotationTagName = "annotation"
+	LabelTagName      = "label"
+)
+
+// DecodeAnnotations sets the fields of the struct pointed to by v from the annotations, using the
+// `annotation` struct tags. See DecodeMap for the tag format.
+func DecodeAnnotations(annotations map[string]string, v any) error {
+	return DecodeMap(AnnotationTagName, annotations, v)
+}
+
+// DecodeLabels sets the fields of the struct pointed to by v from the labels, using the `label` struct tags.
+func DecodeLabels(labels map[string]string, v any) error {
+	return DecodeMap(LabelTagName, labels, v)
+}
+
+// EncodeAnnotations returns the annotations for the fields of v with `annotation` struct tags.
+func EncodeAnnotations(v any) (map[string]string, error) {
+	return EncodeMap(AnnotationTagName, v)
+}
+
+// EncodeLabels returns the labels for the fields of v with `label` struct tags.
+func EncodeLabels(v any) (map[string]string, error) {
+	return EncodeMap(LabelTagName, v)
+}
+
+// DecodeMap sets the fields of the struct pointed to by v from m, using the struct tags named tagName.
+// The tag holds the key followed by comma separated options:
+//
+//	alt=<key>      alternate or deprecated key, checked in order when the key is missing; may be repeated
+//	required       the key or one of its alternates must be present
+//	omitempty      zero values are skipped by EncodeMap
+//	default=<val>  value used when the key is missing; must be the last option and may contain commas
+//
+// for example `annotation:"example.com/backup-schedule,alt=backup-schedule,default=@daily"`.
+//
+// Supported field types are string, bool, integers, floats, time.Duration, resource.Quantity,
+// encoding.TextUnmarshaler implementations, pointers to those, and []string and map[string]string encoded
+// as json like GetList and GetMap. Fields whose key is missing and have no default are left unchanged.
+// All errors are reported together.
+func DecodeMap(tagName string, m map[string]string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("expected a non-nil pointer to struct, found %T", v)
+	}
+	fields, err := cachedTagFields(tagName, rv.Elem().Type())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, f := range fields {
+		s, found := f.lookup(m)
+		if !found {
+			if f.required {
+				errs = append(errs, fmt.Errorf("%s: missing required key %s", f.name, f.key))
+			}
+			continue
+		}
+		if err := setFieldValue(rv.Elem().FieldByIndex(f.index), s); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid value %q for key %s: %w", f.name, s, f.key, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// EncodeMap returns a map with an entry for each field of v with a struct tag named tagName. Only the
+// primary keys are written, never the alternates.
+func EncodeMap(tagName string, v any) (map[string]string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("expected a struct, found nil %T", v)
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a struct, found %T", v)
+	}
+	fields, err := cachedTagFields(tagName, rv.Type())
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]string, len(fields))
+	var errs []error
+	for _, f := range fields {
+		fv := rv.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Pointer && fv.IsNil() {
+			continue
+		}
+		if f.omitempty && fv.IsZero() {
+			continue
+		}
+		s, err := formatFieldValue(fv)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.name, err))
+			continue
+		}
+		out[f.key] = s
+	}
+	if len(errs) > 0 {
+		return nil, utilerrors.NewAggregate(errs)
+	}
+	return out, nil
+}
+
+type tagField struct {
+	name      string
+	index     []int
+	key       string
+	alts      []string
+	def       *string
+	required  bool
+	omitempty bool
+}
+
+func (f tagField) lookup(m map[string]string) (string, bool) {
+	if s, err := GetStringValueForKeys(m, f.key, f.alts...); err == nil {
+		return s, true
+	}
+	if f.def != nil {
+		return *f.def, true
+	}
+	return "", false
+}
+
+type tagFieldsKey struct {
+	tagName string
+	typ     reflect.Type
+}
+
+var tagFieldsCache sync.Map // tagFieldsKey -> []tagField
+
+func cachedTagFields(tagName string, t reflect.Type) ([]tagField, error) {
+	key := tagFieldsKey{tagName, t}
+	if v, ok := tagFieldsCache.Load(key); ok {
+		return v.([]tagField), nil
+	}
+	fields, err := tagFields(tagName, t, nil)
+	if err != nil {
+		return nil, err
+	}
+	tagFieldsCache.Store(key, fields)
+	return fields, nil
+}
+
+func tagFields(tagName string, t reflect.Type, index []int) ([]tagField, error) {
+	var fields []tagField
+	var errs []error
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+
+		tag, ok := sf.Tag.Lookup(tagName)
+		if !ok {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				embedded, err := tagFields(tagName, sf.Type, idx)
+				if err != nil {
+					errs = append(errs, err)
+				}
+				fields = append(fields, embedded...)
+			}
+			continue
+		}
+		if tag == "-" || !sf.IsExported() {
+			continue
+		}
+
+		f := tagField{name: sf.Name, index: idx}
+		parts := strings.Split(tag, ",")
+		f.key = parts[0]
+		if f.key == "" {
+			errs = append(errs, fmt.Errorf("%s: missing key in %s tag", sf.Name, tagName))
+			continue
+		}
+		for j := 1; j < len(parts); j++ {
+			opt := parts[j]
+			switch {
+			case opt == "required":
+				f.required = true
+			case opt == "omitempty":
+				f.omitempty = true
+			case strings.HasPrefix(opt, "alt="):
+				f.alts = append(f.alts, strings.TrimPrefix(opt, "alt="))
+			case strings.HasPrefix(opt, "default="):
+				def := strings.Join(append([]string{strings.TrimPrefix(opt, "default=")}, parts[j+1:]...), ",")
+				f.def = &def
+				j = len(parts)
+			default:
+				errs = append(errs, fmt.Errorf("%s: unknown option %q in %s tag", sf.Name, opt, tagName))
+			}
+		}
+		if !isSupportedFieldType(sf.Type) {
+			errs = append(errs, fmt.Errorf("%s: unsupported type %s", sf.Name, sf.Type))
+			continue
+		}
+		if f.def != nil {
+			if err := setFieldValue(reflect.New(sf.Type).Elem(), *f.def); err != nil {
+				errs = append(errs, fmt.Errorf("%s: invalid default %q: %w", sf.Name, *f.def, err))
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, utilerrors.NewAggregate(errs)
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	quantityType        = reflect.TypeOf(resource.Quantity{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func isSupportedFieldType(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == quantityType || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	case reflect.Map:
+		return t.Key().Kind() == reflect.String && t.Elem().Kind() == reflect.String
+	}
+	return false
+}
+
+func setFieldValue(fv reflect.Value, s string) error {
+	if fv.Kind() == reflect.Pointer {
+		v := reflect.New(fv.Type().Elem())
+		if err := setFieldValue(v.Elem(), s); err != nil {
+			return err
+		}
+		fv.Set(v)
+		return nil
+	}
+	if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(s))
+	}
+	if fv.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	if fv.Type() == quantityType {
+		q, err := resource.ParseQuantity(s)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(q))
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Slice, reflect.Map:
+		v := reflect.New(fv.Type())
+		if err := json.Unmarshal([]byte(s), v.Interface()); err != nil {
+			return err
+		}
+		fv.Set(v.Elem())
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+func formatFieldValue(fv reflect.Value) (string, error) {
+	if fv.Kind() == reflect.Pointer {
+		fv = fv.Elem()
+	}
+	if fv.Type().Implements(textMarshalerType) {
+		b, err := fv.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if reflect.PointerTo(fv.Type()).Implements(textMarshalerType) {
+		v := reflect.New(fv.Type())
+		v.Elem().Set(fv)
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if fv.Type() == durationType {
+		return time.Duration(fv.Int()).String(), nil
+	}
+	if fv.Type() == quantityType {
+		q := fv.Interface().(resource.Quantity)
+		return q.String(), nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		return fv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(fv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(fv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(fv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(fv.Float(), 'g', -1, fv.Type().Bits()), nil
+	case reflect.Slice, reflect.Map:
+		if fv.IsNil() && fv.Kind() == reflect.Slice {
+			fv = reflect.MakeSlice(fv.Type(), 0, 0)
+		} else if fv.IsNil() {
+			fv = reflect.MakeMap(fv.Type())
+		}
+		b, err := json.Marshal(fv.Interface())
+		return string(b), err
+	}
+	return "", fmt.Errorf("unsupported type %s", fv.Type())
+}
@@ -0,0 +1,128 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package meta
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+type backupAnnotations struct {
+	Schedule  string            `annotation:"example.com/backup-schedule,alt=backup-schedule,default=@daily"`
+	Enabled   bool              `annotation:"example.com/backup-enabled,required"`
+	Retention int               `annotation:"example.com/backup-retention,omitempty"`
+	Timeout   time.Duration     `annotation:"example.com/backup-timeout,default=5m"`
+	Ratio     *float64          `annotation:"example.com/backup-ratio"`
+	Targets   []string          `annotation:"example.com/backup-targets,omitempty"`
+	Params    map[string]string `annotation:"example.com/backup-params,omitempty"`
+	Size      resource.Quantity `annotation:"example.com/backup-size,default=1Gi"`
+	Ignored   string
+}
+
+func TestDecodeAnnotations(t *testing.T) {
+	var v backupAnnotations
+	err := DecodeAnnotations(map[string]string{
+		"backup-schedule":              "0 * * * *",
+		"example.com/backup-enabled":   "true",
+		"example.com/backup-ratio":     "0.5",
+		"example.com/backup-targets":   `["s3","gcs"]`,
+		"example.com/backup-params":    `{"k":"v"}`,
+		"example.com/backup-timeout":   "90s",
+		"example.com/backup-retention": "7",
+	}, &v)
+	assert.NoError(t, err)
+	assert.Equal(t, "0 * * * *", v.Schedule)
+	assert.True(t, v.Enabled)
+	assert.Equal(t, 7, v.Retention)
+	assert.Equal(t, 90*time.Second, v.Timeout)
+	assert.Equal(t, 0.5, *v.Ratio)
+	assert.Equal(t, []string{"s3", "gcs"}, v.Targets)
+	assert.Equal(t, map[string]string{"k": "v"}, v.Params)
+	assert.Equal(t, "1Gi", v.Size.String())
+
+	var defaults backupAnnotations
+	assert.NoError(t, DecodeAnnotations(map[string]string{"example.com/backup-enabled": "false"}, &defaults))
+	assert.Equal(t, "@daily", defaults.Schedule)
+	assert.Equal(t, 5*time.Minute, defaults.Timeout)
+	assert.Nil(t, defaults.Ratio)
+}
+
+func TestDecodeAnnotationsReportsAllErrors(t *testing.T) {
+	var v backupAnnotations
+	err := DecodeAnnotations(map[string]string{
+		"example.com/backup-retention": "seven",
+		"example.com/backup-timeout":   "soon",
+	}, &v)
+	assert.Error(t, err)
+	msg := err.Error()
+	for _, s := range []string{"Enabled", "Retention", "Timeout"} {
+		assert.True(t, strings.Contains(msg, s), "missing error for %s in %s", s, msg)
+	}
+}
+
+func TestDecodeAnnotationsInvalidTags(t *testing.T) {
+	var v struct {
+		Ch    chan int `annotation:"example.com/ch"`
+		Count int      `annotation:"example.com/count,default=many"`
+	}
+	err := DecodeAnnotations(nil, &v)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported type")
+	assert.Contains(t, err.Error(), "invalid default")
+}
+
+func TestEncodeAnnotations(t *testing.T) {
+	ratio := 0.25
+	in := backupAnnotations{
+		Schedule: "@hourly",
+		Enabled:  true,
+		Timeout:  time.Minute,
+		Ratio:    &ratio,
+		Targets:  []string{"s3"},
+		Size:     resource.MustParse("2Gi"),
+	}
+	out, err := EncodeAnnotations(in)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"example.com/backup-schedule": "@hourly",
+		"example.com/backup-enabled":  "true",
+		"example.com/backup-timeout":  "1m0s",
+		"example.com/backup-ratio":    "0.25",
+		"example.com/backup-targets":  `["s3"]`,
+		"example.com/backup-size":     "2Gi",
+	}, out)
+
+	var decoded backupAnnotations
+	assert.NoError(t, DecodeAnnotations(out, &decoded))
+	assert.Equal(t, in.Schedule, decoded.Schedule)
+	assert.Equal(t, in.Targets, decoded.Targets)
+	assert.True(t, in.Size.Equal(decoded.Size))
+}
+
+func TestDecodeLabels(t *testing.T) {
+	var v struct {
+		App     string `label:"app.kubernetes.io/name"`
+		Version string `label:"app.kubernetes.io/version,alt=version"`
+	}
+	assert.NoError(t, DecodeLabels(map[string]string{"app.kubernetes.io/name": "mongodb", "version": "6.0"}, &v))
+	assert.Equal(t, "mongodb", v.App)
+	assert.Equal(t, "6.0", v.Version)
+}
@@ -20,8 +20,11 @@ package meta
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/klog/v2"
 )
 
@@ -75,13 +78,14 @@ func UpsertArgumentList(baseArgs []string, overrideArgs []string, protectedFlags
 // BuildArgumentListFromMap takes two string-string maps, one with the base arguments and one with optional override arguments
 func BuildArgumentListFromMap(baseArguments map[string]string, overrideArguments map[string]string) []string {
 	var command []string
-	for k, v := range overrideArguments {
+	// sort the keys, so that the list does not change between calls and restart pods
+	for _, k := range slices.Sorted(maps.Keys(overrideArguments)) {
 		// values of "" are allowed as well
-		command = append(command, fmt.Sprintf("--%s=%s", k, v))
+		command = append(command, fmt.Sprintf("--%s=%s", k, overrideArguments[k]))
 	}
-	for k, v := range baseArguments {
+	for _, k := range slices.Sorted(maps.Keys(baseArguments)) {
 		if _, overrideExists := overrideArguments[k]; !overrideExists {
-			command = append(command, fmt.Sprintf("--%s=%s", k, v))
+			command = append(command, fmt.Sprintf("--%s=%s", k, baseArguments[k]))
 		}
 	}
 	return command
@@ -144,3 +148,365 @@ func parseArgument(arg string) (string, string, error) {
 
 	return keyvalSlice[0], keyvalSlice[1], nil
 }
+
+// Argument is a flag with its value or a positional argument of a command line.
+type Argument struct {
+	// Name is the flag name without the leading dashes. It is empty for positional arguments.
+	Name string
+	// Value is the value of the flag or the positional argument.
+	Value string
+	// Style is how the argument is written on the command line.
+	Style ArgumentStyle
+	// Short is true for flags written with a single dash, e.g., -v.
+	Short bool
+}
+
+type ArgumentStyle int
+
+const (
+	// ArgumentPositional is an argument that is not a flag, e.g., the binary name.
+	ArgumentPositional ArgumentStyle = iota
+	// ArgumentBool is a flag without a value, e.g., --verbose.
+	ArgumentBool
+	// ArgumentEquals is a flag with its value after an equal sign, e.g., --port=8080.
+	ArgumentEquals
+	// ArgumentSpace is a flag followed by its value as a separate argument, e.g., --port 8080.
+	ArgumentSpace
+	// ArgumentSeparator is the "--" that ends the flags. It is neither a flag nor a positional argument.
+	ArgumentSeparator
+)
+
+func (a Argument) IsFlag() bool {
+	return a.Style != ArgumentPositional && a.Style != ArgumentSeparator
+}
+
+// Strings returns the argument as written on the command line.
+func (a Argument) Strings() []string {
+	prefix := "--"
+	if a.Short {
+		prefix = "-"
+	}
+	switch a.Style {
+	case ArgumentBool:
+		return []string{prefix + a.Name}
+	case ArgumentEquals:
+		return []string{prefix + a.Name + "=" + a.Value}
+	case ArgumentSpace:
+		return []string{prefix + a.Name, a.Value}
+	case ArgumentSeparator:
+		return []string{"--"}
+	}
+	return []string{a.Value}
+}
+
+// Arguments is a parsed command line. Unlike the map based helpers, it keeps the order of the arguments,
+// positional arguments, repeated flags and the way each flag is written, so that it renders back to the
+// same list unless changed.
+type Arguments struct {
+	items []Argument
+}
+
+type argumentsOptions struct {
+	boolFlags sets.Set[string]
+}
+
+type ArgumentsOption func(*argumentsOptions)
+
+// WithBoolFlags declares flags that never take a value, so that an argument after them is parsed as
+// a positional argument instead of their value.
+func WithBoolFlags(names ...string) ArgumentsOption {
+	return func(o *argumentsOptions) {
+		for _, name := range names {
+			o.boolFlags.Insert(trimDashes(name))
+		}
+	}
+}
+
+// ParseArguments parses the command line. Flags may be written as --flag=value, --flag value, -f value
+// or without a value. Since flag definitions are unknown, an argument after a flag without an equal sign
+// is parsed as its value, unless it starts with a dash or the flag is declared via WithBoolFlags.
+// Arguments after "--" are positional.
+func ParseArguments(args []string, opts ...ArgumentsOption) *Arguments {
+	o := argumentsOptions{boolFlags: sets.New[string]()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	result := &Arguments{items: make([]Argument, 0, len(args))}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			result.items = append(result.items, Argument{Style: ArgumentSeparator})
+			for _, rest := range args[i+1:] {
+				result.items = append(result.items, Argument{Value: rest})
+			}
+			break
+		}
+		if !isFlag(arg) {
+			result.items = append(result.items, Argument{Value: arg})
+			continue
+		}
+
+		a := Argument{Short: !strings.HasPrefix(arg, "--")}
+		name := trimDashes(arg)
+		if k, v, found := strings.Cut(name, "="); found {
+			a.Name, a.Value, a.Style = k, v, ArgumentEquals
+		} else if i+1 < len(args) && !isFlag(args[i+1]) && args[i+1] != "--" && !o.boolFlags.Has(name) {
+			a.Name, a.Value, a.Style = name, args[i+1], ArgumentSpace
+			i++
+		} else {
+			a.Name, a.Style = name, ArgumentBool
+		}
+		result.items = append(result.items, a)
+	}
+	return result
+}
+
+func isFlag(arg string) bool {
+	if len(arg) < 2 || arg[0] != '-' || arg == "--" {
+		return false
+	}
+	// negative numbers are values
+	if arg[1] >= '0' && arg[1] <= '9' {
+		return false
+	}
+	return true
+}
+
+func trimDashes(name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, "-"), "-")
+}
+
+// Strings returns the command line. Parsing a command line and rendering it back returns the same list.
+func (a *Arguments) Strings() []string {
+	out := make([]string, 0, len(a.items))
+	for _, item := range a.items {
+		out = append(out, item.Strings()...)
+	}
+	return out
+}
+
+// Items returns a copy of the parsed arguments in order.
+func (a *Arguments) Items() []Argument {
+	return slices.Clone(a.items)
+}
+
+func (a *Arguments) DeepCopy() *Arguments {
+	return &Arguments{items: slices.Clone(a.items)}
+}
+
+// Positional returns the positional arguments in order. The "--" separator is not included.
+func (a *Arguments) Positional() []string {
+	var out []string
+	for _, item := range a.items {
+		if item.Style == ArgumentPositional {
+			out = append(out, item.Value)
+		}
+	}
+	return out
+}
+
+// Has returns true if the flag is present.
+func (a *Arguments) Has(name string) bool {
+	name = trimDashes(name)
+	return slices.ContainsFunc(a.items, func(item Argument) bool {
+		return item.IsFlag() && item.Name == name
+	})
+}
+
+// Get returns the value of the last occurrence of the flag, as flag parsers usually do. Flags without a
+// value return "true".
+func (a *Arguments) Get(name string) (string, bool) {
+	values := a.GetAll(name)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns the values of all occurrences of a repeated flag in order.
+func (a *Arguments) GetAll(name string) []string {
+	name = trimDashes(name)
+	var out []string
+	for _, item := range a.items {
+		if item.IsFlag() && item.Name == name {
+			out = append(out, flagValue(item))
+		}
+	}
+	return out
+}
+
+func flagValue(item Argument) string {
+	if item.Style == ArgumentBool {
+		return "true"
+	}
+	return item.Value
+}
+
+// Set sets the value of the flag. The first occurrence is updated in place keeping its style, and the
+// other occurrences are removed. The flag is appended as --name=value if missing, before "--" if present.
+func (a *Arguments) Set(name, value string) {
+	a.set(name, func(item *Argument) {
+		item.Value = value
+		if item.Style == ArgumentBool {
+			item.Style = ArgumentEquals
+		}
+	}, Argument{Name: trimDashes(name), Value: value, Style: ArgumentEquals})
+}
+
+// SetBool adds the flag without a value, replacing all its occurrences.
+func (a *Arguments) SetBool(name string) {
+	a.set(name, func(item *Argument) {
+		item.Value = ""
+		item.Style = ArgumentBool
+	}, Argument{Name: trimDashes(name), Style: ArgumentBool})
+}
+
+func (a *Arguments) set(name string, update func(item *Argument), missing Argument) {
+	name = trimDashes(name)
+	found := false
+	items := a.items[:0]
+	for _, item := range a.items {
+		if item.IsFlag() && item.Name == name {
+			if found {
+				continue
+			}
+			found = true
+			update(&item)
+		}
+		items = append(items, item)
+	}
+	a.items = items
+	if !found {
+		a.appendFlags(missing)
+	}
+}
+
+// Add appends another occurrence of a repeated flag as --name=value.
+func (a *Arguments) Add(name, value string) {
+	a.appendFlags(Argument{Name: trimDashes(name), Value: value, Style: ArgumentEquals})
+}
+
+// appendFlags appends the flags before the "--" separator, so that they are not parsed as positional arguments.
+func (a *Arguments) appendFlags(flags ...Argument) {
+	idx := slices.IndexFunc(a.items, func(item Argument) bool {
+		return item.Style == ArgumentSeparator
+	})
+	if idx < 0 {
+		a.items = append(a.items, flags...)
+		return
+	}
+	a.items = slices.Insert(a.items, idx, flags...)
+}
+
+// Remove removes all occurrences of the flag.
+func (a *Arguments) Remove(name string) {
+	name = trimDashes(name)
+	a.items = slices.DeleteFunc(a.items, func(item Argument) bool {
+		return item.IsFlag() && item.Name == name
+	})
+}
+
+// Upsert applies the overrides to the arguments, like UpsertArgumentList. Flags present in the overrides
+// replace all occurrences of the flag, keeping the position of the first one, and new flags are appended
+// in the order of the overrides. Positional overrides are appended. Protected flags are never changed.
+func (a *Arguments) Upsert(overrides *Arguments, protectedFlags ...string) {
+	protected := sets.New[string]()
+	for _, flag := range protectedFlags {
+		protected.Insert(trimDashes(flag))
+	}
+
+	done := sets.New[string]()
+	for _, item := range overrides.items {
+		if item.Style == ArgumentSeparator && slices.ContainsFunc(a.items, func(x Argument) bool { return x.Style == ArgumentSeparator }) {
+			continue
+		}
+		if !item.IsFlag() {
+			a.items = append(a.items, item)
+			continue
+		}
+		if protected.Has(item.Name) || done.Has(item.Name) {
+			continue
+		}
+		done.Insert(item.Name)
+
+		var values []Argument
+		for _, o := range overrides.items {
+			if o.IsFlag() && o.Name == item.Name {
+				values = append(values, o)
+			}
+		}
+		a.replace(item.Name, values)
+	}
+}
+
+// replace replaces all occurrences of the flag with values, at the position of the first occurrence.
+func (a *Arguments) replace(name string, values []Argument) {
+	idx := slices.IndexFunc(a.items, func(item Argument) bool {
+		return item.IsFlag() && item.Name == name
+	})
+	if idx < 0 {
+		a.appendFlags(values...)
+		return
+	}
+	a.Remove(name)
+	a.items = slices.Insert(a.items, idx, values...)
+}
+
+// Equal returns true if both have the same flag values and positional arguments, regardless of how the
+// flags are written or ordered.
+func (a *Arguments) Equal(other *Arguments) bool {
+	return DiffArguments(a, other).Empty()
+}
+
+// ArgumentChange is a flag whose values differ between two command lines.
+type ArgumentChange struct {
+	Name string
+	Old  []string
+	New  []string
+}
+
+type ArgumentsDiff struct {
+	Added             []ArgumentChange
+	Removed           []ArgumentChange
+	Changed           []ArgumentChange
+	PositionalChanged bool
+}
+
+func (d ArgumentsDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && !d.PositionalChanged
+}
+
+// DiffArguments compares the flag values and positional arguments of two command lines. Flags are
+// compared by name and the order of their values, so reordering flags or changing how they are written
+// is not a change. The changes are sorted by flag name.
+func DiffArguments(oldArgs, newArgs *Arguments) ArgumentsDiff {
+	oldFlags, newFlags := oldArgs.flagValues(), newArgs.flagValues()
+
+	var diff ArgumentsDiff
+	for _, name := range slices.Sorted(maps.Keys(oldFlags)) {
+		nv, found := newFlags[name]
+		if !found {
+			diff.Removed = append(diff.Removed, ArgumentChange{Name: name, Old: oldFlags[name]})
+		} else if !slices.Equal(oldFlags[name], nv) {
+			diff.Changed = append(diff.Changed, ArgumentChange{Name: name, Old: oldFlags[name], New: nv})
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(newFlags)) {
+		if _, found := oldFlags[name]; !found {
+			diff.Added = append(diff.Added, ArgumentChange{Name: name, New: newFlags[name]})
+		}
+	}
+	diff.PositionalChanged = !slices.Equal(oldArgs.Positional(), newArgs.Positional())
+	return diff
+}
+
+func (a *Arguments) flagValues() map[string][]string {
+	out := map[string][]string{}
+	for _, item := range a.items {
+		if item.IsFlag() {
+			out[item.Name] = append(out[item.Name], flagValue(item))
+		}
+	}
+	return out
+}
@@ -90,3 +90,101 @@ func TestUpsertArgumentList(t *testing.T) {
 		})
 	}
 }
+
+func TestParseArgumentsRoundTrip(t *testing.T) {
+	cases := [][]string{
+		{"mongod", "--port=27017", "--bind_ip_all", "-f", "/etc/mongod.conf", "--setParameter", "a=1", "--setParameter", "b=2"},
+		{"postgres", "-c", "max_connections=100", "--offset", "-1", "--", "--not-a-flag"},
+		{},
+	}
+	for _, args := range cases {
+		result := ParseArguments(args).Strings()
+		if !apiequality.Semantic.DeepEqual(args, result) {
+			t.Errorf("expected %v, got %v", args, result)
+		}
+	}
+}
+
+func TestArgumentsSeparator(t *testing.T) {
+	args := ParseArguments([]string{"postgres", "-c", "max_connections=100", "--", "--not-a-flag", "data"})
+	if got := args.Positional(); !apiequality.Semantic.DeepEqual(got, []string{"postgres", "--not-a-flag", "data"}) {
+		t.Errorf("unexpected positional arguments %v", got)
+	}
+	if args.Has("not-a-flag") {
+		t.Errorf("arguments after -- must not be flags")
+	}
+
+	args.Set("port", "5432")
+	args.Upsert(ParseArguments([]string{"--", "extra"}))
+	want := []string{"postgres", "-c", "max_connections=100", "--port=5432", "--", "--not-a-flag", "data", "extra"}
+	if got := args.Strings(); !apiequality.Semantic.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestArguments(t *testing.T) {
+	args := ParseArguments([]string{"mongod", "--verbose", "config.yaml", "--port", "27017", "--setParameter=a=1", "--setParameter", "b=2"},
+		WithBoolFlags("--verbose"))
+
+	if got := args.Positional(); !apiequality.Semantic.DeepEqual(got, []string{"mongod", "config.yaml"}) {
+		t.Errorf("unexpected positional arguments %v", got)
+	}
+	if v, _ := args.Get("verbose"); v != "true" {
+		t.Errorf("expected verbose to be true, got %s", v)
+	}
+	if got := args.GetAll("setParameter"); !apiequality.Semantic.DeepEqual(got, []string{"a=1", "b=2"}) {
+		t.Errorf("unexpected repeated flag values %v", got)
+	}
+
+	args.Set("port", "27018")
+	args.Set("--setParameter", "c=3")
+	args.Add("tlsMode", "requireTLS")
+	args.Remove("verbose")
+	expected := []string{"mongod", "config.yaml", "--port", "27018", "--setParameter=c=3", "--tlsMode=requireTLS"}
+	if got := args.Strings(); !apiequality.Semantic.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestArgumentsUpsert(t *testing.T) {
+	base := ParseArguments([]string{"app", "--k1=v1", "-k2", "v2", "--r=1", "--k3", "--r=2", "--k4=v4"})
+	overrides := ParseArguments([]string{"--k1", "w1", "--r=3", "--r=4", "--k4=w4", "--k5=w5", "extra"})
+	base.Upsert(overrides, "--k4")
+
+	expected := []string{"app", "--k1", "w1", "-k2", "v2", "--r=3", "--r=4", "--k3", "--k4=v4", "--k5=w5", "extra"}
+	if got := base.Strings(); !apiequality.Semantic.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestDiffArguments(t *testing.T) {
+	a := ParseArguments([]string{"app", "--k1=v1", "--k2", "v2", "--r=1", "--r=2"})
+	b := ParseArguments([]string{"app", "--k2=v2", "--k1", "v1", "--r=1", "--r=2"})
+	if !a.Equal(b) {
+		t.Errorf("expected reordered arguments to be equal, diff %+v", DiffArguments(a, b))
+	}
+
+	c := ParseArguments([]string{"app", "--k1=w1", "--r=2", "--r=1", "--k3"})
+	diff := DiffArguments(a, c)
+	expected := ArgumentsDiff{
+		Added:   []ArgumentChange{{Name: "k3", New: []string{"true"}}},
+		Removed: []ArgumentChange{{Name: "k2", Old: []string{"v2"}}},
+		Changed: []ArgumentChange{
+			{Name: "k1", Old: []string{"v1"}, New: []string{"w1"}},
+			{Name: "r", Old: []string{"1", "2"}, New: []string{"2", "1"}},
+		},
+	}
+	if !apiequality.Semantic.DeepEqual(expected, diff) {
+		t.Errorf("expected %+v, got %+v", expected, diff)
+	}
+}
+
+func TestBuildArgumentListFromMapIsStable(t *testing.T) {
+	expected := []string{"--a=1", "--c=3", "--b=2", "--d=4"}
+	for i := 0; i < 10; i++ {
+		result := BuildArgumentListFromMap(map[string]string{"b": "2", "d": "4", "a": "0"}, map[string]string{"c": "3", "a": "1"})
+		if !apiequality.Semantic.DeepEqual(expected, result) {
+			t.Fatalf("expected %v, got %v", expected, result)
+		}
+	}
+}
@@ -0,0 +1,303 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package incluster
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"kmodules.xyz/client-go/client/apiutil"
+	meta_util "kmodules.xyz/client-go/meta"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// xref: https://kubernetes.io/docs/concepts/workloads/pods/downward-api/
+
+const (
+	// ServiceAccountDir is where the service account token, namespace and ca.crt are mounted.
+	ServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// DefaultPodInfoDir is where the downward-API volume with the labels and annotations files is
+	// expected to be mounted.
+	DefaultPodInfoDir = "/etc/podinfo"
+)
+
+// RuntimeInfo describes the pod the process runs in. Use Load or Current to read it from the
+// environment, or build one directly in tests.
+type RuntimeInfo struct {
+	InCluster      bool
+	PodName        string
+	PodNamespace   string
+	PodUID         string
+	PodIP          string
+	NodeName       string
+	ServiceAccount string
+	ClusterDomain  string
+	Labels         map[string]string
+	Annotations    map[string]string
+
+	// Lineage is the chain of controllers of the pod, from the top-most workload down to the pod
+	// itself. It is set by DetectLineage.
+	Lineage []kmapi.ObjectInfo
+}
+
+type options struct {
+	getenv        func(string) (string, bool)
+	fsys          fs.FS
+	podInfoDir    string
+	clusterDomain func() string
+}
+
+type Option func(*options)
+
+// WithEnv replaces the environment lookup, e.g., with a map in tests.
+func WithEnv(fn func(key string) (string, bool)) Option {
+	return func(o *options) {
+		o.getenv = fn
+	}
+}
+
+// WithFS replaces the root filesystem the service account and downward-API files are read from.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
+// WithPodInfoDir sets where the downward-API volume is mounted. Defaults to DefaultPodInfoDir.
+func WithPodInfoDir(dir string) Option {
+	return func(o *options) {
+		o.podInfoDir = dir
+	}
+}
+
+// WithClusterDomain replaces the cluster domain detection, which does a DNS lookup in cluster.
+func WithClusterDomain(fn func() string) Option {
+	return func(o *options) {
+		o.clusterDomain = fn
+	}
+}
+
+// Load reads the RuntimeInfo from the env vars set by the downward API, the mounted service account
+// files and the labels and annotations files of a downward-API volume. Missing sources are skipped.
+func Load(opts ...Option) (*RuntimeInfo, error) {
+	o := options{
+		getenv:        os.LookupEnv,
+		fsys:          os.DirFS("/"),
+		podInfoDir:    DefaultPodInfoDir,
+		clusterDomain: meta_util.ClusterDomain,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	env := func(key string) string {
+		v, _ := o.getenv(key)
+		return v
+	}
+
+	info := RuntimeInfo{
+		PodName:        env("POD_NAME"),
+		PodNamespace:   env("POD_NAMESPACE"),
+		PodUID:         env("POD_UID"),
+		PodIP:          env("POD_IP"),
+		NodeName:       env("NODE_NAME"),
+		ServiceAccount: env("POD_SERVICE_ACCOUNT"),
+	}
+
+	token, tokenErr := readFile(o.fsys, path.Join(ServiceAccountDir, "token"))
+	info.InCluster = env("KUBERNETES_SERVICE_HOST") != "" && env("KUBERNETES_SERVICE_PORT") != "" && tokenErr == nil
+
+	if info.PodNamespace == "" {
+		if ns, err := readFile(o.fsys, path.Join(ServiceAccountDir, "namespace")); err == nil {
+			info.PodNamespace = ns
+		}
+	}
+	if info.ServiceAccount == "" && tokenErr == nil {
+		info.ServiceAccount = serviceAccountFromToken(token)
+	}
+
+	var err error
+	if info.Labels, err = readDownwardAPIMap(o.fsys, path.Join(o.podInfoDir, "labels")); err != nil {
+		return nil, err
+	}
+	if info.Annotations, err = readDownwardAPIMap(o.fsys, path.Join(o.podInfoDir, "annotations")); err != nil {
+		return nil, err
+	}
+
+	if info.PodName == "" {
+		info.PodName, _ = os.Hostname()
+	}
+	if info.PodNamespace == "" {
+		info.PodNamespace = core.NamespaceDefault
+	}
+	if v := env("KUBE_CLUSTER_DOMAIN"); v != "" {
+		info.ClusterDomain = v
+	} else {
+		info.ClusterDomain = o.clusterDomain()
+	}
+	return &info, nil
+}
+
+var (
+	current   *RuntimeInfo
+	currentMu sync.Mutex
+)
+
+// Current returns the RuntimeInfo of the process, loading it on first use.
+func Current() (*RuntimeInfo, error) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	if current == nil {
+		info, err := Load()
+		if err != nil {
+			return nil, err
+		}
+		current = info
+	}
+	return current, nil
+}
+
+// SetCurrent replaces the RuntimeInfo returned by Current. Use it to mock the runtime in tests.
+func SetCurrent(info *RuntimeInfo) {
+	currentMu.Lock()
+	defer currentMu.Unlock()
+	current = info
+}
+
+func readFile(fsys fs.FS, name string) (string, error) {
+	data, err := fs.ReadFile(fsys, strings.TrimPrefix(name, "/"))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readDownwardAPIMap parses the labels or annotations file of a downward-API volume, which holds one
+// key="value" pair per line with the value quoted like a Go string.
+func readDownwardAPIMap(fsys fs.FS, name string) (map[string]string, error) {
+	data, err := fs.ReadFile(fsys, strings.TrimPrefix(name, "/"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	out := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(string(data)))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		k, v, found := strings.Cut(line, "=")
+		if !found {
+			return nil, errors.Errorf("invalid line %q in %s", line, name)
+		}
+		if uv, err := strconv.Unquote(v); err == nil {
+			v = uv
+		}
+		out[k] = v
+	}
+	return out, scanner.Err()
+}
+
+// serviceAccountFromToken returns the service account name from the claims of the mounted token.
+// The token is not verified, it is only read to find out who the pod runs as.
+func serviceAccountFromToken(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Subject string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	// sub: system:serviceaccount:<namespace>:<name>
+	if rest, ok := strings.CutPrefix(claims.Subject, "system:serviceaccount:"); ok {
+		if _, name, ok := strings.Cut(rest, ":"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// DetectLineage looks up the pod and sets the Lineage to its chain of controllers.
+func (r *RuntimeInfo) DetectLineage(ctx context.Context, kc client.Client) error {
+	var pod core.Pod
+	if err := kc.Get(ctx, client.ObjectKey{Namespace: r.PodNamespace, Name: r.PodName}, &pod); err != nil {
+		return err
+	}
+	pod.APIVersion = "v1"
+	pod.Kind = "Pod"
+	lineage, err := apiutil.DetectLineage(ctx, kc, &pod)
+	if err != nil {
+		return err
+	}
+	r.Lineage = lineage
+	return nil
+}
+
+// Owner returns the top-most workload controlling the pod, e.g., the Deployment of a ReplicaSet. It returns
+// false if the pod has no controller or DetectLineage was not called.
+func (r *RuntimeInfo) Owner() (kmapi.ObjectInfo, bool) {
+	if len(r.Lineage) < 2 {
+		return kmapi.ObjectInfo{}, false
+	}
+	return r.Lineage[0], true
+}
+
+// Identity returns a name for the process that is unique in the cluster, e.g., for leader election.
+func (r *RuntimeInfo) Identity() string {
+	if r.PodUID != "" {
+		return r.PodName + "_" + r.PodUID
+	}
+	return r.PodName
+}
+
+// MetricsLabels returns labels identifying the process in metrics.
+func (r *RuntimeInfo) MetricsLabels() map[string]string {
+	labels := map[string]string{
+		"pod":       r.PodName,
+		"namespace": r.PodNamespace,
+	}
+	if r.NodeName != "" {
+		labels["node"] = r.NodeName
+	}
+	if owner, ok := r.Owner(); ok {
+		labels["owner_kind"] = owner.Resource.Kind
+		labels["owner_name"] = owner.Ref.Name
+	}
+	return labels
+}
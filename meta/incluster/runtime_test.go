@@ -0,0 +1,112 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package incluster
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"testing/fstest"
+
+	apps "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestLoad(t *testing.T) {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"system:serviceaccount:kubedb:kubedb-operator"}`))
+	fsys := fstest.MapFS{
+		"var/run/secrets/kubernetes.io/serviceaccount/token":     {Data: []byte("e30." + payload + ".sig")},
+		"var/run/secrets/kubernetes.io/serviceaccount/namespace": {Data: []byte("kubedb\n")},
+		"etc/podinfo/labels":      {Data: []byte("app.kubernetes.io/name=\"kubedb\"\npod-template-hash=\"5d4f8\"\n")},
+		"etc/podinfo/annotations": {Data: []byte("kubernetes.io/config.seen=\"2024-01-01T00:00:00Z\"\nnote=\"a \\\"quoted\\\" value\"\n")},
+	}
+	env := map[string]string{
+		"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+		"KUBERNETES_SERVICE_PORT": "443",
+		"POD_NAME":                "kubedb-operator-5d4f8-abcde",
+		"POD_UID":                 "uid-1",
+		"NODE_NAME":               "node-1",
+	}
+
+	info, err := Load(
+		WithFS(fsys),
+		WithEnv(func(key string) (string, bool) {
+			v, ok := env[key]
+			return v, ok
+		}),
+		WithClusterDomain(func() string { return "cluster.local" }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.InCluster {
+		t.Error("expected to be in cluster")
+	}
+	if info.PodNamespace != "kubedb" || info.ServiceAccount != "kubedb-operator" || info.ClusterDomain != "cluster.local" {
+		t.Errorf("unexpected runtime info %+v", info)
+	}
+	if info.Labels["app.kubernetes.io/name"] != "kubedb" || info.Annotations["note"] != `a "quoted" value` {
+		t.Errorf("unexpected downward-API metadata %v %v", info.Labels, info.Annotations)
+	}
+	if info.Identity() != "kubedb-operator-5d4f8-abcde_uid-1" {
+		t.Errorf("unexpected identity %s", info.Identity())
+	}
+}
+
+func TestDetectLineage(t *testing.T) {
+	deploy := &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "kubedb-operator", Namespace: "kubedb", UID: types.UID("d1")}}
+	rs := &apps.ReplicaSet{ObjectMeta: metav1.ObjectMeta{
+		Name:            "kubedb-operator-5d4f8",
+		Namespace:       "kubedb",
+		UID:             types.UID("rs1"),
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: deploy.Name, UID: deploy.UID, Controller: ptr.To(true)}},
+	}}
+	pod := &core.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:            "kubedb-operator-5d4f8-abcde",
+		Namespace:       "kubedb",
+		OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: rs.Name, UID: rs.UID, Controller: ptr.To(true)}},
+	}}
+	kc := fake.NewClientBuilder().
+		WithScheme(clientgoscheme.Scheme).
+		WithRESTMapper(testrestmapper.TestOnlyStaticRESTMapper(clientgoscheme.Scheme)).
+		WithObjects(deploy, rs, pod).
+		Build()
+
+	info := &RuntimeInfo{PodName: pod.Name, PodNamespace: pod.Namespace, NodeName: "node-1"}
+	if _, ok := info.Owner(); ok {
+		t.Error("expected no owner before DetectLineage")
+	}
+	if err := info.DetectLineage(context.TODO(), kc); err != nil {
+		t.Fatal(err)
+	}
+	owner, ok := info.Owner()
+	if !ok || owner.Resource.Kind != "Deployment" || owner.Ref.Name != deploy.Name {
+		t.Errorf("unexpected owner %+v, lineage %+v", owner, info.Lineage)
+	}
+	if len(info.Lineage) != 3 {
+		t.Errorf("expected lineage of 3 objects, found %+v", info.Lineage)
+	}
+	if labels := info.MetricsLabels(); labels["owner_kind"] != "Deployment" || labels["node"] != "node-1" {
+		t.Errorf("unexpected metrics labels %v", labels)
+	}
+}
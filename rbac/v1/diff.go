@@ -0,0 +1,108 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"slices"
+	"sort"
+
+	rbac "k8s.io/api/rbac/v1"
+)
+
+// PolicyDiff compares the rules granted to an operator with the requests it actually makes.
+type PolicyDiff struct {
+	// Missing are the requests not allowed by any granted rule.
+	Missing []Request
+	// Unused are the granted permissions that no request used. Rules without wildcards are split
+	// per api group, resource and verb. Rules with wildcards are reported as a whole.
+	Unused []rbac.PolicyRule
+	// Wildcards are the used rules that grant a wildcard verb, api group or resource and could be narrowed.
+	Wildcards []rbac.PolicyRule
+}
+
+// Empty returns true if the granted rules exactly match the used requests.
+func (d PolicyDiff) Empty() bool {
+	return len(d.Missing) == 0 && len(d.Unused) == 0 && len(d.Wildcards) == 0
+}
+
+// DiffRules compares the granted rules with the used requests to help with least privilege reviews.
+func DiffRules(granted []rbac.PolicyRule, used []Request) PolicyDiff {
+	var diff PolicyDiff
+
+	for _, req := range used {
+		if !anyRuleAllows(granted, req) && !slices.Contains(diff.Missing, req) {
+			diff.Missing = append(diff.Missing, req)
+		}
+	}
+
+	usedBy := func(rule rbac.PolicyRule) bool {
+		for _, req := range used {
+			if RuleAllows(rule, req) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, rule := range granted {
+		if hasWildcard(rule) {
+			if usedBy(rule) {
+				diff.Wildcards = append(diff.Wildcards, rule)
+			} else {
+				diff.Unused = append(diff.Unused, rule)
+			}
+			continue
+		}
+		for _, atom := range atomize(rule) {
+			if !usedBy(atom) {
+				diff.Unused = append(diff.Unused, atom)
+			}
+		}
+	}
+
+	sort.Slice(diff.Missing, func(i, j int) bool {
+		return diff.Missing[i].String() < diff.Missing[j].String()
+	})
+	return diff
+}
+
+func hasWildcard(rule rbac.PolicyRule) bool {
+	return slices.Contains(rule.Verbs, rbac.VerbAll) ||
+		slices.Contains(rule.APIGroups, rbac.APIGroupAll) ||
+		slices.Contains(rule.Resources, rbac.ResourceAll) ||
+		slices.Contains(rule.NonResourceURLs, rbac.NonResourceAll)
+}
+
+// atomize splits a rule into rules with a single api group, resource or non resource url, and verb.
+func atomize(rule rbac.PolicyRule) []rbac.PolicyRule {
+	var out []rbac.PolicyRule
+	for _, verb := range rule.Verbs {
+		for _, u := range rule.NonResourceURLs {
+			out = append(out, rbac.PolicyRule{Verbs: []string{verb}, NonResourceURLs: []string{u}})
+		}
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				out = append(out, rbac.PolicyRule{
+					Verbs:         []string{verb},
+					APIGroups:     []string{group},
+					Resources:     []string{resource},
+					ResourceNames: rule.ResourceNames,
+				})
+			}
+		}
+	}
+	return out
+}
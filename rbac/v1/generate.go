@@ -0,0 +1,204 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GenerateRules returns the minimal rules that allow the given requests. Resource names are ignored, so
+// the generated rules allow the requests for any object. Resources of the same api group that use the
+// same verbs are combined into a single rule.
+func GenerateRules(reqs []Request) []rbac.PolicyRule {
+	type resourceKey struct {
+		group    string
+		resource string
+	}
+	resourceVerbs := map[resourceKey]map[string]bool{}
+	urlVerbs := map[string]map[string]bool{}
+	for _, req := range reqs {
+		if req.Verb == "" {
+			continue
+		}
+		if req.NonResourceURL != "" {
+			if urlVerbs[req.NonResourceURL] == nil {
+				urlVerbs[req.NonResourceURL] = map[string]bool{}
+			}
+			urlVerbs[req.NonResourceURL][req.Verb] = true
+			continue
+		}
+		if req.Resource == "" {
+			continue
+		}
+		key := resourceKey{group: req.APIGroup, resource: req.Resource}
+		if req.Subresource != "" {
+			key.resource += "/" + req.Subresource
+		}
+		if resourceVerbs[key] == nil {
+			resourceVerbs[key] = map[string]bool{}
+		}
+		resourceVerbs[key][req.Verb] = true
+	}
+
+	type ruleKey struct {
+		group string
+		verbs string
+	}
+	grouped := map[ruleKey][]string{}
+	for key, verbs := range resourceVerbs {
+		rk := ruleKey{group: key.group, verbs: strings.Join(sortedKeys(verbs), ",")}
+		grouped[rk] = append(grouped[rk], key.resource)
+	}
+	rules := make([]rbac.PolicyRule, 0, len(grouped))
+	for rk, resources := range grouped {
+		sort.Strings(resources)
+		rules = append(rules, rbac.PolicyRule{
+			APIGroups: []string{rk.group},
+			Resources: resources,
+			Verbs:     strings.Split(rk.verbs, ","),
+		})
+	}
+
+	groupedURLs := map[string][]string{}
+	for u, verbs := range urlVerbs {
+		vk := strings.Join(sortedKeys(verbs), ",")
+		groupedURLs[vk] = append(groupedURLs[vk], u)
+	}
+	for vk, urls := range groupedURLs {
+		sort.Strings(urls)
+		rules = append(rules, rbac.PolicyRule{
+			NonResourceURLs: urls,
+			Verbs:           strings.Split(vk, ","),
+		})
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return ruleSortKey(rules[i]) < ruleSortKey(rules[j])
+	})
+	return rules
+}
+
+func sortedKeys(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func ruleSortKey(rule rbac.PolicyRule) string {
+	if len(rule.NonResourceURLs) > 0 {
+		// non resource rules sort after the resource rules
+		return "~" + strings.Join(rule.NonResourceURLs, ",")
+	}
+	return strings.Join(rule.APIGroups, ",") + "/" + strings.Join(rule.Resources, ",")
+}
+
+// GenerateClusterRole returns a ClusterRole that allows the given requests in any namespace.
+func GenerateClusterRole(name string, reqs []Request) *rbac.ClusterRole {
+	return &rbac.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbac.SchemeGroupVersion.String(),
+			Kind:       "ClusterRole",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Rules:      GenerateRules(reqs),
+	}
+}
+
+// GenerateRoles returns a ClusterRole for the cluster scoped requests, the non resource requests and the
+// requests made across all namespaces, and a Role per namespace for the rest. The ClusterRole is nil if
+// every request is namespaced. Roles are sorted by namespace.
+func GenerateRoles(name string, reqs []Request) (*rbac.ClusterRole, []*rbac.Role) {
+	var clusterReqs []Request
+	nsReqs := map[string][]Request{}
+	for _, req := range reqs {
+		if req.Namespace == "" || req.NonResourceURL != "" {
+			clusterReqs = append(clusterReqs, req)
+		} else {
+			nsReqs[req.Namespace] = append(nsReqs[req.Namespace], req)
+		}
+	}
+
+	var cr *rbac.ClusterRole
+	if len(clusterReqs) > 0 {
+		cr = GenerateClusterRole(name, clusterReqs)
+	}
+
+	namespaces := make([]string, 0, len(nsReqs))
+	for ns := range nsReqs {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	roles := make([]*rbac.Role, 0, len(namespaces))
+	for _, ns := range namespaces {
+		roles = append(roles, &rbac.Role{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: rbac.SchemeGroupVersion.String(),
+				Kind:       "Role",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Rules: GenerateRules(nsReqs[ns]),
+		})
+	}
+	return cr, roles
+}
+
+// MergeRules returns the existing rules followed by the minimal rules for the generated permissions that
+// the existing rules do not grant yet. Existing rules are never removed or narrowed, so a hand written
+// rule with wildcards or resource names is kept as is.
+func MergeRules(existing, generated []rbac.PolicyRule) []rbac.PolicyRule {
+	out := make([]rbac.PolicyRule, 0, len(existing))
+	out = append(out, existing...)
+
+	var missing []Request
+	for _, rule := range generated {
+		if len(rule.ResourceNames) > 0 || hasWildcard(rule) {
+			// such rules can not be compacted, so they are only deduplicated
+			if !slices.ContainsFunc(out, func(r rbac.PolicyRule) bool { return ruleEqual(r, rule) }) {
+				out = append(out, rule)
+			}
+			continue
+		}
+		for _, atom := range atomize(rule) {
+			if req := atomRequest(atom); !anyRuleAllows(existing, req) {
+				missing = append(missing, req)
+			}
+		}
+	}
+	return append(out, GenerateRules(missing)...)
+}
+
+func atomRequest(atom rbac.PolicyRule) Request {
+	req := Request{Verb: atom.Verbs[0]}
+	if len(atom.NonResourceURLs) > 0 {
+		req.NonResourceURL = atom.NonResourceURLs[0]
+		return req
+	}
+	req.APIGroup = atom.APIGroups[0]
+	req.Resource, req.Subresource, _ = strings.Cut(atom.Resources[0], "/")
+	return req
+}
@@ -0,0 +1,82 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"reflect"
+	"testing"
+
+	rbac "k8s.io/api/rbac/v1"
+)
+
+func TestGenerateRoles(t *testing.T) {
+	reqs := []Request{
+		{Verb: "list", APIGroup: "apps", Resource: "deployments"},
+		{Verb: "watch", APIGroup: "apps", Resource: "deployments"},
+		{Verb: "list", APIGroup: "apps", Resource: "statefulsets"},
+		{Verb: "watch", APIGroup: "apps", Resource: "statefulsets"},
+		{Verb: "get", Resource: "secrets", Name: "foo", Namespace: "demo"},
+		{Verb: "update", APIGroup: "apps", Resource: "deployments", Subresource: "status", Namespace: "demo"},
+		{Verb: "get", NonResourceURL: "/metrics"},
+	}
+
+	cr, roles := GenerateRoles("operator", reqs)
+	want := []rbac.PolicyRule{
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments", "statefulsets"}, Verbs: []string{"list", "watch"}},
+		{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}},
+	}
+	if cr == nil || !reflect.DeepEqual(cr.Rules, want) {
+		t.Fatalf("unexpected ClusterRole rules %+v", cr)
+	}
+	if len(roles) != 1 || roles[0].Namespace != "demo" || roles[0].Name != "operator" {
+		t.Fatalf("unexpected Roles %+v", roles)
+	}
+	want = []rbac.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments/status"}, Verbs: []string{"update"}},
+	}
+	if !reflect.DeepEqual(roles[0].Rules, want) {
+		t.Errorf("unexpected Role rules %+v", roles[0].Rules)
+	}
+	if diff := DiffRules(append(cr.Rules, roles[0].Rules...), reqs); len(diff.Missing) > 0 {
+		t.Errorf("generated rules do not allow %v", diff.Missing)
+	}
+}
+
+func TestMergeRules(t *testing.T) {
+	existing := []rbac.PolicyRule{
+		{APIGroups: []string{"apps"}, Resources: []string{"*"}, Verbs: []string{"get", "list"}},
+	}
+	generated := GenerateRules([]Request{
+		{Verb: "list", APIGroup: "apps", Resource: "deployments"},
+		{Verb: "watch", APIGroup: "apps", Resource: "deployments"},
+		{Verb: "create", Resource: "events"},
+	})
+
+	got := MergeRules(existing, generated)
+	want := []rbac.PolicyRule{
+		existing[0],
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"watch"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+	if got := MergeRules(want, generated); !reflect.DeepEqual(got, want) {
+		t.Errorf("merge is not idempotent, got %+v", got)
+	}
+}
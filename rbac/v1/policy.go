@@ -0,0 +1,407 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"kmodules.xyz/client-go/tools/parser"
+
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Request describes an API request to authorize. NonResourceURL is used for requests
+// that are not for a resource, eg, /healthz.
+type Request struct {
+	Verb           string `json:"verb"`
+	APIGroup       string `json:"apiGroup,omitempty"`
+	Resource       string `json:"resource,omitempty"`
+	Subresource    string `json:"subresource,omitempty"`
+	Name           string `json:"name,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	NonResourceURL string `json:"nonResourceURL,omitempty"`
+}
+
+func (r Request) String() string {
+	if r.NonResourceURL != "" {
+		return fmt.Sprintf("%s %s", r.Verb, r.NonResourceURL)
+	}
+	resource := r.Resource
+	if r.Subresource != "" {
+		resource += "/" + r.Subresource
+	}
+	if r.APIGroup != "" {
+		resource += "." + r.APIGroup
+	}
+	out := r.Verb + " " + resource
+	if r.Name != "" {
+		out += " " + r.Name
+	}
+	if r.Namespace != "" {
+		out += " in namespace " + r.Namespace
+	}
+	return out
+}
+
+// Policy evaluates RBAC permissions in process from a set of Roles, ClusterRoles and their bindings.
+type Policy struct {
+	roles               map[string]*rbac.Role
+	clusterRoles        map[string]*rbac.ClusterRole
+	roleBindings        []rbac.RoleBinding
+	clusterRoleBindings []rbac.ClusterRoleBinding
+}
+
+// NewPolicy returns a Policy for the given Roles, ClusterRoles, RoleBindings, ClusterRoleBindings and their lists.
+// Rules of aggregated ClusterRoles are computed from the matching ClusterRoles.
+func NewPolicy(objs ...runtime.Object) (*Policy, error) {
+	p := &Policy{
+		roles:        map[string]*rbac.Role{},
+		clusterRoles: map[string]*rbac.ClusterRole{},
+	}
+	for _, obj := range objs {
+		if err := p.add(obj); err != nil {
+			return nil, err
+		}
+	}
+	p.aggregate()
+	return p, nil
+}
+
+func (p *Policy) add(obj runtime.Object) error {
+	switch o := obj.(type) {
+	case *rbac.Role:
+		p.roles[o.Namespace+"/"+o.Name] = o.DeepCopy()
+	case *rbac.ClusterRole:
+		p.clusterRoles[o.Name] = o.DeepCopy()
+	case *rbac.RoleBinding:
+		p.roleBindings = append(p.roleBindings, *o.DeepCopy())
+	case *rbac.ClusterRoleBinding:
+		p.clusterRoleBindings = append(p.clusterRoleBindings, *o.DeepCopy())
+	case *rbac.RoleList:
+		for i := range o.Items {
+			if err := p.add(&o.Items[i]); err != nil {
+				return err
+			}
+		}
+	case *rbac.ClusterRoleList:
+		for i := range o.Items {
+			if err := p.add(&o.Items[i]); err != nil {
+				return err
+			}
+		}
+	case *rbac.RoleBindingList:
+		for i := range o.Items {
+			if err := p.add(&o.Items[i]); err != nil {
+				return err
+			}
+		}
+	case *rbac.ClusterRoleBindingList:
+		for i := range o.Items {
+			if err := p.add(&o.Items[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported object of type %T", obj)
+	}
+	return nil
+}
+
+// aggregate replaces the rules of a ClusterRole with an aggregation rule by the union of the rules of
+// the ClusterRoles it selects, as the clusterrole-aggregation controller does. Aggregated ClusterRoles
+// can select other aggregated ClusterRoles, eg, admin <- edit <- view, so it is repeated until no rule
+// changes. A chain is never longer than the number of ClusterRoles, which bounds selection cycles.
+func (p *Policy) aggregate() {
+	for i, changed := 0, true; changed && i <= len(p.clusterRoles); i++ {
+		changed = false
+		for _, cr := range p.sortedClusterRoles() {
+			if cr.AggregationRule == nil {
+				continue
+			}
+			var rules []rbac.PolicyRule
+			for _, term := range cr.AggregationRule.ClusterRoleSelectors {
+				sel, err := metav1.LabelSelectorAsSelector(&term)
+				if err != nil {
+					continue
+				}
+				for _, other := range p.sortedClusterRoles() {
+					if other.Name == cr.Name || !sel.Matches(labels.Set(other.Labels)) {
+						continue
+					}
+					for _, r := range other.Rules {
+						if !slices.ContainsFunc(rules, func(x rbac.PolicyRule) bool { return ruleEqual(x, r) }) {
+							rules = append(rules, r)
+						}
+					}
+				}
+			}
+			if !slices.EqualFunc(cr.Rules, rules, ruleEqual) {
+				cr.Rules = rules
+				changed = true
+			}
+		}
+	}
+}
+
+func (p *Policy) sortedClusterRoles() []*rbac.ClusterRole {
+	out := make([]*rbac.ClusterRole, 0, len(p.clusterRoles))
+	for _, cr := range p.clusterRoles {
+		out = append(out, cr)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func ruleEqual(a, b rbac.PolicyRule) bool {
+	return slices.Equal(a.Verbs, b.Verbs) &&
+		slices.Equal(a.APIGroups, b.APIGroups) &&
+		slices.Equal(a.Resources, b.Resources) &&
+		slices.Equal(a.ResourceNames, b.ResourceNames) &&
+		slices.Equal(a.NonResourceURLs, b.NonResourceURLs)
+}
+
+// LoadPolicy reads all the Roles, ClusterRoles and bindings of a cluster.
+func LoadPolicy(ctx context.Context, c client.Reader) (*Policy, error) {
+	var roles rbac.RoleList
+	if err := c.List(ctx, &roles); err != nil {
+		return nil, err
+	}
+	var clusterRoles rbac.ClusterRoleList
+	if err := c.List(ctx, &clusterRoles); err != nil {
+		return nil, err
+	}
+	var roleBindings rbac.RoleBindingList
+	if err := c.List(ctx, &roleBindings); err != nil {
+		return nil, err
+	}
+	var clusterRoleBindings rbac.ClusterRoleBindingList
+	if err := c.List(ctx, &clusterRoleBindings); err != nil {
+		return nil, err
+	}
+	return NewPolicy(&roles, &clusterRoles, &roleBindings, &clusterRoleBindings)
+}
+
+// ParsePolicy reads the Roles, ClusterRoles and bindings from YAML or JSON manifests. Other objects are ignored.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var objs []runtime.Object
+	err := parser.ProcessResources(data, func(ri parser.ResourceInfo) error {
+		if ri.Object.GroupVersionKind().Group != rbac.GroupName {
+			return nil
+		}
+		var obj runtime.Object
+		switch ri.Object.GetKind() {
+		case "Role":
+			obj = &rbac.Role{}
+		case "ClusterRole":
+			obj = &rbac.ClusterRole{}
+		case "RoleBinding":
+			obj = &rbac.RoleBinding{}
+		case "ClusterRoleBinding":
+			obj = &rbac.ClusterRoleBinding{}
+		default:
+			return nil
+		}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(ri.Object.UnstructuredContent(), obj); err != nil {
+			return err
+		}
+		objs = append(objs, obj)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewPolicy(objs...)
+}
+
+// Can returns true if the subject is allowed to make the request. Users and ServiceAccounts also get the
+// permissions bound to system:authenticated, and ServiceAccounts the permissions bound to their groups.
+func (p *Policy) Can(subject rbac.Subject, req Request) bool {
+	for _, rule := range p.RulesFor(subject, req.Namespace) {
+		if RuleAllows(rule, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// WhoCan returns the subjects bound to a role that allows the request, sorted by kind, namespace and name.
+func (p *Policy) WhoCan(req Request) []rbac.Subject {
+	var out []rbac.Subject
+	add := func(subjects []rbac.Subject, namespace string) {
+		for _, s := range subjects {
+			if s.Kind == rbac.ServiceAccountKind && s.Namespace == "" {
+				s.Namespace = namespace
+			}
+			out = UpsertSubjects(out, s)
+		}
+	}
+	for _, b := range p.clusterRoleBindings {
+		if anyRuleAllows(p.roleRefRules("", b.RoleRef), req) {
+			add(b.Subjects, "")
+		}
+	}
+	for _, b := range p.roleBindings {
+		if req.NonResourceURL != "" || b.Namespace != req.Namespace {
+			continue
+		}
+		if anyRuleAllows(p.roleRefRules(b.Namespace, b.RoleRef), req) {
+			add(b.Subjects, b.Namespace)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Kind != out[j].Kind {
+			return out[i].Kind < out[j].Kind
+		}
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// RulesFor returns the rules that apply to the subject in the namespace. An empty namespace
+// returns only the cluster wide rules.
+func (p *Policy) RulesFor(subject rbac.Subject, namespace string) []rbac.PolicyRule {
+	var rules []rbac.PolicyRule
+	for _, b := range p.clusterRoleBindings {
+		if bindingApplies(b.Subjects, "", subject) {
+			rules = append(rules, p.roleRefRules("", b.RoleRef)...)
+		}
+	}
+	if namespace == "" {
+		return rules
+	}
+	for _, b := range p.roleBindings {
+		if b.Namespace == namespace && bindingApplies(b.Subjects, b.Namespace, subject) {
+			rules = append(rules, p.roleRefRules(b.Namespace, b.RoleRef)...)
+		}
+	}
+	return rules
+}
+
+func (p *Policy) roleRefRules(namespace string, ref rbac.RoleRef) []rbac.PolicyRule {
+	switch ref.Kind {
+	case "ClusterRole":
+		if cr, ok := p.clusterRoles[ref.Name]; ok {
+			return cr.Rules
+		}
+	case "Role":
+		if r, ok := p.roles[namespace+"/"+ref.Name]; ok {
+			return r.Rules
+		}
+	}
+	return nil
+}
+
+func bindingApplies(subjects []rbac.Subject, bindingNamespace string, who rbac.Subject) bool {
+	groups := map[string]bool{}
+	switch who.Kind {
+	case rbac.ServiceAccountKind:
+		groups["system:serviceaccounts"] = true
+		groups["system:serviceaccounts:"+who.Namespace] = true
+		groups["system:authenticated"] = true
+	case rbac.UserKind:
+		groups["system:authenticated"] = true
+	}
+
+	for _, s := range subjects {
+		switch s.Kind {
+		case rbac.ServiceAccountKind:
+			ns := s.Namespace
+			if ns == "" {
+				ns = bindingNamespace
+			}
+			if who.Kind == rbac.ServiceAccountKind && who.Name == s.Name && who.Namespace == ns {
+				return true
+			}
+		case rbac.UserKind:
+			if who.Kind == rbac.UserKind && who.Name == s.Name {
+				return true
+			}
+			if who.Kind == rbac.ServiceAccountKind && s.Name == "system:serviceaccount:"+who.Namespace+":"+who.Name {
+				return true
+			}
+		case rbac.GroupKind:
+			if (who.Kind == rbac.GroupKind && who.Name == s.Name) || groups[s.Name] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func anyRuleAllows(rules []rbac.PolicyRule, req Request) bool {
+	for _, r := range rules {
+		if RuleAllows(r, req) {
+			return true
+		}
+	}
+	return false
+}
+
+// RuleAllows returns true if the rule allows the request.
+func RuleAllows(rule rbac.PolicyRule, req Request) bool {
+	if !matches(rule.Verbs, req.Verb) {
+		return false
+	}
+	if req.NonResourceURL != "" {
+		for _, u := range rule.NonResourceURLs {
+			if u == rbac.NonResourceAll || u == req.NonResourceURL ||
+				(strings.HasSuffix(u, "*") && strings.HasPrefix(req.NonResourceURL, strings.TrimSuffix(u, "*"))) {
+				return true
+			}
+		}
+		return false
+	}
+	if !matches(rule.APIGroups, req.APIGroup) {
+		return false
+	}
+	if !resourceMatches(rule.Resources, req.Resource, req.Subresource) {
+		return false
+	}
+	return len(rule.ResourceNames) == 0 || (req.Name != "" && slices.Contains(rule.ResourceNames, req.Name))
+}
+
+func matches(values []string, v string) bool {
+	return slices.Contains(values, "*") || slices.Contains(values, v)
+}
+
+func resourceMatches(resources []string, resource, subresource string) bool {
+	combined := resource
+	if subresource != "" {
+		combined += "/" + subresource
+	}
+	for _, r := range resources {
+		if r == rbac.ResourceAll || r == combined {
+			return true
+		}
+		// */subresource matches the subresource of any resource
+		if subresource != "" && r == "*/"+subresource {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,266 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const manifests = `
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: view
+aggregationRule:
+  clusterRoleSelectors:
+  - matchLabels:
+      rbac.example.com/aggregate-to-view: "true"
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: foo-view
+  labels:
+    rbac.example.com/aggregate-to-view: "true"
+rules:
+- apiGroups: ["example.com"]
+  resources: ["foos"]
+  verbs: ["get", "list", "watch"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: viewers
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: Group
+  name: viewers
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: operator
+  namespace: demo
+rules:
+- apiGroups: [""]
+  resources: ["secrets"]
+  resourceNames: ["operator-token"]
+  verbs: ["get"]
+- apiGroups: ["apps"]
+  resources: ["deployments", "deployments/status"]
+  verbs: ["*"]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: operator
+  namespace: demo
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: operator
+subjects:
+- kind: ServiceAccount
+  name: operator
+- kind: User
+  name: alice
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+var (
+	operator = rbac.Subject{Kind: rbac.ServiceAccountKind, Name: "operator", Namespace: "demo"}
+	alice    = rbac.Subject{Kind: rbac.UserKind, Name: "alice"}
+	viewers  = rbac.Subject{Kind: rbac.GroupKind, Name: "viewers"}
+)
+
+func TestPolicyCan(t *testing.T) {
+	p, err := ParsePolicy([]byte(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		subject rbac.Subject
+		req     Request
+		want    bool
+	}{
+		{"aggregated rule", viewers, Request{Verb: "list", APIGroup: "example.com", Resource: "foos", Namespace: "other"}, true},
+		{"aggregated rule verb", viewers, Request{Verb: "delete", APIGroup: "example.com", Resource: "foos"}, false},
+		{"resource name", operator, Request{Verb: "get", Resource: "secrets", Name: "operator-token", Namespace: "demo"}, true},
+		{"other resource name", operator, Request{Verb: "get", Resource: "secrets", Name: "other", Namespace: "demo"}, false},
+		{"list with resource names", operator, Request{Verb: "list", Resource: "secrets", Namespace: "demo"}, false},
+		{"wildcard verb", operator, Request{Verb: "patch", APIGroup: "apps", Resource: "deployments", Namespace: "demo"}, true},
+		{"subresource", operator, Request{Verb: "update", APIGroup: "apps", Resource: "deployments", Subresource: "status", Namespace: "demo"}, true},
+		{"other subresource", operator, Request{Verb: "update", APIGroup: "apps", Resource: "deployments", Subresource: "scale", Namespace: "demo"}, false},
+		{"other namespace", operator, Request{Verb: "get", APIGroup: "apps", Resource: "deployments", Namespace: "default"}, false},
+		{"user", alice, Request{Verb: "get", APIGroup: "apps", Resource: "deployments", Namespace: "demo"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Can(tt.subject, tt.req); got != tt.want {
+				t.Errorf("Can(%s, %s) = %v, want %v", tt.subject.Name, tt.req, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyWhoCan(t *testing.T) {
+	p, err := ParsePolicy([]byte(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := p.WhoCan(Request{Verb: "delete", APIGroup: "apps", Resource: "deployments", Namespace: "demo"})
+	want := []rbac.Subject{operator, alice}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestPolicyNestedAggregation(t *testing.T) {
+	aggregated := func(name, label string, aggregateTo ...string) *rbac.ClusterRole {
+		cr := &rbac.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{}},
+		}
+		if label != "" {
+			cr.AggregationRule = &rbac.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{
+				{MatchLabels: map[string]string{label: "true"}},
+			}}
+		}
+		for _, to := range aggregateTo {
+			cr.Labels["rbac.example.com/aggregate-to-"+to] = "true"
+		}
+		return cr
+	}
+	fooReader := aggregated("foo-reader", "", "view")
+	fooReader.Rules = []rbac.PolicyRule{{APIGroups: []string{"example.com"}, Resources: []string{"foos"}, Verbs: []string{"get"}}}
+
+	p, err := NewPolicy(
+		// admin <- edit <- view <- foo-reader, sorted so that a single pass misses the chain
+		aggregated("admin", "rbac.example.com/aggregate-to-admin"),
+		aggregated("edit", "rbac.example.com/aggregate-to-edit", "admin"),
+		aggregated("view", "rbac.example.com/aggregate-to-view", "edit"),
+		fooReader,
+		&rbac.ClusterRoleBindingList{Items: []rbac.ClusterRoleBinding{{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin"},
+			RoleRef:    rbac.RoleRef{Kind: "ClusterRole", Name: "admin"},
+			Subjects:   []rbac.Subject{alice},
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Can(alice, Request{Verb: "get", APIGroup: "example.com", Resource: "foos"}) {
+		t.Errorf("expected admin to include the rules aggregated to view")
+	}
+}
+
+func TestPolicyAggregationReplacesRules(t *testing.T) {
+	fooView := &rbac.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo-view", Labels: map[string]string{"rbac.example.com/aggregate-to-view": "true"}},
+		Rules:      []rbac.PolicyRule{{APIGroups: []string{"example.com"}, Resources: []string{"foos"}, Verbs: []string{"get"}}},
+	}
+	view := &rbac.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: "view"},
+		AggregationRule: &rbac.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{
+			{MatchLabels: map[string]string{"rbac.example.com/aggregate-to-view": "true"}},
+		}},
+		// stale rules are overwritten by the clusterrole-aggregation controller
+		Rules: []rbac.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}},
+	}
+	p, err := NewPolicy(fooView, view, &rbac.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "viewers"},
+		RoleRef:    rbac.RoleRef{Kind: "ClusterRole", Name: "view"},
+		Subjects:   []rbac.Subject{viewers},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Can(viewers, Request{Verb: "get", APIGroup: "example.com", Resource: "foos"}) {
+		t.Errorf("expected view to include the rules aggregated to it")
+	}
+	if p.Can(viewers, Request{Verb: "get", Resource: "secrets", Namespace: "demo"}) {
+		t.Errorf("expected the stale rules of view to be replaced")
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := rbac.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&rbac.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+			Rules:      []rbac.PolicyRule{{APIGroups: []string{""}, Resources: []string{"nodes"}, Verbs: []string{"get"}}},
+		},
+		&rbac.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "nodes"},
+			RoleRef:    rbac.RoleRef{Kind: "ClusterRole", Name: "nodes"},
+			Subjects:   []rbac.Subject{operator},
+		},
+	).Build()
+	p, err := LoadPolicy(context.TODO(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Can(operator, Request{Verb: "get", Resource: "nodes"}) {
+		t.Errorf("expected operator to get nodes")
+	}
+}
+
+func TestDiffRules(t *testing.T) {
+	granted := []rbac.PolicyRule{
+		{APIGroups: []string{""}, Resources: []string{"configmaps", "secrets"}, Verbs: []string{"get", "list"}},
+		{APIGroups: []string{"apps"}, Resources: []string{"*"}, Verbs: []string{"get"}},
+		{APIGroups: []string{"batch"}, Resources: []string{"*"}, Verbs: []string{"*"}},
+	}
+	used := []Request{
+		{Verb: "get", Resource: "configmaps"},
+		{Verb: "list", Resource: "configmaps"},
+		{Verb: "get", APIGroup: "apps", Resource: "deployments"},
+		{Verb: "create", Resource: "events"},
+		{Verb: "create", Resource: "events"},
+	}
+	diff := DiffRules(granted, used)
+	if len(diff.Missing) != 1 || diff.Missing[0].Resource != "events" {
+		t.Errorf("unexpected missing requests: %v", diff.Missing)
+	}
+	if len(diff.Unused) != 3 {
+		t.Errorf("expected get/list secrets and the batch rule to be unused, got %v", diff.Unused)
+	}
+	if len(diff.Wildcards) != 1 || diff.Wildcards[0].APIGroups[0] != "apps" {
+		t.Errorf("unexpected wildcard rules: %v", diff.Wildcards)
+	}
+	if diff.Empty() {
+		t.Errorf("expected a non empty diff")
+	}
+}
@@ -0,0 +1,502 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cabundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+
+	admissionregistration "kmodules.xyz/client-go/admissionregistration/v1"
+	apiextensions "kmodules.xyz/client-go/apiextensions/v1"
+	apiregistration "kmodules.xyz/client-go/apiregistration/v1"
+
+	reg "k8s.io/api/admissionregistration/v1"
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	crd_cs "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+	apiregv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	apireg_cs "k8s.io/kube-aggregator/pkg/client/clientset_generated/clientset"
+)
+
+// TargetKind is the kind of object a CA bundle is injected into.
+type TargetKind string
+
+const (
+	ValidatingWebhookConfiguration TargetKind = "ValidatingWebhookConfiguration"
+	MutatingWebhookConfiguration   TargetKind = "MutatingWebhookConfiguration"
+	APIService                     TargetKind = "APIService"
+	// CustomResourceDefinition targets the caBundle of the conversion webhook.
+	CustomResourceDefinition TargetKind = "CustomResourceDefinition"
+)
+
+// Target selects the objects of a kind by name or by label selector.
+type Target struct {
+	Kind     TargetKind
+	Name     string
+	Selector labels.Selector
+}
+
+// ByName returns a Target for the named object.
+func ByName(kind TargetKind, name string) Target {
+	return Target{Kind: kind, Name: name}
+}
+
+// BySelector returns a Target for the objects matching the label selector.
+func BySelector(kind TargetKind, selector labels.Selector) Target {
+	return Target{Kind: kind, Selector: selector}
+}
+
+func (t Target) String() string {
+	if t.Name != "" {
+		return fmt.Sprintf("%s %s", t.Kind, t.Name)
+	}
+	return fmt.Sprintf("%s with labels %q", t.Kind, t.Selector)
+}
+
+func (t Target) listOptions() metav1.ListOptions {
+	if t.Selector == nil {
+		return metav1.ListOptions{}
+	}
+	return metav1.ListOptions{LabelSelector: t.Selector.String()}
+}
+
+// Clients are used to update the targets. Only the clients for the kinds of the targets are required.
+type Clients struct {
+	Kubernetes      kubernetes.Interface
+	APIRegistration apireg_cs.Interface
+	APIExtensions   crd_cs.Interface
+}
+
+// ClientsForConfig creates all the Clients for a rest config.
+func ClientsForConfig(config *rest.Config) (*Clients, error) {
+	kc, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	ac, err := apireg_cs.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := crd_cs.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Clients{Kubernetes: kc, APIRegistration: ac, APIExtensions: cc}, nil
+}
+
+const DefaultResyncPeriod = 5 * time.Minute
+
+type options struct {
+	overlap time.Duration
+	resync  time.Duration
+	now     func() time.Time
+}
+
+// Option configures an Injector.
+type Option func(*options)
+
+// WithOverlap keeps the previous CA certificates in the injected bundle for the given duration after the
+// source CA changes, so that clients trust both the old and the new serving certificates during a rotation.
+// Unexpired certificates found in the caBundle of a target, eg, injected before the Injector was restarted,
+// are kept for the same duration from the time they are first seen.
+func WithOverlap(d time.Duration) Option {
+	return func(o *options) {
+		o.overlap = d
+	}
+}
+
+// WithResyncPeriod sets how often the targets are checked, eg, to inject into newly created objects.
+// Defaults to DefaultResyncPeriod.
+func WithResyncPeriod(d time.Duration) Option {
+	return func(o *options) {
+		o.resync = d
+	}
+}
+
+type retiredCA struct {
+	cert     *x509.Certificate
+	retireAt time.Time
+}
+
+// Injector keeps the caBundle of webhook configurations, APIServices and CRD conversion webhooks
+// in sync with a CA Source.
+type Injector struct {
+	clients *Clients
+	source  Source
+	targets []Target
+	opts    options
+
+	mu      sync.Mutex
+	current []byte
+	retired []retiredCA
+}
+
+// NewInjector returns an Injector that injects the CA of the source into the targets.
+func NewInjector(clients *Clients, source Source, targets []Target, opts ...Option) *Injector {
+	o := options{resync: DefaultResyncPeriod, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Injector{
+		clients: clients,
+		source:  source,
+		targets: targets,
+		opts:    o,
+	}
+}
+
+// Run injects the CA bundle into the targets whenever the source changes and on every resync, until the
+// context is done.
+func (i *Injector) Run(ctx context.Context) error {
+	trigger := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		if err := i.source.Watch(ctx, notify); err != nil {
+			klog.Errorf("failed to watch CA source: %v", err)
+		}
+	}()
+
+	ticker := time.NewTicker(i.opts.resync)
+	defer ticker.Stop()
+	for {
+		if err := i.Inject(ctx); err != nil {
+			klog.Errorf("failed to inject CA bundle: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-trigger:
+		case <-ticker.C:
+		}
+	}
+}
+
+// Inject reads the source and updates every target whose caBundle is out of date.
+func (i *Injector) Inject(ctx context.Context) error {
+	data, err := i.source.CABundle(ctx)
+	if err != nil {
+		return err
+	}
+	bundle, err := i.Bundle(data)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, t := range i.targets {
+		if err := i.inject(ctx, t, bundle); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", t, err))
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// Bundle returns the PEM encoded CA bundle for the given source data. When the data changed since the
+// last call, the certificates of the previous CA are kept for the overlap duration. Expired certificates
+// are dropped.
+func (i *Injector) Bundle(data []byte) ([]byte, error) {
+	certs, err := parseCerts(data)
+	if err != nil {
+		return nil, err
+	}
+	now := i.opts.now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.current != nil && !bytes.Equal(i.current, data) && i.opts.overlap > 0 {
+		prev, _ := parseCerts(i.current)
+		for _, c := range prev {
+			i.retired = append(i.retired, retiredCA{cert: c, retireAt: now.Add(i.opts.overlap)})
+		}
+	}
+	i.current = data
+
+	var buf bytes.Buffer
+	seen := map[string]bool{}
+	write := func(c *x509.Certificate) {
+		if seen[string(c.Raw)] || now.After(c.NotAfter) {
+			return
+		}
+		seen[string(c.Raw)] = true
+		_ = pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+	}
+	for _, c := range certs {
+		write(c)
+	}
+	retired := i.retired[:0]
+	for _, r := range i.retired {
+		if now.Before(r.retireAt) {
+			write(r.cert)
+		}
+		// remembered until it expires, so that merge does not keep it again when found in a target
+		if now.Before(r.cert.NotAfter) {
+			retired = append(retired, r)
+		}
+	}
+	i.retired = retired
+	if buf.Len() == 0 {
+		return nil, fmt.Errorf("CA source has no valid certificates")
+	}
+	return buf.Bytes(), nil
+}
+
+// merge appends the certificates of the existing caBundle of a target that are not in the bundle to it,
+// as long as they are unexpired and within the overlap duration since they were first seen.
+func (i *Injector) merge(existing, bundle []byte) []byte {
+	if i.opts.overlap <= 0 || len(existing) == 0 || bytes.Equal(existing, bundle) {
+		return bundle
+	}
+	prev, err := parseCerts(existing)
+	if err != nil {
+		return bundle
+	}
+	certs, err := parseCerts(bundle)
+	if err != nil {
+		return bundle
+	}
+	now := i.opts.now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	seen := map[string]bool{}
+	for _, c := range certs {
+		seen[string(c.Raw)] = true
+	}
+	buf := bytes.NewBuffer(append([]byte(nil), bundle...))
+	for _, c := range prev {
+		if seen[string(c.Raw)] || now.After(c.NotAfter) {
+			continue
+		}
+		seen[string(c.Raw)] = true
+
+		retireAt := now.Add(i.opts.overlap)
+		found := false
+		for _, r := range i.retired {
+			if bytes.Equal(r.cert.Raw, c.Raw) {
+				retireAt, found = r.retireAt, true
+				break
+			}
+		}
+		if !found {
+			i.retired = append(i.retired, retiredCA{cert: c, retireAt: retireAt})
+		}
+		if now.Before(retireAt) {
+			_ = pem.Encode(buf, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})
+		}
+	}
+	return buf.Bytes()
+}
+
+func parseCerts(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no certificates found in CA source")
+	}
+	return certs, nil
+}
+
+func (i *Injector) inject(ctx context.Context, t Target, bundle []byte) error {
+	switch t.Kind {
+	case ValidatingWebhookConfiguration:
+		if i.clients.Kubernetes == nil {
+			return fmt.Errorf("missing kubernetes client")
+		}
+		return i.injectValidatingWebhooks(ctx, t, bundle)
+	case MutatingWebhookConfiguration:
+		if i.clients.Kubernetes == nil {
+			return fmt.Errorf("missing kubernetes client")
+		}
+		return i.injectMutatingWebhooks(ctx, t, bundle)
+	case APIService:
+		if i.clients.APIRegistration == nil {
+			return fmt.Errorf("missing apiregistration client")
+		}
+		return i.injectAPIServices(ctx, t, bundle)
+	case CustomResourceDefinition:
+		if i.clients.APIExtensions == nil {
+			return fmt.Errorf("missing apiextensions client")
+		}
+		return i.injectCRDs(ctx, t, bundle)
+	}
+	return fmt.Errorf("unknown target kind %s", t.Kind)
+}
+
+func (i *Injector) injectValidatingWebhooks(ctx context.Context, t Target, bundle []byte) error {
+	c := i.clients.Kubernetes.AdmissionregistrationV1().ValidatingWebhookConfigurations()
+	var items []reg.ValidatingWebhookConfiguration
+	if t.Name != "" {
+		obj, err := c.Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		items = append(items, *obj)
+	} else {
+		list, err := c.List(ctx, t.listOptions())
+		if err != nil {
+			return err
+		}
+		items = list.Items
+	}
+
+	var errs []error
+	for idx := range items {
+		_, _, err := admissionregistration.PatchValidatingWebhookConfiguration(ctx, i.clients.Kubernetes, &items[idx], func(in *reg.ValidatingWebhookConfiguration) *reg.ValidatingWebhookConfiguration {
+			for w := range in.Webhooks {
+				in.Webhooks[w].ClientConfig.CABundle = i.merge(in.Webhooks[w].ClientConfig.CABundle, bundle)
+			}
+			return in
+		}, metav1.PatchOptions{})
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (i *Injector) injectMutatingWebhooks(ctx context.Context, t Target, bundle []byte) error {
+	c := i.clients.Kubernetes.AdmissionregistrationV1().MutatingWebhookConfigurations()
+	var items []reg.MutatingWebhookConfiguration
+	if t.Name != "" {
+		obj, err := c.Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		items = append(items, *obj)
+	} else {
+		list, err := c.List(ctx, t.listOptions())
+		if err != nil {
+			return err
+		}
+		items = list.Items
+	}
+
+	var errs []error
+	for idx := range items {
+		_, _, err := admissionregistration.PatchMutatingWebhookConfiguration(ctx, i.clients.Kubernetes, &items[idx], func(in *reg.MutatingWebhookConfiguration) *reg.MutatingWebhookConfiguration {
+			for w := range in.Webhooks {
+				in.Webhooks[w].ClientConfig.CABundle = i.merge(in.Webhooks[w].ClientConfig.CABundle, bundle)
+			}
+			return in
+		}, metav1.PatchOptions{})
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (i *Injector) injectAPIServices(ctx context.Context, t Target, bundle []byte) error {
+	c := i.clients.APIRegistration.ApiregistrationV1().APIServices()
+	var items []apiregv1.APIService
+	if t.Name != "" {
+		obj, err := c.Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		items = append(items, *obj)
+	} else {
+		list, err := c.List(ctx, t.listOptions())
+		if err != nil {
+			return err
+		}
+		items = list.Items
+	}
+
+	var errs []error
+	for idx := range items {
+		if items[idx].Spec.Service == nil {
+			// served locally by the kube-apiserver
+			continue
+		}
+		_, _, err := apiregistration.PatchAPIService(ctx, i.clients.APIRegistration, &items[idx], func(in *apiregv1.APIService) *apiregv1.APIService {
+			in.Spec.CABundle = i.merge(in.Spec.CABundle, bundle)
+			// caBundle can't be used together with insecureSkipTLSVerify
+			in.Spec.InsecureSkipTLSVerify = false
+			return in
+		}, metav1.PatchOptions{})
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+func (i *Injector) injectCRDs(ctx context.Context, t Target, bundle []byte) error {
+	c := i.clients.APIExtensions.ApiextensionsV1().CustomResourceDefinitions()
+	var items []crdv1.CustomResourceDefinition
+	if t.Name != "" {
+		obj, err := c.Get(ctx, t.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		items = append(items, *obj)
+	} else {
+		list, err := c.List(ctx, t.listOptions())
+		if err != nil {
+			return err
+		}
+		items = list.Items
+	}
+
+	var errs []error
+	for idx := range items {
+		conv := items[idx].Spec.Conversion
+		if conv == nil || conv.Webhook == nil || conv.Webhook.ClientConfig == nil {
+			if t.Name != "" {
+				errs = append(errs, fmt.Errorf("CustomResourceDefinition %s does not use a conversion webhook", t.Name))
+			}
+			continue
+		}
+		if bytes.Equal(conv.Webhook.ClientConfig.CABundle, i.merge(conv.Webhook.ClientConfig.CABundle, bundle)) {
+			continue
+		}
+		_, err := apiextensions.TryUpdateCustomResourceDefinition(ctx, i.clients.APIExtensions, items[idx].Name, func(in *crdv1.CustomResourceDefinition) *crdv1.CustomResourceDefinition {
+			if in.Spec.Conversion != nil && in.Spec.Conversion.Webhook != nil && in.Spec.Conversion.Webhook.ClientConfig != nil {
+				in.Spec.Conversion.Webhook.ClientConfig.CABundle = i.merge(in.Spec.Conversion.Webhook.ClientConfig.CABundle, bundle)
+			}
+			return in
+		}, metav1.UpdateOptions{})
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,225 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cabundle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	reg "k8s.io/api/admissionregistration/v1"
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	crdfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/cert"
+)
+
+func newCA(t *testing.T, name string) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cert.NewSelfSignedCACert(cert.Config{CommonName: name}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := cert.EncodeCertificates(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func countCerts(t *testing.T, bundle []byte) int {
+	t.Helper()
+	certs, err := parseCerts(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(certs)
+}
+
+func TestBundleOverlap(t *testing.T) {
+	oldCA, newCA := newCA(t, "old"), newCA(t, "new")
+	now := time.Now()
+	i := NewInjector(&Clients{}, nil, nil, WithOverlap(time.Hour))
+	i.opts.now = func() time.Time { return now }
+
+	bundle, err := i.Bundle(oldCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countCerts(t, bundle); n != 1 {
+		t.Fatalf("expected 1 certificate, got %d", n)
+	}
+
+	bundle, err = i.Bundle(newCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countCerts(t, bundle); n != 2 || !bytes.HasPrefix(bundle, newCA) {
+		t.Fatalf("expected the new CA followed by the old CA, got %d certificates", n)
+	}
+
+	now = now.Add(2 * time.Hour)
+	bundle, err = i.Bundle(newCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bundle, newCA) {
+		t.Fatalf("expected only the new CA after the overlap")
+	}
+
+	if _, err := i.Bundle([]byte("garbage")); err == nil {
+		t.Fatalf("expected an error for a source without certificates")
+	}
+}
+
+func TestInject(t *testing.T) {
+	ca := newCA(t, "ca")
+	ctx := context.TODO()
+
+	kc := fake.NewSimpleClientset(
+		&reg.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "validators", Labels: map[string]string{"app": "foo"}},
+			Webhooks:   []reg.ValidatingWebhook{{Name: "a.example.com"}, {Name: "b.example.com"}},
+		},
+		&reg.ValidatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "others"},
+			Webhooks:   []reg.ValidatingWebhook{{Name: "c.example.com"}},
+		},
+		&reg.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: "mutators"},
+			Webhooks:   []reg.MutatingWebhook{{Name: "m.example.com"}},
+		},
+	)
+	cc := crdfake.NewSimpleClientset(&crdv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "foos.example.com"},
+		Spec: crdv1.CustomResourceDefinitionSpec{
+			Conversion: &crdv1.CustomResourceConversion{
+				Strategy: crdv1.WebhookConverter,
+				Webhook: &crdv1.WebhookConversion{
+					ClientConfig: &crdv1.WebhookClientConfig{},
+				},
+			},
+		},
+	})
+
+	i := NewInjector(&Clients{Kubernetes: kc, APIExtensions: cc}, ConfigSource(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: ca}}), []Target{
+		BySelector(ValidatingWebhookConfiguration, labels.SelectorFromSet(labels.Set{"app": "foo"})),
+		ByName(MutatingWebhookConfiguration, "mutators"),
+		ByName(CustomResourceDefinition, "foos.example.com"),
+	})
+	if err := i.Inject(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	vwc, err := kc.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "validators", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range vwc.Webhooks {
+		if !bytes.Equal(w.ClientConfig.CABundle, ca) {
+			t.Errorf("webhook %s has no caBundle", w.Name)
+		}
+	}
+	others, err := kc.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, "others", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(others.Webhooks[0].ClientConfig.CABundle) != 0 {
+		t.Errorf("unselected webhook configuration must not be updated")
+	}
+	mwc, err := kc.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "mutators", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mwc.Webhooks[0].ClientConfig.CABundle, ca) {
+		t.Errorf("mutating webhook has no caBundle")
+	}
+	crd, err := cc.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, "foos.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(crd.Spec.Conversion.Webhook.ClientConfig.CABundle, ca) {
+		t.Errorf("conversion webhook has no caBundle")
+	}
+
+	if err := NewInjector(&Clients{}, ConfigSource(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: ca}}), []Target{
+		ByName(APIService, "v1.example.com"),
+	}).Inject(ctx); err == nil {
+		t.Errorf("expected an error for a missing apiregistration client")
+	}
+}
+
+func TestInjectKeepsCertificatesOfTarget(t *testing.T) {
+	oldCA, newCA := newCA(t, "old"), newCA(t, "new")
+	ctx := context.TODO()
+	now := time.Now()
+
+	kc := fake.NewSimpleClientset(&reg.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "mutators"},
+		Webhooks: []reg.MutatingWebhook{{
+			Name:         "m.example.com",
+			ClientConfig: reg.WebhookClientConfig{CABundle: oldCA},
+		}},
+	})
+	// a new Injector, eg, after a restart, does not know about the previous CA
+	i := NewInjector(&Clients{Kubernetes: kc}, ConfigSource(&rest.Config{TLSClientConfig: rest.TLSClientConfig{CAData: newCA}}), []Target{
+		ByName(MutatingWebhookConfiguration, "mutators"),
+	}, WithOverlap(time.Hour))
+	i.opts.now = func() time.Time { return now }
+
+	caBundle := func() []byte {
+		mwc, err := kc.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(ctx, "mutators", metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return mwc.Webhooks[0].ClientConfig.CABundle
+	}
+
+	if err := i.Inject(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := caBundle(); countCerts(t, got) != 2 || !bytes.HasPrefix(got, newCA) {
+		t.Fatalf("expected the new and the old CA, got\n%s", got)
+	}
+
+	now = now.Add(30 * time.Minute)
+	if err := i.Inject(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := countCerts(t, caBundle()); n != 2 {
+		t.Fatalf("expected the old CA to be kept within the overlap, got %d certificates", n)
+	}
+
+	now = now.Add(time.Hour)
+	if err := i.Inject(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := caBundle(); !bytes.Equal(got, newCA) {
+		t.Fatalf("expected only the new CA after the overlap, got\n%s", got)
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cabundle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	kutil "kmodules.xyz/client-go"
+	"kmodules.xyz/client-go/tools/fsnotify"
+
+	"github.com/pkg/errors"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// Source provides the CA certificates injected into the targets.
+type Source interface {
+	// CABundle returns the PEM encoded CA certificates.
+	CABundle(ctx context.Context) ([]byte, error)
+	// Watch calls notify whenever the CA changes, until the context is done.
+	Watch(ctx context.Context, notify func()) error
+}
+
+type configSource struct {
+	config *rest.Config
+}
+
+// ConfigSource returns a Source that reads the CA data or CA file of a rest config.
+// Changes of the CA file are watched like a FileSource. CA data set in the config never changes.
+func ConfigSource(config *rest.Config) Source {
+	return &configSource{config: config}
+}
+
+func (s *configSource) CABundle(_ context.Context) ([]byte, error) {
+	cfg := rest.CopyConfig(s.config)
+	if err := rest.LoadTLSFiles(cfg); err != nil {
+		return nil, err
+	}
+	return cfg.CAData, nil
+}
+
+func (s *configSource) Watch(ctx context.Context, notify func()) error {
+	if s.config.CAFile != "" {
+		return FileSource(s.config.CAFile).Watch(ctx, notify)
+	}
+	<-ctx.Done()
+	return nil
+}
+
+type fileSource struct {
+	filename string
+}
+
+// FileSource returns a Source that reads a PEM file. Changes are detected when the file is mounted
+// from a Secret or a ConfigMap volume, see fsnotify.Watcher.
+func FileSource(filename string) Source {
+	return &fileSource{filename: filename}
+}
+
+func (s *fileSource) CABundle(_ context.Context) ([]byte, error) {
+	return os.ReadFile(s.filename)
+}
+
+func (s *fileSource) Watch(ctx context.Context, notify func()) error {
+	w := fsnotify.Watcher{
+		WatchDir: filepath.Dir(s.filename),
+		Reload: func() error {
+			notify()
+			return nil
+		},
+	}
+	if err := w.Run(ctx.Done()); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+type secretSource struct {
+	kc        kubernetes.Interface
+	namespace string
+	name      string
+	key       string
+}
+
+// SecretSource returns a Source that reads the given key of a Secret. An empty key defaults to ca.crt.
+func SecretSource(kc kubernetes.Interface, namespace, name, key string) Source {
+	if key == "" {
+		key = core.ServiceAccountRootCAKey
+	}
+	return &secretSource{kc: kc, namespace: namespace, name: name, key: key}
+}
+
+func (s *secretSource) CABundle(ctx context.Context) ([]byte, error) {
+	secret, err := s.kc.CoreV1().Secrets(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	data, ok := secret.Data[s.key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s/%s has no key %s", s.namespace, s.name, s.key)
+	}
+	return data, nil
+}
+
+func (s *secretSource) Watch(ctx context.Context, notify func()) error {
+	lw := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.FieldSelector = fields.OneTermEqualSelector(kutil.ObjectNameField, s.name).String()
+			return s.kc.CoreV1().Secrets(s.namespace).List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.FieldSelector = fields.OneTermEqualSelector(kutil.ObjectNameField, s.name).String()
+			return s.kc.CoreV1().Secrets(s.namespace).Watch(ctx, options)
+		},
+	}
+	_, err := watchtools.UntilWithSync(ctx, lw, &core.Secret{}, nil, func(event watch.Event) (bool, error) {
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			notify()
+		case watch.Error:
+			return false, errors.New("error watching")
+		}
+		return false, nil // continue
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
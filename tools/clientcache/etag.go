@@ -0,0 +1,440 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+)
+
+const (
+	DefaultTTL        = 30 * time.Second
+	DefaultMaxEntries = 1000
+	DefaultMaxBytes   = 64 << 20
+)
+
+type cacheOptions struct {
+	defaultTTL time.Duration
+	ttls       map[schema.GroupVersionResource]time.Duration
+	maxEntries int
+	maxBytes   int64
+	now        func() time.Time
+}
+
+type CacheOption func(*cacheOptions)
+
+// WithDefaultTTL sets how long responses are served from the cache before they are revalidated.
+// Defaults to DefaultTTL.
+func WithDefaultTTL(ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.defaultTTL = ttl
+	}
+}
+
+// WithTTL sets the ttl of the responses for a resource. A ttl of 0 disables caching of the resource.
+func WithTTL(gvr schema.GroupVersionResource, ttl time.Duration) CacheOption {
+	return func(o *cacheOptions) {
+		o.ttls[gvr] = ttl
+	}
+}
+
+// WithMaxEntries limits the number of cached responses. Defaults to DefaultMaxEntries.
+func WithMaxEntries(n int) CacheOption {
+	return func(o *cacheOptions) {
+		o.maxEntries = n
+	}
+}
+
+// WithMaxBytes limits the total size of the cached response bodies. Defaults to DefaultMaxBytes.
+func WithMaxBytes(n int64) CacheOption {
+	return func(o *cacheOptions) {
+		o.maxBytes = n
+	}
+}
+
+// CacheStats are the counters of a Cache.
+type CacheStats struct {
+	Hits          int64
+	Misses        int64
+	Revalidations int64
+	Invalidations int64
+	Evictions     int64
+	Entries       int
+	Bytes         int64
+}
+
+// Cache caches the responses of GET requests to the Kubernetes api, keyed by the user and impersonation
+// headers of the request. Unlike ConfigFor, only safe requests are cached, watches are never cached, and
+// a write to a resource invalidates the cached responses for it. Stale responses with an ETag are
+// revalidated with conditional GETs.
+type Cache struct {
+	opts     cacheOptions
+	resolver *request.RequestInfoFactory
+
+	mu      sync.Mutex
+	lru     *list.List // front is most recently used
+	entries map[string]*list.Element
+	bytes   int64
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	revalidations atomic.Int64
+	invalidations atomic.Int64
+	evictions     atomic.Int64
+}
+
+type cacheEntry struct {
+	key      string
+	resource cachedResource
+	status   int
+	header   http.Header
+	body     []byte
+	stored   time.Time
+	ttl      time.Duration
+}
+
+// cachedResource identifies the resource a response belongs to, so that writes can invalidate it.
+type cachedResource struct {
+	gr        schema.GroupResource
+	namespace string
+	name      string
+}
+
+func NewCache(opts ...CacheOption) *Cache {
+	o := cacheOptions{
+		defaultTTL: DefaultTTL,
+		ttls:       map[schema.GroupVersionResource]time.Duration{},
+		maxEntries: DefaultMaxEntries,
+		maxBytes:   DefaultMaxBytes,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Cache{
+		opts: o,
+		resolver: &request.RequestInfoFactory{
+			APIPrefixes:          sets.NewString("api", "apis"),
+			GrouplessAPIPrefixes: sets.NewString("api"),
+		},
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	entries, size := c.lru.Len(), c.bytes
+	c.mu.Unlock()
+	return CacheStats{
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Revalidations: c.revalidations.Load(),
+		Invalidations: c.invalidations.Load(),
+		Evictions:     c.evictions.Load(),
+		Entries:       entries,
+		Bytes:         size,
+	}
+}
+
+// Purge removes all cached responses.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Init()
+	c.entries = map[string]*list.Element{}
+	c.bytes = 0
+}
+
+// ConfigWithCache returns a copy of the config that caches the api responses in the cache. Configs
+// with different client certificates or credential plugins never share responses, even if they share the cache.
+func ConfigWithCache(config *rest.Config, cache *Cache) *rest.Config {
+	c2 := rest.CopyConfig(config)
+	c2.Wrap(transport.Wrappers(fnCache(cache, configIdentity(config))))
+	return c2
+}
+
+func fnCache(cache *Cache, identity string) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &cachingRoundTripper{rt: rt, cache: cache, identity: identity}
+	}
+}
+
+// configIdentity returns a hash of the credentials of the config that are not sent as request headers,
+// eg, client certificates, which the Authorization header used by cacheKey does not cover.
+func configIdentity(config *rest.Config) string {
+	h := sha256.New()
+	for _, v := range [][]byte{
+		config.CertData,
+		[]byte(config.CertFile),
+		config.KeyData,
+		[]byte(config.KeyFile),
+		[]byte(config.Username),
+		[]byte(config.BearerTokenFile),
+	} {
+		h.Write(v)
+		h.Write([]byte{0})
+	}
+	// errors are ignored, as the exec and auth provider configs are plain data
+	exec, _ := json.Marshal(config.ExecProvider)
+	h.Write(exec)
+	h.Write([]byte{0})
+	auth, _ := json.Marshal(config.AuthProvider)
+	h.Write(auth)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type cachingRoundTripper struct {
+	rt       http.RoundTripper
+	cache    *Cache
+	identity string
+}
+
+var _ http.RoundTripper = &cachingRoundTripper{}
+
+func (rt *cachingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := rt.cache
+	info, err := c.resolver.NewRequestInfo(req)
+	if err != nil {
+		return rt.rt.RoundTrip(req)
+	}
+
+	if !isCacheable(req, info) {
+		resp, err := rt.rt.RoundTrip(req)
+		if err == nil && isWrite(req.Method) && info.IsResourceRequest {
+			c.invalidate(resourceOf(info))
+		}
+		return resp, err
+	}
+
+	ttl := c.ttlFor(info)
+	if ttl <= 0 {
+		return rt.rt.RoundTrip(req)
+	}
+
+	key := cacheKey(req, rt.identity)
+	entry, fresh := c.get(key)
+	if fresh {
+		c.hits.Add(1)
+		return entry.response(req), nil
+	}
+
+	outReq := req
+	if entry != nil && entry.header.Get("ETag") != "" {
+		outReq = req.Clone(req.Context())
+		outReq.Header.Set("If-None-Match", entry.header.Get("ETag"))
+	}
+	resp, err := rt.rt.RoundTrip(outReq)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil && resp.StatusCode == http.StatusNotModified {
+		_ = resp.Body.Close()
+		c.revalidations.Add(1)
+		c.touch(key)
+		return entry.response(req), nil
+	}
+
+	c.misses.Add(1)
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	c.put(&cacheEntry{
+		key:      key,
+		resource: resourceOf(info),
+		status:   resp.StatusCode,
+		header:   resp.Header.Clone(),
+		body:     body,
+		ttl:      ttl,
+	})
+	return resp, nil
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// cacheableSubresources are the subresources whose responses are objects like the resource itself.
+// Others, e.g., pods/log or pods/exec, return streams or have side effects.
+var cacheableSubresources = sets.New[string]("", "status", "scale")
+
+func isCacheable(req *http.Request, info *request.RequestInfo) bool {
+	if req.Method != http.MethodGet || info.Verb == "watch" || req.Header.Get("Range") != "" {
+		return false
+	}
+	if info.IsResourceRequest && !cacheableSubresources.Has(info.Subresource) {
+		return false
+	}
+	// streamed responses never end, so they must not be buffered
+	if q := req.URL.Query(); q.Has("follow") || q.Has("watch") {
+		return false
+	}
+	cc := req.Header.Get("Cache-Control")
+	return !strings.Contains(cc, "no-cache") && !strings.Contains(cc, "no-store")
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+func resourceOf(info *request.RequestInfo) cachedResource {
+	if !info.IsResourceRequest {
+		return cachedResource{}
+	}
+	return cachedResource{
+		gr:        schema.GroupResource{Group: info.APIGroup, Resource: info.Resource},
+		namespace: info.Namespace,
+		name:      info.Name,
+	}
+}
+
+func (c *Cache) ttlFor(info *request.RequestInfo) time.Duration {
+	if info.IsResourceRequest {
+		gvr := schema.GroupVersionResource{Group: info.APIGroup, Version: info.APIVersion, Resource: info.Resource}
+		if ttl, ok := c.opts.ttls[gvr]; ok {
+			return ttl
+		}
+	}
+	return c.opts.defaultTTL
+}
+
+// cacheKey returns the key of the response, which includes a hash of the identity of the config, the
+// credentials and impersonation headers, so that users never see each other's responses.
+func cacheKey(req *http.Request, identity string) string {
+	h := sha256.New()
+	h.Write([]byte(identity))
+	h.Write([]byte{0})
+	h.Write([]byte(req.Header.Get("Authorization")))
+	var names []string
+	for name := range req.Header {
+		if strings.HasPrefix(name, "Impersonate-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+		for _, v := range req.Header.Values(name) {
+			h.Write([]byte{0})
+			h.Write([]byte(v))
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)) + " " + req.Header.Get("Accept") + " " + req.URL.String()
+}
+
+func (c *Cache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	entry := elem.Value.(*cacheEntry)
+	return entry, c.opts.now().Sub(entry.stored) < entry.ttl
+}
+
+func (c *Cache) touch(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).stored = c.opts.now()
+		c.lru.MoveToFront(elem)
+	}
+}
+
+func (c *Cache) put(entry *cacheEntry) {
+	size := int64(len(entry.body))
+	if size > c.opts.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.stored = c.opts.now()
+	if elem, ok := c.entries[entry.key]; ok {
+		c.removeElement(elem)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.bytes += size
+
+	for c.lru.Len() > c.opts.maxEntries || c.bytes > c.opts.maxBytes {
+		c.removeElement(c.lru.Back())
+		c.evictions.Add(1)
+	}
+}
+
+func (c *Cache) removeElement(elem *list.Element) {
+	entry := c.lru.Remove(elem).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.body))
+}
+
+// invalidate removes the cached responses of all users that a write to the resource may have changed,
+// i.e., the object itself and the lists it may appear in.
+func (c *Cache) invalidate(written cachedResource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		r := elem.Value.(*cacheEntry).resource
+		if r.gr == written.gr &&
+			(r.namespace == "" || written.namespace == "" || r.namespace == written.namespace) &&
+			(r.name == "" || written.name == "" || r.name == written.name) {
+			c.removeElement(elem)
+			c.invalidations.Add(1)
+		}
+		elem = next
+	}
+}
@@ -0,0 +1,268 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+)
+
+type fakeAPIServer struct {
+	mu    sync.Mutex
+	calls map[string]int
+	etag  string
+}
+
+func (s *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[r.Method+" "+r.URL.Path]++
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if s.etag != "" {
+		if r.Header.Get("If-None-Match") == s.etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", s.etag)
+	}
+	_, _ = w.Write([]byte(r.URL.Path + " " + r.Header.Get("Authorization")))
+}
+
+func (s *fakeAPIServer) count(key string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[key]
+}
+
+type testClient struct {
+	t   *testing.T
+	url string
+	rt  http.RoundTripper
+}
+
+func (c testClient) do(method, path, token string) string {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.url+path, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.rt.RoundTrip(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint:errcheck
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return string(body)
+}
+
+func newTestCache(t *testing.T, etag string, opts ...CacheOption) (*Cache, *fakeAPIServer, testClient, *time.Time) {
+	srv := &fakeAPIServer{calls: map[string]int{}, etag: etag}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	now := time.Now()
+	cache := NewCache(opts...)
+	cache.opts.now = func() time.Time { return now }
+	return cache, srv, testClient{t: t, url: ts.URL, rt: fnCache(cache, "")(http.DefaultTransport)}, &now
+}
+
+const podsPath = "/api/v1/namespaces/demo/pods"
+
+func TestCacheHitsAndInvalidation(t *testing.T) {
+	cache, srv, c, _ := newTestCache(t, "")
+
+	c.do(http.MethodGet, podsPath, "alice")
+	c.do(http.MethodGet, podsPath, "alice")
+	c.do(http.MethodGet, podsPath+"/p1", "alice")
+	if n := srv.count("GET " + podsPath); n != 1 {
+		t.Errorf("expected 1 list call, found %d", n)
+	}
+
+	// other users never share responses
+	if body := c.do(http.MethodGet, podsPath, "bob"); !strings.HasSuffix(body, "Bearer bob") {
+		t.Errorf("unexpected response for bob %q", body)
+	}
+	if n := srv.count("GET " + podsPath); n != 2 {
+		t.Errorf("expected 2 list calls, found %d", n)
+	}
+
+	// watches are never cached
+	c.do(http.MethodGet, podsPath+"?watch=true", "alice")
+	c.do(http.MethodGet, podsPath+"?watch=true", "alice")
+	if n := srv.count("GET " + podsPath); n != 4 {
+		t.Errorf("expected watches to skip the cache, found %d list calls", n)
+	}
+
+	// a write to a pod invalidates the pod and the pod lists of all users
+	c.do(http.MethodPatch, podsPath+"/p1", "alice")
+	c.do(http.MethodGet, podsPath, "alice")
+	c.do(http.MethodGet, podsPath, "bob")
+	c.do(http.MethodGet, podsPath+"/p1", "alice")
+	if n := srv.count("GET " + podsPath); n != 6 {
+		t.Errorf("expected lists to be fetched again after a write, found %d list calls", n)
+	}
+	if n := srv.count("GET " + podsPath + "/p1"); n != 2 {
+		t.Errorf("expected pod to be fetched again after a write, found %d calls", n)
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Invalidations != 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheSeparatesCertUsers(t *testing.T) {
+	cache, srv, c, _ := newTestCache(t, "")
+	alice := &rest.Config{TLSClientConfig: rest.TLSClientConfig{CertData: []byte("alice-cert"), KeyData: []byte("alice-key")}}
+	bob := &rest.Config{TLSClientConfig: rest.TLSClientConfig{CertData: []byte("bob-cert"), KeyData: []byte("bob-key")}}
+	if configIdentity(alice) == configIdentity(bob) {
+		t.Fatal("expected configs with different client certificates to have different identities")
+	}
+
+	// users authenticated by client certificates send no Authorization header
+	ca := testClient{t: t, url: c.url, rt: fnCache(cache, configIdentity(alice))(http.DefaultTransport)}
+	cb := testClient{t: t, url: c.url, rt: fnCache(cache, configIdentity(bob))(http.DefaultTransport)}
+	ca.do(http.MethodGet, podsPath, "")
+	ca.do(http.MethodGet, podsPath, "")
+	cb.do(http.MethodGet, podsPath, "")
+	if n := srv.count("GET " + podsPath); n != 2 {
+		t.Errorf("expected a list call per user, found %d", n)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheRevalidatesWithETag(t *testing.T) {
+	cache, srv, c, now := newTestCache(t, `"v1"`, WithDefaultTTL(time.Minute))
+
+	first := c.do(http.MethodGet, podsPath, "alice")
+	*now = now.Add(2 * time.Minute)
+	if second := c.do(http.MethodGet, podsPath, "alice"); second != first {
+		t.Errorf("expected revalidated response %q, found %q", first, second)
+	}
+	if n := srv.count("GET " + podsPath); n != 2 {
+		t.Errorf("expected a conditional GET, found %d calls", n)
+	}
+	c.do(http.MethodGet, podsPath, "alice")
+	if n := srv.count("GET " + podsPath); n != 2 {
+		t.Errorf("expected revalidated response to be fresh, found %d calls", n)
+	}
+	if stats := cache.Stats(); stats.Revalidations != 1 || stats.Hits != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheTTLAndLimits(t *testing.T) {
+	cache, srv, c, _ := newTestCache(t, "",
+		WithTTL(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, 0),
+		WithMaxEntries(2),
+	)
+
+	secrets := "/api/v1/namespaces/demo/secrets"
+	c.do(http.MethodGet, secrets, "alice")
+	c.do(http.MethodGet, secrets, "alice")
+	if n := srv.count("GET " + secrets); n != 2 {
+		t.Errorf("expected secrets not to be cached, found %d calls", n)
+	}
+
+	for _, name := range []string{"p1", "p2", "p3"} {
+		c.do(http.MethodGet, podsPath+"/"+name, "alice")
+	}
+	if stats := cache.Stats(); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCacheSkipsSubresourcesAndStreams(t *testing.T) {
+	_, srv, c, _ := newTestCache(t, "")
+
+	c.do(http.MethodGet, podsPath+"/p1/status", "alice")
+	c.do(http.MethodGet, podsPath+"/p1/status", "alice")
+	if n := srv.count("GET " + podsPath + "/p1/status"); n != 1 {
+		t.Errorf("expected the status subresource to be cached, found %d calls", n)
+	}
+	c.do(http.MethodGet, podsPath+"/p1/log", "alice")
+	c.do(http.MethodGet, podsPath+"/p1/log", "alice")
+	if n := srv.count("GET " + podsPath + "/p1/log"); n != 2 {
+		t.Errorf("expected the log subresource to skip the cache, found %d calls", n)
+	}
+}
+
+func TestCacheDoesNotBufferFollowedLogs(t *testing.T) {
+	done := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("line 1\n"))
+		w.(http.Flusher).Flush()
+		// the log is followed until the client goes away
+		select {
+		case <-done:
+		case <-r.Context().Done():
+		}
+	}))
+	defer ts.Close()
+	defer close(done)
+
+	rt := fnCache(NewCache(), "")(http.DefaultTransport)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+podsPath+"/p1/log?follow=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			ch <- result{err: err}
+			return
+		}
+		defer resp.Body.Close() // nolint:errcheck
+		buf := make([]byte, len("line 1\n"))
+		_, err = io.ReadFull(resp.Body, buf)
+		ch <- result{line: string(buf), err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil || r.line != "line 1\n" {
+			t.Errorf("unexpected result %q, %v", r.line, r.err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the followed log to be streamed, not buffered")
+	}
+}
@@ -19,6 +19,7 @@ package clientcache
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gregjones/httpcache"
@@ -36,7 +37,12 @@ func (rt *enableResponseCaching) RoundTrip(req *http.Request) (*http.Response, e
 	if err != nil {
 		return nil, err
 	}
-	resp.Header.Set("Cache-Control", fmt.Sprintf("max-age=%d", int(rt.maxAge.Seconds())))
+	// never let watches and writes be cached
+	if req.Method == http.MethodGet &&
+		req.URL.Query().Get("watch") != "true" &&
+		!strings.Contains(req.URL.Path, "/watch/") {
+		resp.Header.Set("Cache-Control", fmt.Sprintf("max-age=%d", int(rt.maxAge.Seconds())))
+	}
 	return resp, nil
 }
 
@@ -56,6 +62,8 @@ func fnCacheResponse(cache httpcache.Cache) func(rt http.RoundTripper) http.Roun
 	}
 }
 
+// ConfigFor returns a copy of the config that caches the GET responses for maxAge. Writes do not
+// invalidate the cached responses, use ConfigWithCache for that.
 func ConfigFor(config *rest.Config, maxAge time.Duration, cache httpcache.Cache) *rest.Config {
 	c2 := rest.CopyConfig(config)
 	c2.Wrap(transport.Wrappers(fnEnableResponseCaching(maxAge), fnCacheResponse(cache)))
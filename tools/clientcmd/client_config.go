@@ -17,15 +17,12 @@ limitations under the License.
 package clientcmd
 
 import (
-	"net"
 	"os"
-	"slices"
+	"path/filepath"
 
-	"kmodules.xyz/client-go/cluster"
 	"kmodules.xyz/client-go/meta"
 
 	"github.com/pkg/errors"
-	"github.com/spf13/pflag"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/rest"
@@ -38,21 +35,24 @@ import (
 // components. Warnings should reflect this usage. If neither masterUrl or kubeconfigPath
 // are passed in we fallback to inClusterConfig. If inClusterConfig fails, we fallback
 // to the default config.
-func BuildConfigFromFlags(masterUrl, kubeconfigPath string) (*rest.Config, error) {
-	return fix(clientcmd.BuildConfigFromFlags(masterUrl, kubeconfigPath))
+func BuildConfigFromFlags(masterUrl, kubeconfigPath string, opts ...Option) (*rest.Config, error) {
+	cfg, err := clientcmd.BuildConfigFromFlags(masterUrl, kubeconfigPath)
+	return fix(cfg, err, opts...)
 }
 
 // BuildConfigFromKubeconfigGetter is a helper function that builds configs from a master
 // url and a kubeconfigGetter.
-func BuildConfigFromKubeconfigGetter(masterUrl string, kubeconfigGetter clientcmd.KubeconfigGetter) (*rest.Config, error) {
-	return fix(clientcmd.BuildConfigFromKubeconfigGetter(masterUrl, kubeconfigGetter))
+func BuildConfigFromKubeconfigGetter(masterUrl string, kubeconfigGetter clientcmd.KubeconfigGetter, opts ...Option) (*rest.Config, error) {
+	cfg, err := clientcmd.BuildConfigFromKubeconfigGetter(masterUrl, kubeconfigGetter)
+	return fix(cfg, err, opts...)
 }
 
-func BuildConfigFromContext(kubeconfigPath, contextName string) (*rest.Config, error) {
+func BuildConfigFromContext(kubeconfigPath, contextName string, opts ...Option) (*rest.Config, error) {
 	var loader clientcmd.ClientConfigLoader
 	if kubeconfigPath == "" {
 		if meta.PossiblyInCluster() {
-			return rest.InClusterConfig()
+			cfg, err := rest.InClusterConfig()
+			return fix(cfg, err, opts...)
 		}
 		rules := clientcmd.NewDefaultClientConfigLoadingRules()
 		rules.DefaultClientConfig = &clientcmd.DefaultClientConfig
@@ -63,19 +63,33 @@ func BuildConfigFromContext(kubeconfigPath, contextName string) (*rest.Config, e
 	overrides := &clientcmd.ConfigOverrides{
 		CurrentContext: contextName,
 	}
-	return fix(clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loader, overrides).ClientConfig())
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loader, overrides).ClientConfig()
+	return fix(cfg, err, opts...)
 }
 
-func ClientFromContext(kubeconfigPath, contextName string) (kubernetes.Interface, error) {
-	cfg, err := BuildConfigFromContext(kubeconfigPath, contextName)
+func ClientFromContext(kubeconfigPath, contextName string, opts ...Option) (kubernetes.Interface, error) {
+	cfg, err := BuildConfigFromContext(kubeconfigPath, contextName, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return kubernetes.NewForConfig(cfg)
 }
 
+// NamespaceFromContext returns the namespace of the context. kubeconfigPath may list multiple files,
+// separated like the KUBECONFIG environment variable. Missing files are skipped, but at least one must exist.
 func NamespaceFromContext(kubeconfigPath, contextName string) (string, error) {
-	kConfig, err := clientcmd.LoadFromFile(kubeconfigPath)
+	var paths []string
+	for _, path := range filepath.SplitList(kubeconfigPath) {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	if len(paths) == 0 {
+		return "", errors.Errorf("kubeconfig file %s not found", kubeconfigPath)
+	}
+	kConfig, err := LoadKubeConfigFiles(paths...)
 	if err != nil {
 		return "", err
 	}
@@ -86,48 +100,24 @@ func NamespaceFromContext(kubeconfigPath, contextName string) (string, error) {
 	return ctx.Namespace, nil
 }
 
-func fix(cfg *rest.Config, err error) (*rest.Config, error) {
-	return Fix(cfg), err
-}
-
-var fixAKS = true
-
-func init() {
-	pflag.BoolVar(&fixAKS, "use-kubeapiserver-fqdn-for-aks", fixAKS, "if true, uses kube-apiserver FQDN for AKS cluster to workaround https://github.com/Azure/AKS/issues/522")
-}
-
-func UseKubeAPIServerFQDNForAKS() bool {
-	return fixAKS
+func fix(cfg *rest.Config, err error, opts ...Option) (*rest.Config, error) {
+	if err != nil {
+		return nil, err
+	}
+	return newOptions(opts...).fixups.Apply(cfg)
 }
 
-// FixAKS uses kube-apiserver FQDN for AKS cluster to workaround https://github.com/Azure/AKS/issues/522
+// Fix applies the DefaultFixups to the config in place.
+//
+// Deprecated: Use DefaultFixups().Apply or WithFixups.
 func Fix(cfg *rest.Config) *rest.Config {
-	if cfg == nil || !fixAKS {
+	out, err := DefaultFixups().Apply(cfg)
+	if err != nil {
+		klog.Errorln(err)
 		return cfg
 	}
-
-	// ref: https://github.com/kubernetes/client-go/blob/kubernetes-1.11.3/rest/config.go#L309
-	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
-	if len(host) > 0 &&
-		len(port) > 0 &&
-		slices.Contains([]string{
-			"https://" + net.JoinHostPort(host, port),
-			"https://kubernetes.default.svc",
-			"https://kubernetes.default.svc:443",
-		}, cfg.Host) {
-		// uses service ip or cluster dns
-
-		if cert, err := cluster.APIServerCertificate(cfg); err == nil {
-			// kube-apiserver cert found
-
-			if host, err := cluster.TestAKS(cert); err == nil {
-				// AKS cluster
-
-				h := "https://" + host
-				klog.Infof("resetting Kubeconfig host to %s from %s for AKS to workaround https://github.com/Azure/AKS/issues/522", h, cfg.Host)
-				cfg.Host = h
-			}
-		}
+	if cfg != nil {
+		*cfg = *out
 	}
 	return cfg
 }
@@ -0,0 +1,211 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcmd
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"kmodules.xyz/client-go/cluster"
+
+	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+)
+
+// ConfigFixup adjusts a rest config to work around quirks of the environment it is used in. Fixup
+// returns whether the config was changed.
+type ConfigFixup interface {
+	Name() string
+	Fixup(cfg *rest.Config) (bool, error)
+}
+
+type ConfigFixupFunc struct {
+	FixupName string
+	Fn        func(cfg *rest.Config) (bool, error)
+}
+
+var _ ConfigFixup = ConfigFixupFunc{}
+
+func (f ConfigFixupFunc) Name() string {
+	return f.FixupName
+}
+
+func (f ConfigFixupFunc) Fixup(cfg *rest.Config) (bool, error) {
+	return f.Fn(cfg)
+}
+
+// FixupChain applies the fixups in order.
+type FixupChain []ConfigFixup
+
+// Apply returns a copy of cfg with the fixups applied.
+func (c FixupChain) Apply(cfg *rest.Config) (*rest.Config, error) {
+	if cfg == nil || len(c) == 0 {
+		return cfg, nil
+	}
+	out := rest.CopyConfig(cfg)
+	for _, f := range c {
+		host := out.Host
+		changed, err := f.Fixup(out)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to apply %s fixup", f.Name())
+		}
+		if changed {
+			klog.V(3).Infof("applied %s fixup to rest config, host %s -> %s", f.Name(), host, out.Host)
+		}
+	}
+	return out, nil
+}
+
+// DefaultFixups returns the fixups used when none are configured via WithFixups. The AKSFQDN fixup is
+// included unless it is disabled by the --use-kubeapiserver-fqdn-for-aks flag.
+func DefaultFixups() FixupChain {
+	if !fixAKS {
+		return FixupChain{}
+	}
+	return FixupChain{AKSFQDN()}
+}
+
+type options struct {
+	fixups FixupChain
+}
+
+type Option func(*options)
+
+// WithFixups replaces the default fixups applied to the built rest configs.
+func WithFixups(fixups ...ConfigFixup) Option {
+	return func(o *options) {
+		o.fixups = fixups
+	}
+}
+
+// WithoutFixups returns the rest configs as loaded.
+func WithoutFixups() Option {
+	return func(o *options) {
+		o.fixups = FixupChain{}
+	}
+}
+
+func newOptions(opts ...Option) options {
+	o := options{
+		fixups: DefaultFixups(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// isInClusterHost returns true if the host is the kubernetes service, as set by rest.InClusterConfig.
+func isInClusterHost(cfg *rest.Config) bool {
+	// ref: https://github.com/kubernetes/client-go/blob/kubernetes-1.11.3/rest/config.go#L309
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	return len(host) > 0 &&
+		len(port) > 0 &&
+		slices.Contains([]string{
+			"https://" + net.JoinHostPort(host, port),
+			"https://kubernetes.default.svc",
+			"https://kubernetes.default.svc:443",
+		}, cfg.Host)
+}
+
+func inClusterFQDNFixup(name string, test func(cert *x509.Certificate) (string, error)) ConfigFixup {
+	return ConfigFixupFunc{
+		FixupName: name,
+		Fn: func(cfg *rest.Config) (bool, error) {
+			if !isInClusterHost(cfg) {
+				return false, nil
+			}
+			cert, err := cluster.APIServerCertificate(cfg)
+			if err != nil {
+				return false, nil
+			}
+			host, err := test(cert)
+			if err != nil {
+				return false, nil
+			}
+			cfg.Host = "https://" + host
+			return true, nil
+		},
+	}
+}
+
+// AKSFQDN uses kube-apiserver FQDN instead of the kubernetes service for AKS clusters to workaround
+// https://github.com/Azure/AKS/issues/522
+func AKSFQDN() ConfigFixup {
+	return inClusterFQDNFixup("aks", cluster.TestAKS)
+}
+
+// EKSPrivateEndpoint uses the kube-apiserver FQDN instead of the kubernetes service for EKS clusters. The
+// FQDN resolves to the private endpoint inside the VPC, when it is enabled for the cluster.
+func EKSPrivateEndpoint() ConfigFixup {
+	return inClusterFQDNFixup("eks", cluster.TestEKS)
+}
+
+// RancherProxy routes the requests through the Rancher proxy of the downstream cluster with the given
+// id, if the config points to a Rancher server.
+func RancherProxy(clusterID string) ConfigFixup {
+	return ConfigFixupFunc{
+		FixupName: "rancher",
+		Fn: func(cfg *rest.Config) (bool, error) {
+			u, err := url.Parse(cfg.Host)
+			if err != nil {
+				return false, err
+			}
+			if strings.Contains(u.Path, "/k8s/clusters/") {
+				return false, nil
+			}
+			if _, ok, err := cluster.DetectRancherProxy(rest.CopyConfig(cfg)); err != nil || !ok {
+				return false, nil
+			}
+			u.Path = path.Join("/k8s/clusters", clusterID)
+			cfg.Host = u.String()
+			return true, nil
+		},
+	}
+}
+
+// VirtualCluster points the config at server when it uses the local endpoint of a vcluster, e.g., a
+// kubeconfig exported from the vcluster. The TLS server name is kept as localhost, since the vcluster
+// certificate is issued for it.
+func VirtualCluster(server string) ConfigFixup {
+	return ConfigFixupFunc{
+		FixupName: "vcluster",
+		Fn: func(cfg *rest.Config) (bool, error) {
+			u, err := url.Parse(cfg.Host)
+			if err != nil {
+				return false, err
+			}
+			if u.Hostname() != "localhost" && u.Hostname() != "127.0.0.1" {
+				return false, nil
+			}
+			if cfg.Host == server {
+				return false, nil
+			}
+			if cfg.TLSClientConfig.ServerName == "" && !cfg.TLSClientConfig.Insecure {
+				cfg.TLSClientConfig.ServerName = "localhost"
+			}
+			cfg.Host = server
+			return true, nil
+		},
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcmd
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+func TestFixupChain(t *testing.T) {
+	var order []string
+	appendPath := func(name string) ConfigFixup {
+		return ConfigFixupFunc{FixupName: name, Fn: func(cfg *rest.Config) (bool, error) {
+			order = append(order, name)
+			cfg.Host += "/" + name
+			return true, nil
+		}}
+	}
+
+	in := &rest.Config{Host: "https://example.com"}
+	out, err := FixupChain{appendPath("a"), appendPath("b")}.Apply(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Host != "https://example.com/a/b" {
+		t.Errorf("unexpected host %s", out.Host)
+	}
+	if in.Host != "https://example.com" {
+		t.Error("input config modified")
+	}
+
+	failing := ConfigFixupFunc{FixupName: "failing", Fn: func(cfg *rest.Config) (bool, error) {
+		return false, errors.New("boom")
+	}}
+	if _, err := (FixupChain{failing, appendPath("c")}).Apply(in); err == nil {
+		t.Error("expected fixup error")
+	}
+	if len(order) != 2 {
+		t.Errorf("fixups after a failure must not run, ran %v", order)
+	}
+}
+
+func TestVirtualClusterFixup(t *testing.T) {
+	cfg := &rest.Config{Host: "https://localhost:8443"}
+	changed, err := VirtualCluster("https://vcluster.example.com").Fixup(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || cfg.Host != "https://vcluster.example.com" || cfg.ServerName != "localhost" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+
+	cfg = &rest.Config{Host: "https://prod.example.com"}
+	if changed, _ := VirtualCluster("https://vcluster.example.com").Fixup(cfg); changed {
+		t.Error("expected non vcluster host to be kept")
+	}
+}
+
+func TestBuildConfigFromContextWithFixups(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	if err := clientcmd.WriteToFile(*newKubeConfig("vc", "https://127.0.0.1:8443", "token"), kubeconfig); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := BuildConfigFromContext(kubeconfig, "vc", WithFixups(VirtualCluster("https://vcluster.example.com")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "https://vcluster.example.com" {
+		t.Errorf("fixup not applied, host %s", cfg.Host)
+	}
+
+	cfg, err = BuildConfigFromContext(kubeconfig, "vc", WithoutFixups())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "https://127.0.0.1:8443" {
+		t.Errorf("unexpected host %s", cfg.Host)
+	}
+}
+
+func TestAddFlags(t *testing.T) {
+	defer func() { fixAKS = true }()
+
+	if len(DefaultFixups()) != 1 {
+		t.Errorf("expected the aks fixup by default, found %d fixups", len(DefaultFixups()))
+	}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	AddFlags(fs)
+	if err := fs.Parse([]string{"--use-kubeapiserver-fqdn-for-aks=false"}); err != nil {
+		t.Fatal(err)
+	}
+	if UseKubeAPIServerFQDNForAKS() || len(DefaultFixups()) != 0 {
+		t.Errorf("expected the aks fixup to be disabled by the flag, found %d fixups", len(DefaultFixups()))
+	}
+}
@@ -0,0 +1,42 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcmd
+
+import (
+	"flag"
+
+	"github.com/spf13/pflag"
+)
+
+var fixAKS = true
+
+const fixAKSUsage = "if true, uses kube-apiserver FQDN for AKS cluster to workaround https://github.com/Azure/AKS/issues/522"
+
+// AddFlags registers the --use-kubeapiserver-fqdn-for-aks flag. It selects whether DefaultFixups, used
+// unless WithFixups is set, include the AKSFQDN fixup.
+func AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&fixAKS, "use-kubeapiserver-fqdn-for-aks", fixAKS, fixAKSUsage)
+}
+
+func AddGoFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&fixAKS, "use-kubeapiserver-fqdn-for-aks", fixAKS, fixAKSUsage)
+}
+
+// UseKubeAPIServerFQDNForAKS returns the value of the --use-kubeapiserver-fqdn-for-aks flag.
+func UseKubeAPIServerFQDNForAKS() bool {
+	return fixAKS
+}
@@ -0,0 +1,336 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
+)
+
+// LoadKubeConfigFiles loads and merges the kubeconfig files the same way kubectl merges the files
+// listed in KUBECONFIG, i.e., the first file to set a value wins.
+func LoadKubeConfigFiles(paths ...string) (*clientcmdapi.Config, error) {
+	rules := clientcmd.ClientConfigLoadingRules{Precedence: paths}
+	return rules.Load()
+}
+
+// MergeKubeConfigs merges the kubeconfigs into a new one. Unlike LoadKubeConfigFiles, clusters, users and
+// contexts with the same name must be identical. The current context and the extensions are taken from
+// the first kubeconfig that sets them.
+func MergeKubeConfigs(configs ...*clientcmdapi.Config) (*clientcmdapi.Config, error) {
+	result := clientcmdapi.NewConfig()
+	for _, in := range configs {
+		if in == nil {
+			continue
+		}
+		if err := mergeInto(result.Clusters, in.Clusters, "cluster"); err != nil {
+			return nil, err
+		}
+		if err := mergeInto(result.AuthInfos, in.AuthInfos, "user"); err != nil {
+			return nil, err
+		}
+		if err := mergeInto(result.Contexts, in.Contexts, "context"); err != nil {
+			return nil, err
+		}
+		for name, ext := range in.Extensions {
+			if _, ok := result.Extensions[name]; !ok {
+				result.Extensions[name] = ext.DeepCopyObject()
+			}
+		}
+		if result.CurrentContext == "" {
+			result.CurrentContext = in.CurrentContext
+		}
+	}
+	return result, nil
+}
+
+type deepCopier[T any] interface {
+	DeepCopy() T
+}
+
+func mergeInto[T deepCopier[T]](dst, src map[string]T, kind string) error {
+	for name, v := range src {
+		if existing, ok := dst[name]; ok {
+			if !equalIgnoringOrigin(existing, v) {
+				return fmt.Errorf("conflicting %s %q", kind, name)
+			}
+			continue
+		}
+		dst[name] = v.DeepCopy()
+	}
+	return nil
+}
+
+// equalIgnoringOrigin compares the entries ignoring the LocationOfOrigin field set by the loader.
+func equalIgnoringOrigin[T deepCopier[T]](a, b T) bool {
+	a, b = a.DeepCopy(), b.DeepCopy()
+	for _, v := range []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b)} {
+		if v.Kind() == reflect.Pointer && !v.IsNil() {
+			if f := v.Elem().FieldByName("LocationOfOrigin"); f.IsValid() && f.CanSet() {
+				f.SetString("")
+			}
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// RenameContext renames a context, updating the current context if needed.
+func RenameContext(cfg *clientcmdapi.Config, oldName, newName string) error {
+	ctx, ok := cfg.Contexts[oldName]
+	if !ok {
+		return errors.Errorf("context %s not found", oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if _, ok := cfg.Contexts[newName]; ok {
+		return errors.Errorf("context %s already exists", newName)
+	}
+	delete(cfg.Contexts, oldName)
+	cfg.Contexts[newName] = ctx
+	if cfg.CurrentContext == oldName {
+		cfg.CurrentContext = newName
+	}
+	return nil
+}
+
+// KeepContexts removes all contexts except the named ones, along with the clusters and users that are
+// no longer referenced.
+func KeepContexts(cfg *clientcmdapi.Config, names ...string) {
+	keep := sets.New[string](names...)
+	for name := range cfg.Contexts {
+		if !keep.Has(name) {
+			delete(cfg.Contexts, name)
+		}
+	}
+	pruneKubeConfig(cfg)
+}
+
+// RemoveContexts removes the named contexts, along with the clusters and users that are no longer referenced.
+func RemoveContexts(cfg *clientcmdapi.Config, names ...string) {
+	for _, name := range names {
+		delete(cfg.Contexts, name)
+	}
+	pruneKubeConfig(cfg)
+}
+
+func pruneKubeConfig(cfg *clientcmdapi.Config) {
+	clusters := sets.New[string]()
+	users := sets.New[string]()
+	for _, ctx := range cfg.Contexts {
+		clusters.Insert(ctx.Cluster)
+		users.Insert(ctx.AuthInfo)
+	}
+	for name := range cfg.Clusters {
+		if !clusters.Has(name) {
+			delete(cfg.Clusters, name)
+		}
+	}
+	for name := range cfg.AuthInfos {
+		if !users.Has(name) {
+			delete(cfg.AuthInfos, name)
+		}
+	}
+	if _, ok := cfg.Contexts[cfg.CurrentContext]; !ok {
+		cfg.CurrentContext = ""
+	}
+}
+
+// Minify returns a copy of the kubeconfig holding only the named context, and the cluster and user it
+// refers to. The current context is used if contextName is empty.
+func Minify(cfg *clientcmdapi.Config, contextName string) (*clientcmdapi.Config, error) {
+	out := cfg.DeepCopy()
+	if contextName != "" {
+		out.CurrentContext = contextName
+	}
+	if err := clientcmdapi.MinifyConfig(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Flatten returns a copy of the kubeconfig with the certificate and key files inlined, so that it can be
+// moved to another machine.
+func Flatten(cfg *clientcmdapi.Config) (*clientcmdapi.Config, error) {
+	out := cfg.DeepCopy()
+	if err := clientcmdapi.FlattenConfig(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ToTokenKubeConfig returns a minified and flattened kubeconfig for the named context where the user
+// authenticates with a bearer token. Exec plugins, auth providers and token files are resolved into the
+// token they currently produce, so the kubeconfig stays valid only as long as that token does and can be
+// used where the plugin is not installed.
+func ToTokenKubeConfig(cfg *clientcmdapi.Config, contextName string) (*clientcmdapi.Config, error) {
+	out, err := Minify(cfg, contextName)
+	if err != nil {
+		return nil, err
+	}
+	if out, err = Flatten(out); err != nil {
+		return nil, err
+	}
+
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*out, out.CurrentContext, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	token, err := bearerTokenFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := out.Contexts[out.CurrentContext]
+	user := out.AuthInfos[ctx.AuthInfo]
+	if user == nil {
+		user = clientcmdapi.NewAuthInfo()
+		out.AuthInfos[ctx.AuthInfo] = user
+	}
+	user.Token = token
+	user.TokenFile = ""
+	user.Exec = nil
+	user.AuthProvider = nil
+	user.Username = ""
+	user.Password = ""
+	return out, nil
+}
+
+// bearerTokenFor returns the Authorization bearer token the rest config sends to the apiserver.
+func bearerTokenFor(cfg *rest.Config) (string, error) {
+	tc, err := cfg.TransportConfig()
+	if err != nil {
+		return "", err
+	}
+	var header string
+	capture := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header.Get("Authorization")
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	})
+	rt, err := transport.HTTPWrappersForConfig(tc, capture)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodGet, cfg.Host, nil)
+	if err != nil {
+		return "", err
+	}
+	if _, err = rt.RoundTrip(req); err != nil {
+		return "", err
+	}
+	token, found := strings.CutPrefix(header, "Bearer ")
+	if !found || token == "" {
+		return "", errors.New("user does not authenticate with a bearer token")
+	}
+	return token, nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// ContextStatus is the result of checking the reachability of the apiserver of a kubeconfig context.
+type ContextStatus struct {
+	Context string
+	Server  string
+	Version string
+	Error   error
+}
+
+func (s ContextStatus) Reachable() bool {
+	return s.Error == nil
+}
+
+// CheckContexts checks in parallel whether the apiserver of each named context is reachable with its
+// credentials, waiting at most timeout per context. All contexts are checked if none are named.
+func CheckContexts(ctx context.Context, cfg *clientcmdapi.Config, timeout time.Duration, contextNames ...string) []ContextStatus {
+	// sort a copy, the slice belongs to the caller
+	contextNames = slices.Clone(contextNames)
+	if len(contextNames) == 0 {
+		for name := range cfg.Contexts {
+			contextNames = append(contextNames, name)
+		}
+	}
+	sort.Strings(contextNames)
+
+	result := make([]ContextStatus, len(contextNames))
+	var wg sync.WaitGroup
+	for i, name := range contextNames {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result[i] = checkContext(ctx, cfg, name, timeout)
+		}()
+	}
+	wg.Wait()
+	return result
+}
+
+func checkContext(ctx context.Context, cfg *clientcmdapi.Config, contextName string, timeout time.Duration) ContextStatus {
+	status := ContextStatus{Context: contextName}
+	if _, ok := cfg.Contexts[contextName]; !ok {
+		status.Error = errors.Errorf("context %s not found", contextName)
+		return status
+	}
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*cfg, contextName, &clientcmd.ConfigOverrides{}, nil).ClientConfig()
+	if err != nil {
+		status.Error = err
+		return status
+	}
+	status.Server = restConfig.Host
+	restConfig.Timeout = timeout
+
+	dc, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		status.Error = err
+		return status
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	body, err := dc.RESTClient().Get().AbsPath("/version").Do(ctx).Raw()
+	if err != nil {
+		status.Error = err
+		return status
+	}
+	var info struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		status.Error = err
+		return status
+	}
+	status.Version = info.GitVersion
+	return status
+}
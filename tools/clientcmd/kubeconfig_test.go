@@ -0,0 +1,172 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package clientcmd
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func newKubeConfig(name, server, token string) *clientcmdapi.Config {
+	cfg := clientcmdapi.NewConfig()
+	cfg.Clusters[name] = &clientcmdapi.Cluster{Server: server}
+	cfg.AuthInfos[name] = &clientcmdapi.AuthInfo{Token: token}
+	cfg.Contexts[name] = &clientcmdapi.Context{Cluster: name, AuthInfo: name, Namespace: "default"}
+	cfg.CurrentContext = name
+	return cfg
+}
+
+func TestMergeKubeConfigs(t *testing.T) {
+	a := newKubeConfig("a", "https://a.example.com", "ta")
+	b := newKubeConfig("b", "https://b.example.com", "tb")
+
+	merged, err := MergeKubeConfigs(a, b, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Contexts) != 2 || merged.CurrentContext != "a" {
+		t.Errorf("unexpected merged kubeconfig %+v", merged)
+	}
+
+	conflict := newKubeConfig("a", "https://other.example.com", "ta")
+	if _, err := MergeKubeConfigs(a, conflict); err == nil {
+		t.Error("expected conflicting clusters to fail the merge")
+	}
+}
+
+func TestRenameAndPruneContexts(t *testing.T) {
+	cfg, err := MergeKubeConfigs(
+		newKubeConfig("a", "https://a.example.com", "ta"),
+		newKubeConfig("b", "https://b.example.com", "tb"),
+		newKubeConfig("c", "https://c.example.com", "tc"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RenameContext(cfg, "a", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CurrentContext != "prod" || cfg.Contexts["prod"].Cluster != "a" {
+		t.Errorf("context not renamed: %+v", cfg)
+	}
+	if err := RenameContext(cfg, "b", "c"); err == nil {
+		t.Error("expected rename onto an existing context to fail")
+	}
+
+	RemoveContexts(cfg, "b")
+	if _, ok := cfg.Clusters["b"]; ok {
+		t.Error("cluster b not pruned")
+	}
+	KeepContexts(cfg, "c")
+	if len(cfg.Contexts) != 1 || len(cfg.Clusters) != 1 || len(cfg.AuthInfos) != 1 {
+		t.Errorf("unexpected pruned kubeconfig %+v", cfg)
+	}
+	if cfg.CurrentContext != "" {
+		t.Errorf("expected current context to be cleared, found %s", cfg.CurrentContext)
+	}
+}
+
+func TestNamespaceFromContextMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	cb := newKubeConfig("b", "https://b.example.com", "tb")
+	cb.Contexts["b"].Namespace = "demo"
+	if err := clientcmd.WriteToFile(*newKubeConfig("a", "https://a.example.com", "ta"), a); err != nil {
+		t.Fatal(err)
+	}
+	if err := clientcmd.WriteToFile(*cb, b); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := NamespaceFromContext(a+string(os.PathListSeparator)+b, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ns != "demo" {
+		t.Errorf("expected namespace demo, found %s", ns)
+	}
+
+	if _, err := NamespaceFromContext(filepath.Join(dir, "missing")+string(os.PathListSeparator)+b, "b"); err != nil {
+		t.Errorf("expected missing files to be skipped, got %v", err)
+	}
+	if _, err := NamespaceFromContext(filepath.Join(dir, "missing"), "b"); err == nil {
+		t.Error("expected an error if no kubeconfig file exists")
+	}
+}
+
+func TestToTokenKubeConfigAndCheckContexts(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer from-file" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"gitVersion":"v1.34.0"}`))
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("from-file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := MergeKubeConfigs(
+		newKubeConfig("a", srv.URL, ""),
+		newKubeConfig("b", "https://b.example.com", "tb"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.AuthInfos["a"].TokenFile = tokenFile
+	cfg.Clusters["a"].CertificateAuthorityData = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	out, err := ToTokenKubeConfig(cfg, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user := out.AuthInfos["a"]; user.Token != "from-file" || user.TokenFile != "" {
+		t.Errorf("unexpected user %+v", user)
+	}
+	if len(out.Contexts) != 1 {
+		t.Errorf("expected a minified kubeconfig, found %d contexts", len(out.Contexts))
+	}
+
+	statuses := CheckContexts(context.TODO(), out, 5*time.Second)
+	if len(statuses) != 1 || !statuses[0].Reachable() || statuses[0].Version != "v1.34.0" {
+		t.Errorf("unexpected statuses %+v", statuses)
+	}
+	statuses = CheckContexts(context.TODO(), cfg, 5*time.Second, "missing")
+	if statuses[0].Reachable() {
+		t.Error("expected missing context to be unreachable")
+	}
+
+	names := []string{"missing", "a"}
+	statuses = CheckContexts(context.TODO(), cfg, 5*time.Second, names...)
+	if names[0] != "missing" || names[1] != "a" {
+		t.Errorf("expected the context names of the caller to be unchanged, found %v", names)
+	}
+	if len(statuses) != 2 || statuses[0].Context != "a" || statuses[1].Context != "missing" {
+		t.Errorf("expected the statuses to be sorted by context, found %+v", statuses)
+	}
+}
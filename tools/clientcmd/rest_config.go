@@ -25,25 +25,35 @@ import (
 
 // https://github.com/kubernetes/client-go/issues/711#issuecomment-730112049
 func BuildKubeConfig(cfg *rest.Config, namespace string) (*clientcmdapi.Config, error) {
+	return buildKubeConfig(cfg, namespace, "default-cluster", "default-context", "default-user")
+}
+
+// BuildNamedKubeConfig is like BuildKubeConfig, but the cluster, context and user are all called name.
+// Use it to build kubeconfigs that can be merged with MergeKubeConfigs.
+func BuildNamedKubeConfig(cfg *rest.Config, name, namespace string) (*clientcmdapi.Config, error) {
+	return buildKubeConfig(cfg, namespace, name, name, name)
+}
+
+func buildKubeConfig(cfg *rest.Config, namespace, clusterName, contextName, userName string) (*clientcmdapi.Config, error) {
 	if err := rest.LoadTLSFiles(cfg); err != nil {
 		return nil, err
 	}
 
 	clusters := make(map[string]*clientcmdapi.Cluster)
-	clusters["default-cluster"] = &clientcmdapi.Cluster{
+	clusters[clusterName] = &clientcmdapi.Cluster{
 		Server:                   cfg.Host,
 		CertificateAuthorityData: cfg.CAData,
 	}
 
 	contexts := make(map[string]*clientcmdapi.Context)
-	contexts["default-context"] = &clientcmdapi.Context{
-		Cluster:   "default-cluster",
+	contexts[contextName] = &clientcmdapi.Context{
+		Cluster:   clusterName,
 		Namespace: namespace,
-		AuthInfo:  "default-user",
+		AuthInfo:  userName,
 	}
 
 	authinfos := make(map[string]*clientcmdapi.AuthInfo)
-	authinfos["default-user"] = &clientcmdapi.AuthInfo{
+	authinfos[userName] = &clientcmdapi.AuthInfo{
 		LocationOfOrigin:      "",
 		ClientCertificate:     "",
 		ClientCertificateData: cfg.CertData,
@@ -67,7 +77,7 @@ func BuildKubeConfig(cfg *rest.Config, namespace string) (*clientcmdapi.Config,
 		APIVersion:     "v1",
 		Clusters:       clusters,
 		Contexts:       contexts,
-		CurrentContext: "default-context",
+		CurrentContext: contextName,
 		AuthInfos:      authinfos,
 	}, nil
 }
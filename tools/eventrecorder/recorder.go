@@ -0,0 +1,457 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventrecorder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"kmodules.xyz/client-go/conditions"
+
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/tools/reference"
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/lru"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultSeriesUpdateInterval is the minimum interval between two updates of the same Event series.
+	DefaultSeriesUpdateInterval = 30 * time.Second
+	// DefaultSeriesTTL is the time after which a repeated event starts a new series instead of updating the old one.
+	DefaultSeriesTTL = 30 * time.Minute
+
+	defaultMaxSeries  = 4096
+	defaultQueueSize  = 1000
+	defaultBurst      = 25
+	defaultQPS        = 1. / 300.
+	writeTimeout      = 10 * time.Second
+	maxNoteLengthInV1 = 1024
+)
+
+type options struct {
+	instance       string
+	scheme         *runtime.Scheme
+	updateInterval time.Duration
+	ttl            time.Duration
+	qps            float32
+	burst          int
+	forceCoreV1    bool
+}
+
+type Option func(*options)
+
+// WithInstance sets the reporting instance of the Events. Defaults to the hostname.
+func WithInstance(instance string) Option {
+	return func(o *options) {
+		o.instance = instance
+	}
+}
+
+// WithScheme sets the scheme used to find the references of the objects. Only used with a kubernetes.Interface,
+// since a controller-runtime client carries its own scheme. Defaults to the client-go scheme.
+func WithScheme(scheme *runtime.Scheme) Option {
+	return func(o *options) {
+		o.scheme = scheme
+	}
+}
+
+// WithSeriesUpdateInterval sets the minimum interval between two updates of the same Event series.
+func WithSeriesUpdateInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.updateInterval = d
+	}
+}
+
+// WithSeriesTTL sets the time after which a repeated event starts a new Event series.
+func WithSeriesTTL(d time.Duration) Option {
+	return func(o *options) {
+		o.ttl = d
+	}
+}
+
+// WithRateLimit limits the number of distinct events recorded per object. Repeated events are aggregated
+// into a series and are not limited. Defaults to a burst of 25 and one event per 5 minutes afterwards.
+func WithRateLimit(qps float32, burst int) Option {
+	return func(o *options) {
+		o.qps = qps
+		o.burst = burst
+	}
+}
+
+// WithCoreV1Events records core/v1 Events even if the events.k8s.io/v1 api is available.
+func WithCoreV1Events() Option {
+	return func(o *options) {
+		o.forceCoreV1 = true
+	}
+}
+
+type seriesKey struct {
+	object    types.UID
+	kind      string
+	namespace string
+	name      string
+	eventType string
+	reason    string
+	message   string
+}
+
+type series struct {
+	key         seriesKey
+	ref         core.ObjectReference
+	annotations map[string]string
+	count       int32
+	first       time.Time
+	last        time.Time
+
+	// written is the last version of the Event written to the api server, nil until the Event is created.
+	written   client.Object
+	lastWrite time.Time
+	dirty     bool
+}
+
+// snapshot holds the state of a series at the time of a write.
+type snapshot struct {
+	ref         core.ObjectReference
+	annotations map[string]string
+	eventType   string
+	reason      string
+	message     string
+	count       int32
+	first       time.Time
+	last        time.Time
+}
+
+// Recorder records Kubernetes Events. Repeated events of an object with the same type, reason and message
+// are aggregated into a single Event whose count is updated at most once per series update interval.
+// events.k8s.io/v1 Events are used when the api server serves them, core/v1 Events otherwise.
+// Events are written in the background. Call Shutdown to flush the pending updates.
+//
+// Recorder implements record.EventRecorder, so it can be used with conditions.EventHook.
+type Recorder struct {
+	sink      sink
+	scheme    *runtime.Scheme
+	component string
+	instance  string
+	opts      options
+	now       func() time.Time
+
+	mu       sync.Mutex
+	series   *lru.Cache
+	limiters *lru.Cache
+	pending  map[seriesKey]*series
+	stopped  bool
+
+	// hookMu is separate from mu, since the transition hook calls Event while the
+	// conditions package holds its hook lock.
+	hookMu     sync.Mutex
+	removeHook func()
+
+	queue chan *series
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+var _ record.EventRecorder = &Recorder{}
+
+// NewForClientset returns a Recorder that writes Events with a kubernetes.Interface.
+func NewForClientset(kc kubernetes.Interface, component string, opts ...Option) *Recorder {
+	o := newOptions(opts)
+	scheme := o.scheme
+	if scheme == nil {
+		scheme = clientsetscheme.Scheme
+	}
+	var s sink = &coreClientsetSink{kc: kc}
+	if !o.forceCoreV1 && eventsV1ServedByClientset(kc) {
+		s = &eventsClientsetSink{kc: kc}
+	}
+	return newRecorder(s, scheme, component, o)
+}
+
+// NewForClient returns a Recorder that writes Events with a controller-runtime client.
+func NewForClient(c client.Client, component string, opts ...Option) *Recorder {
+	o := newOptions(opts)
+	s := &clientSink{c: c, eventsV1: !o.forceCoreV1 && eventsV1ServedByClient(c)}
+	return newRecorder(s, c.Scheme(), component, o)
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		updateInterval: DefaultSeriesUpdateInterval,
+		ttl:            DefaultSeriesTTL,
+		qps:            defaultQPS,
+		burst:          defaultBurst,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.instance == "" {
+		o.instance, _ = os.Hostname()
+	}
+	return o
+}
+
+func newRecorder(s sink, scheme *runtime.Scheme, component string, o options) *Recorder {
+	r := &Recorder{
+		sink:      s,
+		scheme:    scheme,
+		component: component,
+		instance:  o.instance,
+		opts:      o,
+		now:       time.Now,
+		series:    lru.New(defaultMaxSeries),
+		limiters:  lru.New(defaultMaxSeries),
+		pending:   map[seriesKey]*series{},
+		queue:     make(chan *series, defaultQueueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// RecordConditionTransitions registers a conditions.TransitionHook, so that every condition transition
+// made via conditions.Set is recorded as an Event of the object. The hook is registered once per
+// Recorder and removed by Shutdown.
+func (r *Recorder) RecordConditionTransitions() {
+	r.hookMu.Lock()
+	defer r.hookMu.Unlock()
+
+	r.mu.Lock()
+	stopped := r.stopped
+	r.mu.Unlock()
+	if stopped || r.removeHook != nil {
+		return
+	}
+	r.removeHook = conditions.AddTransitionHook(conditions.EventHook(r))
+}
+
+func (r *Recorder) Event(object runtime.Object, eventtype, reason, message string) {
+	r.record(object, nil, eventtype, reason, message)
+}
+
+func (r *Recorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	r.record(object, nil, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *Recorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	r.record(object, annotations, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+func (r *Recorder) record(object runtime.Object, annotations map[string]string, eventtype, reason, message string) {
+	ref, err := reference.GetReference(r.scheme, object)
+	if err != nil {
+		klog.Errorf("could not construct reference to %#v due to: %v, will not report event: %s %s %s", object, err, eventtype, reason, message)
+		return
+	}
+	if eventtype != core.EventTypeNormal && eventtype != core.EventTypeWarning {
+		klog.Errorf("unsupported event type %q, will not report event: %s %s", eventtype, reason, message)
+		return
+	}
+
+	key := seriesKey{
+		object:    ref.UID,
+		kind:      ref.Kind,
+		namespace: ref.Namespace,
+		name:      ref.Name,
+		eventType: eventtype,
+		reason:    reason,
+		message:   message,
+	}
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+
+	if v, ok := r.series.Get(key); ok {
+		s := v.(*series)
+		if now.Sub(s.last) < r.opts.ttl {
+			s.count++
+			s.last = now
+			if s.written != nil && now.Sub(s.lastWrite) >= r.opts.updateInterval {
+				r.enqueue(s)
+			} else {
+				s.dirty = true
+				r.pending[key] = s
+			}
+			return
+		}
+		delete(r.pending, key)
+	}
+
+	if !r.limiterFor(key).TryAccept() {
+		klog.V(4).Infof("rate limited event %s %s for %s %s/%s", eventtype, reason, ref.Kind, ref.Namespace, ref.Name)
+		return
+	}
+	s := &series{
+		key:         key,
+		ref:         *ref,
+		annotations: annotations,
+		count:       1,
+		first:       now,
+		last:        now,
+	}
+	r.series.Add(key, s)
+	r.enqueue(s)
+}
+
+func (r *Recorder) limiterFor(key seriesKey) flowcontrol.PassiveRateLimiter {
+	objKey := seriesKey{object: key.object, kind: key.kind, namespace: key.namespace, name: key.name}
+	if v, ok := r.limiters.Get(objKey); ok {
+		return v.(flowcontrol.PassiveRateLimiter)
+	}
+	l := flowcontrol.NewTokenBucketPassiveRateLimiter(r.opts.qps, r.opts.burst)
+	r.limiters.Add(objKey, l)
+	return l
+}
+
+// enqueue must be called with r.mu held.
+func (r *Recorder) enqueue(s *series) {
+	select {
+	case r.queue <- s:
+		s.dirty = false
+		delete(r.pending, s.key)
+	default:
+		// the worker will pick it up with the next flush
+		s.dirty = true
+		r.pending[s.key] = s
+		klog.V(4).Infof("event queue is full, delaying event %s %s", s.key.eventType, s.key.reason)
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.updateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case s := <-r.queue:
+			r.write(s)
+		case <-ticker.C:
+			r.flush(false)
+		case <-r.stop:
+			for {
+				select {
+				case s := <-r.queue:
+					r.write(s)
+				default:
+					r.flush(true)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes the pending series updates. Unless force is set, series updated within the
+// series update interval are skipped.
+func (r *Recorder) flush(force bool) {
+	now := r.now()
+	var due []*series
+	r.mu.Lock()
+	for key, s := range r.pending {
+		if force || (s.written != nil && now.Sub(s.lastWrite) >= r.opts.updateInterval) {
+			due = append(due, s)
+			delete(r.pending, key)
+		}
+	}
+	r.mu.Unlock()
+
+	for _, s := range due {
+		r.write(s)
+	}
+}
+
+func (r *Recorder) write(s *series) {
+	r.mu.Lock()
+	snap := snapshot{
+		ref:         s.ref,
+		annotations: s.annotations,
+		eventType:   s.key.eventType,
+		reason:      s.key.reason,
+		message:     s.key.message,
+		count:       s.count,
+		first:       s.first,
+		last:        s.last,
+	}
+	prev := s.written
+	s.dirty = false
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+	written, err := r.sink.write(ctx, r.newEvent(snap), prev)
+	if err != nil {
+		klog.Errorf("failed to write event %s %s for %s %s/%s: %v", snap.eventType, snap.reason, snap.ref.Kind, snap.ref.Namespace, snap.ref.Name, err)
+		if prev == nil {
+			// start a new series with the next occurrence
+			r.mu.Lock()
+			r.series.Remove(s.key)
+			delete(r.pending, s.key)
+			r.mu.Unlock()
+		}
+		return
+	}
+
+	r.mu.Lock()
+	s.written = written
+	s.lastWrite = r.now()
+	r.mu.Unlock()
+}
+
+func (r *Recorder) newEvent(s snapshot) eventBuilder {
+	return eventBuilder{
+		snapshot:  s,
+		component: r.component,
+		instance:  r.instance,
+	}
+}
+
+// Shutdown writes the pending Events and stops the Recorder. Events recorded afterwards are dropped.
+func (r *Recorder) Shutdown() {
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		<-r.done
+		return
+	}
+	r.stopped = true
+	r.mu.Unlock()
+
+	r.hookMu.Lock()
+	if r.removeHook != nil {
+		r.removeHook()
+		r.removeHook = nil
+	}
+	r.hookMu.Unlock()
+
+	close(r.stop)
+	<-r.done
+}
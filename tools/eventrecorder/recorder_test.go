@@ -0,0 +1,216 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventrecorder
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"kmodules.xyz/client-go/conditions"
+
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	clientsetscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	crfake "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func newPod() *core.Pod {
+	return &core.Pod{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Pod"},
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "demo", UID: "uid"},
+	}
+}
+
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) step(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestEventsV1Series(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	kc.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: eventsv1.SchemeGroupVersion.String(),
+			APIResources: []metav1.APIResource{{Name: "events", Namespaced: true, Kind: "Event"}},
+		},
+	}
+	r := NewForClientset(kc, "test-operator", WithInstance("test-0"), WithSeriesUpdateInterval(time.Hour))
+	clock := &fakeClock{t: time.Now()}
+	r.now = clock.now
+
+	pod := newPod()
+	for i := 0; i < 3; i++ {
+		r.Event(pod, core.EventTypeWarning, "Failed", "failed to pull image")
+		clock.step(time.Second)
+	}
+	r.Eventf(pod, core.EventTypeNormal, "Pulled", "pulled image %s", "nginx")
+	r.Shutdown()
+
+	events, err := kc.EventsV1().Events("demo").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 2 {
+		t.Fatalf("expected 2 events, found %d", len(events.Items))
+	}
+	for _, ev := range events.Items {
+		switch ev.Reason {
+		case "Failed":
+			if ev.Series == nil || ev.Series.Count != 3 {
+				t.Errorf("expected a series of 3 events, found %+v", ev.Series)
+			}
+			if ev.Regarding.Name != "foo" || ev.ReportingController != "test-operator" || ev.ReportingInstance != "test-0" {
+				t.Errorf("unexpected event %+v", ev)
+			}
+		case "Pulled":
+			if ev.Series != nil || ev.Note != "pulled image nginx" {
+				t.Errorf("unexpected event %+v", ev)
+			}
+		default:
+			t.Errorf("unexpected reason %s", ev.Reason)
+		}
+	}
+
+	r.Event(pod, core.EventTypeNormal, "Ignored", "recorded after shutdown")
+}
+
+func TestCoreV1RateLimit(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	r := NewForClientset(kc, "test-operator", WithRateLimit(0.0001, 2))
+
+	pod := newPod()
+	r.Event(pod, core.EventTypeWarning, "Failed", "error 1")
+	r.Event(pod, core.EventTypeWarning, "Failed", "error 2")
+	r.Event(pod, core.EventTypeWarning, "Failed", "error 3")
+	// repeated events are aggregated and not rate limited
+	r.Event(pod, core.EventTypeWarning, "Failed", "error 1")
+	r.Shutdown()
+
+	events, err := kc.CoreV1().Events("demo").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 2 {
+		t.Fatalf("expected 2 events, found %d", len(events.Items))
+	}
+	for _, ev := range events.Items {
+		if ev.Message == "error 1" && ev.Count != 2 {
+			t.Errorf("expected count 2, found %d", ev.Count)
+		}
+	}
+}
+
+func TestSeriesTTL(t *testing.T) {
+	kc := fake.NewSimpleClientset()
+	r := NewForClientset(kc, "test-operator", WithSeriesTTL(time.Minute))
+	clock := &fakeClock{t: time.Now()}
+	r.now = clock.now
+
+	pod := newPod()
+	r.Event(pod, core.EventTypeNormal, "Synced", "synced")
+	clock.step(2 * time.Minute)
+	r.Event(pod, core.EventTypeNormal, "Synced", "synced")
+	r.Shutdown()
+
+	events, err := kc.CoreV1().Events("demo").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 2 {
+		t.Fatalf("expected 2 events, found %d", len(events.Items))
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := crfake.NewClientBuilder().WithScheme(clientsetscheme.Scheme).Build()
+	r := NewForClient(c, "test-operator", WithCoreV1Events(), WithSeriesUpdateInterval(time.Hour))
+
+	pod := newPod()
+	r.Event(pod, core.EventTypeNormal, "Synced", "synced")
+	r.Event(pod, core.EventTypeNormal, "Synced", "synced")
+	r.Shutdown()
+
+	var events core.EventList
+	if err := c.List(context.TODO(), &events, client.InNamespace("demo")); err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 || events.Items[0].Count != 2 {
+		t.Fatalf("expected a single event with count 2, found %+v", events.Items)
+	}
+}
+
+type conditionedPod struct {
+	core.Pod
+	conditions kmapi.Conditions
+}
+
+func (p *conditionedPod) GetConditions() kmapi.Conditions {
+	return p.conditions
+}
+
+func (p *conditionedPod) SetConditions(c kmapi.Conditions) {
+	p.conditions = c
+}
+
+func TestRecordConditionTransitions(t *testing.T) {
+	defer conditions.ResetTransitionHooks()
+
+	kc := fake.NewSimpleClientset()
+	r := NewForClientset(kc, "test-operator")
+	r.RecordConditionTransitions()
+	r.RecordConditionTransitions()
+
+	pod := &conditionedPod{Pod: *newPod()}
+	conditions.MarkTrue(pod, kmapi.ReadyCondition)
+	r.Shutdown()
+	if r.removeHook != nil {
+		t.Errorf("expected Shutdown to remove the transition hook")
+	}
+	r.RecordConditionTransitions()
+	if r.removeHook != nil {
+		t.Errorf("expected no transition hook to be registered after Shutdown")
+	}
+
+	events, err := kc.CoreV1().Events("demo").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 event, found %d", len(events.Items))
+	}
+	if events.Items[0].Count != 1 {
+		t.Errorf("expected the transition to be recorded once, found count %d", events.Items[0].Count)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package eventrecorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	core_util "kmodules.xyz/client-go/core/v1"
+
+	core "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type sink interface {
+	// write creates the Event if prev is nil, or updates prev otherwise. It returns the written Event.
+	write(ctx context.Context, ev eventBuilder, prev client.Object) (client.Object, error)
+}
+
+type eventBuilder struct {
+	snapshot
+	component string
+	instance  string
+}
+
+func (b eventBuilder) namespace() string {
+	if b.ref.Namespace == "" {
+		return metav1.NamespaceDefault
+	}
+	return b.ref.Namespace
+}
+
+func (b eventBuilder) meta() metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        fmt.Sprintf("%v.%x", b.ref.Name, b.first.UnixNano()),
+		Namespace:   b.namespace(),
+		Annotations: b.annotations,
+	}
+}
+
+func (b eventBuilder) coreV1(prev client.Object) *core.Event {
+	var ev *core.Event
+	if prev != nil {
+		ev = prev.(*core.Event).DeepCopy()
+	} else {
+		ev = &core.Event{
+			ObjectMeta:          b.meta(),
+			InvolvedObject:      b.ref,
+			Reason:              b.reason,
+			Message:             b.message,
+			Type:                b.eventType,
+			FirstTimestamp:      metav1.NewTime(b.first),
+			Source:              core.EventSource{Component: b.component, Host: b.instance},
+			ReportingController: b.component,
+			ReportingInstance:   b.instance,
+		}
+	}
+	ev.Count = b.count
+	ev.LastTimestamp = metav1.NewTime(b.last)
+	return ev
+}
+
+func (b eventBuilder) eventsV1(prev client.Object) *eventsv1.Event {
+	var ev *eventsv1.Event
+	if prev != nil {
+		ev = prev.(*eventsv1.Event).DeepCopy()
+	} else {
+		note := b.message
+		if len(note) > maxNoteLengthInV1 {
+			note = note[:maxNoteLengthInV1]
+		}
+		ev = &eventsv1.Event{
+			ObjectMeta:          b.meta(),
+			EventTime:           metav1.NewMicroTime(b.first),
+			ReportingController: b.component,
+			ReportingInstance:   b.instance,
+			Action:              b.reason,
+			Reason:              b.reason,
+			Regarding:           b.ref,
+			Note:                note,
+			Type:                b.eventType,
+		}
+	}
+	if b.count > 1 {
+		ev.Series = &eventsv1.EventSeries{
+			Count:            b.count,
+			LastObservedTime: metav1.NewMicroTime(b.last),
+		}
+	}
+	return ev
+}
+
+func eventsV1ServedByClientset(kc kubernetes.Interface) bool {
+	resources, err := kc.Discovery().ServerResourcesForGroupVersion(eventsv1.SchemeGroupVersion.String())
+	if err != nil {
+		return false
+	}
+	for _, r := range resources.APIResources {
+		if r.Name == "events" {
+			return true
+		}
+	}
+	return false
+}
+
+func eventsV1ServedByClient(c client.Client) bool {
+	_, err := c.RESTMapper().RESTMapping(schema.GroupKind{Group: eventsv1.GroupName, Kind: "Event"}, eventsv1.SchemeGroupVersion.Version)
+	return err == nil
+}
+
+type coreClientsetSink struct {
+	kc kubernetes.Interface
+}
+
+func (s *coreClientsetSink) write(ctx context.Context, b eventBuilder, prev client.Object) (client.Object, error) {
+	if prev != nil {
+		out, _, err := core_util.PatchEventObject(ctx, s.kc, prev.(*core.Event), b.coreV1(prev), metav1.PatchOptions{})
+		if !kerr.IsNotFound(err) {
+			return out, err
+		}
+		// the Event expired, so it is created again
+	}
+	return s.kc.CoreV1().Events(b.namespace()).Create(ctx, b.coreV1(nil), metav1.CreateOptions{})
+}
+
+type eventsClientsetSink struct {
+	kc kubernetes.Interface
+}
+
+func (s *eventsClientsetSink) write(ctx context.Context, b eventBuilder, prev client.Object) (client.Object, error) {
+	if prev != nil {
+		out, err := s.patch(ctx, prev.(*eventsv1.Event), b.eventsV1(prev))
+		if !kerr.IsNotFound(err) {
+			return out, err
+		}
+	}
+	return s.kc.EventsV1().Events(b.namespace()).Create(ctx, b.eventsV1(nil), metav1.CreateOptions{})
+}
+
+func (s *eventsClientsetSink) patch(ctx context.Context, cur, mod *eventsv1.Event) (*eventsv1.Event, error) {
+	curJson, err := json.Marshal(cur)
+	if err != nil {
+		return nil, err
+	}
+	modJson, err := json.Marshal(mod)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := strategicpatch.CreateTwoWayMergePatch(curJson, modJson, eventsv1.Event{})
+	if err != nil {
+		return nil, err
+	}
+	if len(patch) == 0 || string(patch) == "{}" {
+		return cur, nil
+	}
+	return s.kc.EventsV1().Events(cur.Namespace).Patch(ctx, cur.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+}
+
+type clientSink struct {
+	c        client.Client
+	eventsV1 bool
+}
+
+func (s *clientSink) write(ctx context.Context, b eventBuilder, prev client.Object) (client.Object, error) {
+	newEvent := func(prev client.Object) client.Object {
+		if s.eventsV1 {
+			return b.eventsV1(prev)
+		}
+		return b.coreV1(prev)
+	}
+
+	if prev != nil {
+		mod := newEvent(prev)
+		err := s.c.Patch(ctx, mod, client.MergeFrom(prev))
+		if !kerr.IsNotFound(err) {
+			return mod, err
+		}
+	}
+	obj := newEvent(nil)
+	if err := s.c.Create(ctx, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
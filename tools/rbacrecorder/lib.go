@@ -0,0 +1,181 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbacrecorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	rbac_util "kmodules.xyz/client-go/rbac/v1"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/endpoints/request"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+)
+
+// Recorder collects the api requests made by the clients created from ConfigFor. Resource names are
+// dropped, so every distinct (verb, group, resource, subresource, namespace) is recorded once.
+// Namespace is empty for cluster scoped requests and requests across all namespaces.
+type Recorder struct {
+	mu       sync.Mutex
+	requests map[rbac_util.Request]struct{}
+	resolver *request.RequestInfoFactory
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{
+		requests: map[rbac_util.Request]struct{}{},
+		resolver: &request.RequestInfoFactory{
+			APIPrefixes:          sets.NewString("api", "apis"),
+			GrouplessAPIPrefixes: sets.NewString("api"),
+		},
+	}
+}
+
+// Record records the api request. Discovery requests are skipped since they are allowed for every
+// user by the system:discovery and system:public-info-viewer ClusterRoles.
+func (r *Recorder) Record(req *http.Request) {
+	info, err := r.resolver.NewRequestInfo(req)
+	if err != nil {
+		klog.V(5).Infof("failed to parse request %s %s: %v", req.Method, req.URL.Path, err)
+		return
+	}
+
+	var out rbac_util.Request
+	if info.IsResourceRequest {
+		out = rbac_util.Request{
+			Verb:        info.Verb,
+			APIGroup:    info.APIGroup,
+			Resource:    info.Resource,
+			Subresource: info.Subresource,
+			Namespace:   info.Namespace,
+			Name:        info.Name,
+		}
+		if info.APIGroup == "" && info.Resource == "namespaces" {
+			// namespaces are cluster scoped, even though the path contains the namespace
+			out.Namespace = ""
+		}
+	} else {
+		if isDiscovery(info.Path) {
+			return
+		}
+		out = rbac_util.Request{
+			Verb:           info.Verb,
+			NonResourceURL: info.Path,
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests[out] = struct{}{}
+}
+
+func isDiscovery(path string) bool {
+	switch {
+	case path == "/api", path == "/apis", path == "/version":
+		return true
+	case strings.HasPrefix(path, "/api/"),
+		strings.HasPrefix(path, "/apis/"),
+		strings.HasPrefix(path, "/openapi/"):
+		return true
+	}
+	return false
+}
+
+// Requests returns the recorded requests sorted by their string form.
+func (r *Recorder) Requests() []rbac_util.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]rbac_util.Request, 0, len(r.requests))
+	for req := range r.requests {
+		out = append(out, req)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].String() < out[j].String()
+	})
+	return out
+}
+
+// Add adds previously recorded requests, eg, loaded from the recording of another test run.
+func (r *Recorder) Add(reqs ...rbac_util.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, req := range reqs {
+		r.requests[req] = struct{}{}
+	}
+}
+
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = map[rbac_util.Request]struct{}{}
+}
+
+// Save writes the recorded requests to a json file.
+func (r *Recorder) Save(filename string) error {
+	data, err := json.MarshalIndent(r.Requests(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0o644)
+}
+
+// Load reads the requests saved by Recorder.Save.
+func Load(filename string) ([]rbac_util.Request, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var reqs []rbac_util.Request
+	if err := json.Unmarshal(data, &reqs); err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+type recordRequests struct {
+	rt       http.RoundTripper
+	recorder *Recorder
+}
+
+func (rt *recordRequests) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.recorder.Record(req)
+	return rt.rt.RoundTrip(req)
+}
+
+var _ http.RoundTripper = &recordRequests{}
+
+func fnRecordRequests(recorder *Recorder) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &recordRequests{rt, recorder}
+	}
+}
+
+// ConfigFor returns a copy of the config whose clients record their api requests with the recorder.
+// Requests are recorded before they are sent, so requests denied by the api server are recorded too.
+func ConfigFor(config *rest.Config, recorder *Recorder) *rest.Config {
+	c2 := rest.CopyConfig(config)
+	c2.Wrap(transport.Wrappers(fnRecordRequests(recorder)))
+	return c2
+}
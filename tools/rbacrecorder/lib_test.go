@@ -0,0 +1,119 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbacrecorder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	rbac_util "kmodules.xyz/client-go/rbac/v1"
+
+	apps "k8s.io/api/apps/v1"
+	rbac "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+func TestConfigFor(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"Forbidden","code":403}`, http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	rec := NewRecorder()
+	kc := kubernetes.NewForConfigOrDie(ConfigFor(&rest.Config{Host: srv.URL}, rec))
+	ctx := context.Background()
+	_, _ = kc.CoreV1().Secrets("demo").Get(ctx, "foo", metav1.GetOptions{})
+	_, _ = kc.CoreV1().Secrets("demo").Get(ctx, "bar", metav1.GetOptions{})
+	_, _ = kc.AppsV1().Deployments(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	_, _ = kc.AppsV1().Deployments("demo").UpdateStatus(ctx, &apps.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "demo"}}, metav1.UpdateOptions{})
+	_, _ = kc.CoreV1().Namespaces().Get(ctx, "demo", metav1.GetOptions{})
+	_, _ = kc.Discovery().ServerVersion()
+
+	want := []rbac_util.Request{
+		{Verb: "get", Resource: "namespaces", Name: "demo"},
+		{Verb: "get", Resource: "secrets", Namespace: "demo", Name: "bar"},
+		{Verb: "get", Resource: "secrets", Namespace: "demo", Name: "foo"},
+		{Verb: "list", APIGroup: "apps", Resource: "deployments"},
+		{Verb: "update", APIGroup: "apps", Resource: "deployments", Subresource: "status", Namespace: "demo", Name: "foo"},
+	}
+	if got := rec.Requests(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %+v, got %+v", want, got)
+	}
+
+	filename := filepath.Join(t.TempDir(), "requests.json")
+	if err := rec.Save(filename); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Load(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestRecordResourceNames(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, `{"kind":"Status","apiVersion":"v1","status":"Failure","reason":"NotFound","code":404}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	rec := NewRecorder()
+	kc := kubernetes.NewForConfigOrDie(ConfigFor(&rest.Config{Host: srv.URL}, rec))
+	_, _ = kc.CoreV1().Secrets("demo").Get(context.Background(), "operator-token", metav1.GetOptions{})
+	_, _ = kc.CoreV1().Secrets("demo").Get(context.Background(), "admin-token", metav1.GetOptions{})
+
+	operator := rbac.Subject{Kind: rbac.ServiceAccountKind, Name: "operator", Namespace: "demo"}
+	p, err := rbac_util.NewPolicy(
+		&rbac.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "demo"},
+			Rules: []rbac.PolicyRule{{
+				APIGroups:     []string{""},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{"operator-token"},
+				Verbs:         []string{"get"},
+			}},
+		},
+		&rbac.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "operator", Namespace: "demo"},
+			RoleRef:    rbac.RoleRef{Kind: "Role", Name: "operator"},
+			Subjects:   []rbac.Subject{operator},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"admin-token": false, "operator-token": true}
+	reqs := rec.Requests()
+	if len(reqs) != len(want) {
+		t.Fatalf("expected %d requests, got %+v", len(want), reqs)
+	}
+	for _, req := range reqs {
+		if got := p.Can(operator, req); got != want[req.Name] {
+			t.Errorf("expected Can(%s) to be %v, got %v", req, want[req.Name], got)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	kutil "kmodules.xyz/client-go"
+
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/klog/v2"
+)
+
+// Client is the subset of a typed client-go resource client used by the wait engine.
+// Every generated typed client (eg, c.AppsV1().Deployments(ns)) satisfies this interface.
+type Client[L runtime.Object] interface {
+	List(ctx context.Context, opts metav1.ListOptions) (L, error)
+	Watch(ctx context.Context, opts metav1.ListOptions) (watch.Interface, error)
+}
+
+// ErrTimeout is wrapped by the error returned when the wait times out before the predicate is satisfied.
+var ErrTimeout = errors.New("timed out waiting for readiness")
+
+// ErrFailed is wrapped by the error returned when the predicate reports a terminal failure.
+var ErrFailed = errors.New("readiness check failed")
+
+type options struct {
+	timeout       time.Duration
+	retryInterval time.Duration
+	readyIfAbsent bool
+}
+
+// Option configures a wait.
+type Option func(*options)
+
+// WithTimeout sets the maximum time to wait. A zero or negative timeout means wait until the context is done.
+// Defaults to kutil.ReadinessTimeout.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithRetryInterval sets the delay before a closed or failed watch is re-established.
+// Defaults to kutil.RetryInterval.
+func WithRetryInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.retryInterval = d
+	}
+}
+
+// ReadyIfNotFound makes Wait treat a missing object as ready, eg, a Job that was garbage collected after it finished.
+func ReadyIfNotFound() Option {
+	return func(o *options) {
+		o.readyIfAbsent = true
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		timeout:       kutil.ReadinessTimeout,
+		retryInterval: kutil.RetryInterval,
+	}
+	for _, fn := range opts {
+		fn(o)
+	}
+	return o
+}
+
+// Wait waits until the named object satisfies the predicate. It lists the object by name to get a consistent
+// resourceVersion, then watches for changes and re-evaluates the predicate on every event. The final Result is
+// always returned, so callers can report why an object did not become ready.
+func Wait[T runtime.Object, L runtime.Object](ctx context.Context, c Client[L], name string, check Predicate[T], opts ...Option) (Result, error) {
+	if name == "" {
+		return Result{}, errors.New("resource name must be provided")
+	}
+	listOpts := metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(kutil.ObjectNameField, name).String(),
+	}
+	o := newOptions(opts)
+	return run[T](ctx, c, listOpts, func(items []T) Result {
+		if len(items) == 0 {
+			if o.readyIfAbsent {
+				return Result{Ready: true, Reason: ReasonNotFound, Message: fmt.Sprintf("%s not found", name)}
+			}
+			return NotFound(name)
+		}
+		return check(items[0])
+	}, o)
+}
+
+// WaitForSelector waits until the set of objects matching the label selector satisfies the predicate.
+func WaitForSelector[T runtime.Object, L runtime.Object](ctx context.Context, c Client[L], selector labels.Selector, check ListPredicate[T], opts ...Option) (Result, error) {
+	listOpts := metav1.ListOptions{
+		LabelSelector: selector.String(),
+	}
+	return run[T](ctx, c, listOpts, check, newOptions(opts))
+}
+
+func run[T runtime.Object, L runtime.Object](ctx context.Context, c Client[L], listOpts metav1.ListOptions, eval ListPredicate[T], o *options) (Result, error) {
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+
+	last := Result{Reason: ReasonUnknown, Message: "readiness not evaluated yet"}
+	for {
+		items, rv, err := list[T](ctx, c, listOpts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return last, timeoutError(last, ctx.Err())
+			}
+			if !kutil.IsRequestRetryable(err) && !kerr.IsNotFound(err) {
+				return last, err
+			}
+			klog.V(4).Infof("failed to list objects for readiness check: %v", err)
+		} else {
+			last = eval(items.values())
+			if done, err := finished(last); done {
+				return last, err
+			}
+
+			last, err = watchUntil(ctx, c, listOpts, rv, items, eval, last)
+			if done, err2 := finished(last); done {
+				return last, err2
+			}
+			if ctx.Err() != nil {
+				return last, timeoutError(last, ctx.Err())
+			}
+			if err != nil {
+				klog.V(4).Infof("watch for readiness check failed, retrying: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return last, timeoutError(last, ctx.Err())
+		case <-time.After(o.retryInterval):
+		}
+	}
+}
+
+func list[T runtime.Object, L runtime.Object](ctx context.Context, c Client[L], listOpts metav1.ListOptions) (objectSet[T], string, error) {
+	out, err := c.List(ctx, listOpts)
+	if err != nil {
+		return nil, "", err
+	}
+	la, err := meta.ListAccessor(out)
+	if err != nil {
+		return nil, "", err
+	}
+	objs, err := meta.ExtractList(out)
+	if err != nil {
+		return nil, "", err
+	}
+	items := objectSet[T]{}
+	for _, obj := range objs {
+		if err := items.add(obj); err != nil {
+			return nil, "", err
+		}
+	}
+	return items, la.GetResourceVersion(), nil
+}
+
+// watchUntil watches from the given resourceVersion and re-evaluates the predicate after every event. It returns
+// when the result is final, the watch is closed or the context is done.
+func watchUntil[T runtime.Object, L runtime.Object](ctx context.Context, c Client[L], listOpts metav1.ListOptions, rv string, items objectSet[T], eval ListPredicate[T], last Result) (Result, error) {
+	watchOpts := listOpts
+	watchOpts.ResourceVersion = rv
+	watchOpts.AllowWatchBookmarks = true
+	w, err := c.Watch(ctx, watchOpts)
+	if err != nil {
+		return last, err
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return last, ctx.Err()
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return last, nil
+			}
+			switch event.Type {
+			case watch.Added, watch.Modified:
+				if err := items.add(event.Object); err != nil {
+					return last, err
+				}
+			case watch.Deleted:
+				if err := items.remove(event.Object); err != nil {
+					return last, err
+				}
+			case watch.Bookmark:
+				continue
+			case watch.Error:
+				// the server closes the watch for unrecoverable errors, so re-list instead of failing the wait.
+				return last, kerr.FromObject(event.Object)
+			}
+
+			last = eval(items.values())
+			if done, _ := finished(last); done {
+				return last, nil
+			}
+		}
+	}
+}
+
+func finished(r Result) (bool, error) {
+	switch {
+	case r.Ready:
+		return true, nil
+	case r.Failed:
+		return true, fmt.Errorf("%w: %s", ErrFailed, r)
+	}
+	return false, nil
+}
+
+func timeoutError(r Result, cause error) error {
+	if errors.Is(cause, context.DeadlineExceeded) {
+		return fmt.Errorf("%w: %s", ErrTimeout, r)
+	}
+	return fmt.Errorf("%w: %s", cause, r)
+}
+
+// objectSet holds the latest observed state of the watched objects, keyed by namespace/name.
+type objectSet[T runtime.Object] map[string]T
+
+func (s objectSet[T]) add(obj runtime.Object) error {
+	o, ok := obj.(T)
+	if !ok {
+		return fmt.Errorf("unexpected object type %T", obj)
+	}
+	key, err := objectKey(obj)
+	if err != nil {
+		return err
+	}
+	s[key] = o
+	return nil
+}
+
+func (s objectSet[T]) remove(obj runtime.Object) error {
+	key, err := objectKey(obj)
+	if err != nil {
+		return err
+	}
+	delete(s, key)
+	return nil
+}
+
+// values returns the objects sorted by key, so predicates see a stable order.
+func (s objectSet[T]) values() []T {
+	keys := make([]string, 0, len(s))
+	for k := range s {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]T, 0, len(s))
+	for _, k := range keys {
+		out = append(out, s[k])
+	}
+	return out
+}
+
+func objectKey(obj runtime.Object) (string, error) {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return "", err
+	}
+	return m.GetNamespace() + "/" + m.GetName(), nil
+}
@@ -0,0 +1,195 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gomodules.xyz/pointer"
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newDeployment(replicas int32) *apps.Deployment {
+	return &apps.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "demo",
+			Namespace:  "default",
+			Generation: 2,
+		},
+		Spec: apps.DeploymentSpec{
+			Replicas: pointer.Int32P(replicas),
+		},
+		Status: apps.DeploymentStatus{
+			ObservedGeneration: 1,
+		},
+	}
+}
+
+func TestWaitDeploymentBecomesReady(t *testing.T) {
+	dep := newDeployment(2)
+	c := fake.NewSimpleClientset(dep)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		d := dep.DeepCopy()
+		d.Status = apps.DeploymentStatus{
+			ObservedGeneration: 2,
+			Replicas:           2,
+			UpdatedReplicas:    2,
+			AvailableReplicas:  2,
+			ReadyReplicas:      2,
+		}
+		_, _ = c.AppsV1().Deployments(d.Namespace).UpdateStatus(context.TODO(), d, metav1.UpdateOptions{})
+	}()
+
+	r, err := Wait(context.TODO(), c.AppsV1().Deployments(dep.Namespace), dep.Name, DeploymentReady, WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.Ready || r.Reason != ReasonReady {
+		t.Errorf("expected ready result, got %+v", r)
+	}
+}
+
+func TestWaitDeploymentStuck(t *testing.T) {
+	dep := newDeployment(2)
+	dep.Status = apps.DeploymentStatus{
+		ObservedGeneration: 2,
+		Replicas:           2,
+		UpdatedReplicas:    1,
+		Conditions: []apps.DeploymentCondition{
+			{
+				Type:    apps.DeploymentProgressing,
+				Status:  core.ConditionFalse,
+				Reason:  ReasonProgressDeadline,
+				Message: `ReplicaSet "demo-abc" has timed out progressing.`,
+			},
+		},
+	}
+	c := fake.NewSimpleClientset(dep)
+
+	r, err := Wait(context.TODO(), c.AppsV1().Deployments(dep.Namespace), dep.Name, DeploymentReady, WithTimeout(5*time.Second))
+	if !errors.Is(err, ErrFailed) {
+		t.Fatalf("expected ErrFailed, got %v", err)
+	}
+	if r.Reason != ReasonProgressDeadline {
+		t.Errorf("expected reason %s, got %s", ReasonProgressDeadline, r.Reason)
+	}
+}
+
+func TestWaitTimeoutReportsLastResult(t *testing.T) {
+	dep := newDeployment(2)
+	c := fake.NewSimpleClientset(dep)
+
+	r, err := Wait(context.TODO(), c.AppsV1().Deployments(dep.Namespace), dep.Name, DeploymentReady, WithTimeout(200*time.Millisecond))
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if r.Reason != ReasonGenerationPending {
+		t.Errorf("expected reason %s, got %s", ReasonGenerationPending, r.Reason)
+	}
+}
+
+func TestWaitForSelector(t *testing.T) {
+	pod := func(name string, phase core.PodPhase, ready core.ConditionStatus) *core.Pod {
+		return &core.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{"app": "demo"},
+			},
+			Status: core.PodStatus{
+				Phase: phase,
+				Conditions: []core.PodCondition{
+					{Type: core.PodReady, Status: ready},
+				},
+			},
+		}
+	}
+	c := fake.NewSimpleClientset(
+		pod("demo-0", core.PodRunning, core.ConditionTrue),
+		pod("demo-1", core.PodPending, core.ConditionFalse),
+	)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = c.CoreV1().Pods("default").UpdateStatus(context.TODO(), pod("demo-1", core.PodRunning, core.ConditionTrue), metav1.UpdateOptions{})
+	}()
+
+	sel := labels.SelectorFromSet(map[string]string{"app": "demo"})
+	r, err := WaitForSelector(context.TODO(), c.CoreV1().Pods("default"), sel, Each(2, PodRunningAndReady), WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !r.Ready {
+		t.Errorf("expected ready result, got %+v", r)
+	}
+}
+
+func TestStatefulSetReadyPartition(t *testing.T) {
+	sts := &apps.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default", Generation: 1},
+		Spec: apps.StatefulSetSpec{
+			Replicas: pointer.Int32P(3),
+			UpdateStrategy: apps.StatefulSetUpdateStrategy{
+				Type: apps.RollingUpdateStatefulSetStrategyType,
+				RollingUpdate: &apps.RollingUpdateStatefulSetStrategy{
+					Partition: pointer.Int32P(2),
+				},
+			},
+		},
+		Status: apps.StatefulSetStatus{
+			ObservedGeneration: 1,
+			UpdatedReplicas:    1,
+			AvailableReplicas:  3,
+			ReadyReplicas:      3,
+			CurrentRevision:    "db-1",
+			UpdateRevision:     "db-2",
+		},
+	}
+	if r := StatefulSetReady(sts); !r.Ready {
+		t.Errorf("expected partitioned StatefulSet to be ready, got %+v", r)
+	}
+
+	sts.Spec.UpdateStrategy.RollingUpdate.Partition = nil
+	if r := StatefulSetReady(sts); r.Ready || r.Reason != ReasonUpdating {
+		t.Errorf("expected StatefulSet to be updating, got %+v", r)
+	}
+}
+
+func TestJobFinished(t *testing.T) {
+	job := &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Status: batch.JobStatus{
+			Conditions: []batch.JobCondition{{Type: batch.JobFailed, Status: core.ConditionTrue, Reason: "BackoffLimitExceeded"}},
+		},
+	}
+	if r := JobComplete(job); !r.Failed {
+		t.Errorf("expected JobComplete to fail, got %s", r)
+	}
+	if r := JobFinished(job); !r.Ready || r.Failed {
+		t.Errorf("expected JobFinished to be ready, got %s", r)
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"fmt"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	"kmodules.xyz/client-go/conditions"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ReasonReady              = "Ready"
+	ReasonNotFound           = "NotFound"
+	ReasonUnknown            = "Unknown"
+	ReasonGenerationPending  = "GenerationNotObserved"
+	ReasonUpdating           = "ReplicasUpdating"
+	ReasonNotAvailable       = "ReplicasNotAvailable"
+	ReasonNotReady           = "ReplicasNotReady"
+	ReasonTerminating        = "ReplicasTerminating"
+	ReasonProgressDeadline   = "ProgressDeadlineExceeded"
+	ReasonJobRunning         = "JobRunning"
+	ReasonJobFailed          = "JobFailed"
+	ReasonPodNotRunning      = "PodNotRunning"
+	ReasonPodFailed          = "PodFailed"
+	ReasonCountMismatch      = "CountMismatch"
+	ReasonConditionNotTrue   = "ConditionNotTrue"
+	ReasonConditionError     = "ConditionError"
+	ReasonConditionNotExists = "ConditionNotFound"
+)
+
+// Result is the outcome of evaluating a readiness predicate.
+type Result struct {
+	// Ready is true when the object reached the desired state.
+	Ready bool
+	// Failed is true when the object reached a state that will not resolve on its own, eg, a stuck rollout.
+	// The wait stops immediately when a predicate reports a failure.
+	Failed  bool
+	Reason  string
+	Message string
+}
+
+func (r Result) String() string {
+	if r.Message == "" {
+		return r.Reason
+	}
+	return fmt.Sprintf("%s: %s", r.Reason, r.Message)
+}
+
+// Predicate evaluates the readiness of a single object.
+type Predicate[T any] func(obj T) Result
+
+// ListPredicate evaluates the readiness of a set of objects.
+type ListPredicate[T any] func(items []T) Result
+
+func ready(msg string, args ...any) Result {
+	return Result{Ready: true, Reason: ReasonReady, Message: fmt.Sprintf(msg, args...)}
+}
+
+func inProgress(reason, msg string, args ...any) Result {
+	return Result{Reason: reason, Message: fmt.Sprintf(msg, args...)}
+}
+
+func failed(reason, msg string, args ...any) Result {
+	return Result{Failed: true, Reason: reason, Message: fmt.Sprintf(msg, args...)}
+}
+
+// NotFound returns the in progress result used while the named object does not exist.
+func NotFound(name string) Result {
+	return inProgress(ReasonNotFound, "%s not found", name)
+}
+
+// All returns a predicate that is ready only when every predicate is ready. The first non-ready result is returned.
+func All[T any](predicates ...Predicate[T]) Predicate[T] {
+	return func(obj T) Result {
+		var r Result
+		for _, p := range predicates {
+			if r = p(obj); !r.Ready {
+				return r
+			}
+		}
+		return r
+	}
+}
+
+// Each returns a list predicate that requires exactly count objects (or any number of objects if count < 0)
+// and every object to satisfy the predicate.
+func Each[T any](count int, p Predicate[T]) ListPredicate[T] {
+	return func(items []T) Result {
+		if count >= 0 && len(items) != count {
+			return inProgress(ReasonCountMismatch, "expected %d objects, found %d", count, len(items))
+		}
+		for _, item := range items {
+			if r := p(item); !r.Ready {
+				return r
+			}
+		}
+		return ready("all %d objects are ready", len(items))
+	}
+}
+
+func desiredReplicas(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+func generationObserved(meta metav1.ObjectMeta, observedGeneration int64, kind string) (Result, bool) {
+	if observedGeneration < meta.Generation {
+		return inProgress(ReasonGenerationPending, "%s %s/%s generation %d is not observed yet, observed generation %d", kind, meta.Namespace, meta.Name, meta.Generation, observedGeneration), false
+	}
+	return Result{}, true
+}
+
+// DeploymentReady checks that the latest generation of a Deployment is fully rolled out. It fails fast when the
+// Progressing condition reports that the progress deadline was exceeded.
+func DeploymentReady(obj *apps.Deployment) Result {
+	if r, ok := generationObserved(obj.ObjectMeta, obj.Status.ObservedGeneration, "Deployment"); !ok {
+		return r
+	}
+	for _, c := range obj.Status.Conditions {
+		if c.Type == apps.DeploymentProgressing && c.Status == core.ConditionFalse && c.Reason == ReasonProgressDeadline {
+			return failed(ReasonProgressDeadline, "Deployment %s/%s rollout is stuck: %s", obj.Namespace, obj.Name, c.Message)
+		}
+	}
+
+	replicas := desiredReplicas(obj.Spec.Replicas)
+	switch {
+	case obj.Status.UpdatedReplicas < replicas:
+		return inProgress(ReasonUpdating, "Deployment %s/%s has %d of %d updated replicas", obj.Namespace, obj.Name, obj.Status.UpdatedReplicas, replicas)
+	case obj.Status.Replicas > obj.Status.UpdatedReplicas:
+		return inProgress(ReasonTerminating, "Deployment %s/%s has %d old replicas pending termination", obj.Namespace, obj.Name, obj.Status.Replicas-obj.Status.UpdatedReplicas)
+	case obj.Status.AvailableReplicas < replicas:
+		return inProgress(ReasonNotAvailable, "Deployment %s/%s has %d of %d available replicas", obj.Namespace, obj.Name, obj.Status.AvailableReplicas, replicas)
+	case obj.Status.ReadyReplicas < replicas:
+		return inProgress(ReasonNotReady, "Deployment %s/%s has %d of %d ready replicas", obj.Namespace, obj.Name, obj.Status.ReadyReplicas, replicas)
+	}
+	return ready("Deployment %s/%s has %d ready replicas", obj.Namespace, obj.Name, replicas)
+}
+
+// StatefulSetReady checks that the latest generation of a StatefulSet is fully rolled out.
+func StatefulSetReady(obj *apps.StatefulSet) Result {
+	if r, ok := generationObserved(obj.ObjectMeta, obj.Status.ObservedGeneration, "StatefulSet"); !ok {
+		return r
+	}
+
+	replicas := desiredReplicas(obj.Spec.Replicas)
+	if obj.Spec.UpdateStrategy.Type == apps.RollingUpdateStatefulSetStrategyType {
+		partition := int32(0)
+		if obj.Spec.UpdateStrategy.RollingUpdate != nil && obj.Spec.UpdateStrategy.RollingUpdate.Partition != nil {
+			partition = *obj.Spec.UpdateStrategy.RollingUpdate.Partition
+		}
+		if expected := replicas - partition; obj.Status.UpdatedReplicas < expected {
+			return inProgress(ReasonUpdating, "StatefulSet %s/%s has %d of %d updated replicas", obj.Namespace, obj.Name, obj.Status.UpdatedReplicas, expected)
+		}
+		if partition == 0 && obj.Status.UpdateRevision != "" && obj.Status.CurrentRevision != obj.Status.UpdateRevision {
+			return inProgress(ReasonUpdating, "StatefulSet %s/%s is rolling out revision %s", obj.Namespace, obj.Name, obj.Status.UpdateRevision)
+		}
+	}
+	switch {
+	case obj.Status.AvailableReplicas < replicas:
+		return inProgress(ReasonNotAvailable, "StatefulSet %s/%s has %d of %d available replicas", obj.Namespace, obj.Name, obj.Status.AvailableReplicas, replicas)
+	case obj.Status.ReadyReplicas < replicas:
+		return inProgress(ReasonNotReady, "StatefulSet %s/%s has %d of %d ready replicas", obj.Namespace, obj.Name, obj.Status.ReadyReplicas, replicas)
+	}
+	return ready("StatefulSet %s/%s has %d ready replicas", obj.Namespace, obj.Name, replicas)
+}
+
+// DaemonSetReady checks that the latest generation of a DaemonSet is running on every scheduled node.
+func DaemonSetReady(obj *apps.DaemonSet) Result {
+	if r, ok := generationObserved(obj.ObjectMeta, obj.Status.ObservedGeneration, "DaemonSet"); !ok {
+		return r
+	}
+
+	desired := obj.Status.DesiredNumberScheduled
+	switch {
+	case obj.Spec.UpdateStrategy.Type == apps.RollingUpdateDaemonSetStrategyType && obj.Status.UpdatedNumberScheduled < desired:
+		return inProgress(ReasonUpdating, "DaemonSet %s/%s has %d of %d updated pods", obj.Namespace, obj.Name, obj.Status.UpdatedNumberScheduled, desired)
+	case obj.Status.NumberAvailable < desired:
+		return inProgress(ReasonNotAvailable, "DaemonSet %s/%s has %d of %d available pods", obj.Namespace, obj.Name, obj.Status.NumberAvailable, desired)
+	case obj.Status.NumberReady < desired:
+		return inProgress(ReasonNotReady, "DaemonSet %s/%s has %d of %d ready pods", obj.Namespace, obj.Name, obj.Status.NumberReady, desired)
+	}
+	return ready("DaemonSet %s/%s has %d ready pods", obj.Namespace, obj.Name, desired)
+}
+
+// ReplicaSetReady checks that every desired replica of a ReplicaSet is available and ready.
+func ReplicaSetReady(obj *apps.ReplicaSet) Result {
+	if r, ok := generationObserved(obj.ObjectMeta, obj.Status.ObservedGeneration, "ReplicaSet"); !ok {
+		return r
+	}
+
+	replicas := desiredReplicas(obj.Spec.Replicas)
+	switch {
+	case obj.Status.AvailableReplicas < replicas:
+		return inProgress(ReasonNotAvailable, "ReplicaSet %s/%s has %d of %d available replicas", obj.Namespace, obj.Name, obj.Status.AvailableReplicas, replicas)
+	case obj.Status.ReadyReplicas < replicas:
+		return inProgress(ReasonNotReady, "ReplicaSet %s/%s has %d of %d ready replicas", obj.Namespace, obj.Name, obj.Status.ReadyReplicas, replicas)
+	}
+	return ready("ReplicaSet %s/%s has %d ready replicas", obj.Namespace, obj.Name, replicas)
+}
+
+// JobComplete checks that a Job completed. It fails when the Job reports a Failed condition.
+func JobComplete(obj *batch.Job) Result {
+	for _, c := range obj.Status.Conditions {
+		if c.Status != core.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batch.JobComplete:
+			return ready("Job %s/%s completed", obj.Namespace, obj.Name)
+		case batch.JobFailed:
+			return failed(ReasonJobFailed, "Job %s/%s failed: %s %s", obj.Namespace, obj.Name, c.Reason, c.Message)
+		}
+	}
+	return inProgress(ReasonJobRunning, "Job %s/%s has %d active, %d succeeded and %d failed pods", obj.Namespace, obj.Name, obj.Status.Active, obj.Status.Succeeded, obj.Status.Failed)
+}
+
+// JobFinished checks that a Job completed or failed. Unlike JobComplete, a failed Job is not reported as a
+// failure, since the Job will not run again either way.
+func JobFinished(obj *batch.Job) Result {
+	r := JobComplete(obj)
+	if r.Failed {
+		return ready("Job %s/%s finished: %s", obj.Namespace, obj.Name, r.Message)
+	}
+	return r
+}
+
+// PodRunningAndReady checks that a Pod is running and its Ready condition is true. A Pod in a terminal phase
+// fails the check, since it will never become ready.
+func PodRunningAndReady(obj *core.Pod) Result {
+	switch obj.Status.Phase {
+	case core.PodFailed, core.PodSucceeded:
+		return failed(ReasonPodFailed, "Pod %s/%s is in terminal phase %s: %s", obj.Namespace, obj.Name, obj.Status.Phase, obj.Status.Message)
+	case core.PodRunning:
+		for _, c := range obj.Status.Conditions {
+			if c.Type == core.PodReady {
+				if c.Status == core.ConditionTrue {
+					return ready("Pod %s/%s is running and ready", obj.Namespace, obj.Name)
+				}
+				return inProgress(ReasonNotReady, "Pod %s/%s is not ready: %s %s", obj.Namespace, obj.Name, c.Reason, c.Message)
+			}
+		}
+		return inProgress(ReasonNotReady, "Pod %s/%s ready condition not found", obj.Namespace, obj.Name)
+	}
+	return inProgress(ReasonPodNotRunning, "Pod %s/%s is in phase %s", obj.Namespace, obj.Name, obj.Status.Phase)
+}
+
+// ConditionsReady returns a predicate for objects following the kmapi.Condition conventions. The object is ready
+// when the given condition type (Ready, if not specified) is true for the latest observed generation. A false
+// condition with Error severity fails the check.
+func ConditionsReady[T conditions.Getter](condType ...kmapi.ConditionType) Predicate[T] {
+	t := kmapi.ReadyCondition
+	if len(condType) > 0 {
+		t = condType[0]
+	}
+	return func(obj T) Result {
+		c := conditions.Get(obj, t)
+		switch {
+		case c == nil:
+			return inProgress(ReasonConditionNotExists, "%s condition not found for %s", t, obj.GetName())
+		case c.ObservedGeneration > 0 && c.ObservedGeneration < obj.GetGeneration():
+			return inProgress(ReasonGenerationPending, "%s condition of %s is based on generation %d, current generation %d", t, obj.GetName(), c.ObservedGeneration, obj.GetGeneration())
+		case c.Status == metav1.ConditionTrue:
+			return ready("%s condition of %s is true", t, obj.GetName())
+		case c.Status == metav1.ConditionFalse && c.Severity == kmapi.ConditionSeverityError:
+			return failed(ReasonConditionError, "%s condition of %s is false: %s %s", t, obj.GetName(), c.Reason, c.Message)
+		}
+		return inProgress(ReasonConditionNotTrue, "%s condition of %s is %s: %s %s", t, obj.GetName(), c.Status, c.Reason, c.Message)
+	}
+}
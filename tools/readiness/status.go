@@ -0,0 +1,208 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"fmt"
+
+	kmapi "kmodules.xyz/client-go/api/v1"
+	meta_util "kmodules.xyz/client-go/meta"
+
+	apps "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	crdv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// ConditionReconciling and ConditionStalled are the abnormal-true condition types used by kstatus.
+	// https://github.com/kubernetes-sigs/cli-utils/blob/master/pkg/kstatus/README.md
+	ConditionReconciling kmapi.ConditionType = "Reconciling"
+	ConditionStalled     kmapi.ConditionType = "Stalled"
+)
+
+// StatusResult is the normalized status of an object.
+type StatusResult struct {
+	Status  meta_util.Status
+	Reason  string
+	Message string
+}
+
+// StatusFunc computes the status of a known kind. Registered functions are called after the generic
+// NotFound, Terminating and observedGeneration checks.
+type StatusFunc func(u *unstructured.Unstructured) (StatusResult, error)
+
+var statusFuncs = map[schema.GroupKind]StatusFunc{
+	{Group: apps.GroupName, Kind: "Deployment"}:                typedStatus(DeploymentReady),
+	{Group: apps.GroupName, Kind: "StatefulSet"}:               typedStatus(StatefulSetReady),
+	{Group: apps.GroupName, Kind: "DaemonSet"}:                 typedStatus(DaemonSetReady),
+	{Group: apps.GroupName, Kind: "ReplicaSet"}:                typedStatus(ReplicaSetReady),
+	{Group: batch.GroupName, Kind: "Job"}:                      typedStatus(JobComplete),
+	{Group: core.GroupName, Kind: "Pod"}:                       typedStatus(podStatus),
+	{Group: core.GroupName, Kind: "PersistentVolumeClaim"}:     typedStatus(pvcStatus),
+	{Group: core.GroupName, Kind: "Service"}:                   typedStatus(serviceStatus),
+	{Group: crdv1.GroupName, Kind: "CustomResourceDefinition"}: typedStatus(crdStatus),
+}
+
+// RegisterStatusFunc registers the status function for a GroupKind, replacing any existing one.
+// It is not safe to call concurrently with ComputeStatus.
+func RegisterStatusFunc(gk schema.GroupKind, fn StatusFunc) {
+	statusFuncs[gk] = fn
+}
+
+// ComputeStatus computes a kstatus style normalized status for an arbitrary object. A nil object is NotFound.
+// Built-in workloads, Jobs, Pods, PVCs, Services and CRDs are evaluated by kind. Any other object is evaluated
+// using its status.conditions following the kmapi.Condition conventions: the Ready condition decides the status
+// and a false Ready condition with Error severity is Failed. Objects without conditions are Current once their
+// latest generation is observed.
+func ComputeStatus(u *unstructured.Unstructured) (StatusResult, error) {
+	if u == nil {
+		return StatusResult{Status: meta_util.NotFoundStatus, Reason: ReasonNotFound, Message: "object not found"}, nil
+	}
+	if u.GetDeletionTimestamp() != nil {
+		return StatusResult{Status: meta_util.TerminatingStatus, Reason: "Terminating", Message: "object is being deleted"}, nil
+	}
+
+	reconciled, err := meta_util.AlreadyReconciled(u)
+	if err != nil {
+		return StatusResult{}, err
+	}
+	if !reconciled {
+		if _, found, _ := unstructured.NestedFieldNoCopy(u.Object, "status", "observedGeneration"); found {
+			return StatusResult{
+				Status:  meta_util.InProgressStatus,
+				Reason:  ReasonGenerationPending,
+				Message: fmt.Sprintf("generation %d is not observed yet", u.GetGeneration()),
+			}, nil
+		}
+	}
+
+	if fn, ok := statusFuncs[u.GroupVersionKind().GroupKind()]; ok {
+		return fn(u)
+	}
+	return conditionsStatus(u)
+}
+
+func typedStatus[T any, PT interface {
+	*T
+	runtime.Object
+}](p Predicate[PT]) StatusFunc {
+	return func(u *unstructured.Unstructured) (StatusResult, error) {
+		var obj T
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), &obj); err != nil {
+			return StatusResult{}, err
+		}
+		return toStatusResult(p(&obj)), nil
+	}
+}
+
+func toStatusResult(r Result) StatusResult {
+	out := StatusResult{Status: meta_util.InProgressStatus, Reason: r.Reason, Message: r.Message}
+	switch {
+	case r.Ready:
+		out.Status = meta_util.CurrentStatus
+	case r.Failed:
+		out.Status = meta_util.FailedStatus
+	}
+	return out
+}
+
+func conditionsStatus(u *unstructured.Unstructured) (StatusResult, error) {
+	var status struct {
+		Conditions kmapi.Conditions `json:"conditions,omitempty"`
+	}
+	if s, ok := u.Object["status"].(map[string]any); ok {
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(s, &status); err != nil {
+			return StatusResult{}, err
+		}
+	}
+
+	for _, c := range status.Conditions {
+		if c.Status != metav1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case ConditionStalled:
+			return toStatusResult(failed(c.Reason, "%s", c.Message)), nil
+		case ConditionReconciling:
+			return toStatusResult(inProgress(c.Reason, "%s", c.Message)), nil
+		}
+	}
+	for _, c := range status.Conditions {
+		if c.Type != kmapi.ReadyCondition {
+			continue
+		}
+		switch {
+		case c.ObservedGeneration > 0 && c.ObservedGeneration < u.GetGeneration():
+			return toStatusResult(inProgress(ReasonGenerationPending, "%s condition is based on generation %d", c.Type, c.ObservedGeneration)), nil
+		case c.Status == metav1.ConditionTrue:
+			return toStatusResult(ready("%s", c.Message)), nil
+		case c.Status == metav1.ConditionFalse && c.Severity == kmapi.ConditionSeverityError:
+			return toStatusResult(failed(c.Reason, "%s", c.Message)), nil
+		}
+		return toStatusResult(inProgress(c.Reason, "%s", c.Message)), nil
+	}
+	return toStatusResult(ready("resource is current")), nil
+}
+
+// podStatus treats completed pods as Current and containers in CrashLoopBackOff as Failed.
+func podStatus(obj *core.Pod) Result {
+	if obj.Status.Phase == core.PodSucceeded {
+		return ready("Pod %s/%s succeeded", obj.Namespace, obj.Name)
+	}
+	for _, cs := range obj.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason == "CrashLoopBackOff" {
+			return failed(ReasonPodFailed, "container %s of Pod %s/%s is in CrashLoopBackOff: %s", cs.Name, obj.Namespace, obj.Name, cs.State.Waiting.Message)
+		}
+	}
+	return PodRunningAndReady(obj)
+}
+
+func pvcStatus(obj *core.PersistentVolumeClaim) Result {
+	switch obj.Status.Phase {
+	case core.ClaimBound:
+		return ready("PersistentVolumeClaim %s/%s is bound", obj.Namespace, obj.Name)
+	case core.ClaimLost:
+		return failed("ClaimLost", "PersistentVolumeClaim %s/%s lost its volume", obj.Namespace, obj.Name)
+	}
+	return inProgress("NotBound", "PersistentVolumeClaim %s/%s is %s", obj.Namespace, obj.Name, obj.Status.Phase)
+}
+
+func serviceStatus(obj *core.Service) Result {
+	if obj.Spec.Type == core.ServiceTypeLoadBalancer && len(obj.Status.LoadBalancer.Ingress) == 0 {
+		return inProgress("LoadBalancerPending", "Service %s/%s is waiting for a load balancer", obj.Namespace, obj.Name)
+	}
+	return ready("Service %s/%s is ready", obj.Namespace, obj.Name)
+}
+
+func crdStatus(obj *crdv1.CustomResourceDefinition) Result {
+	for _, c := range obj.Status.Conditions {
+		if c.Type == crdv1.NamesAccepted && c.Status == crdv1.ConditionFalse {
+			return failed(c.Reason, "CustomResourceDefinition %s names are not accepted: %s", obj.Name, c.Message)
+		}
+	}
+	for _, c := range obj.Status.Conditions {
+		if c.Type == crdv1.Established && c.Status == crdv1.ConditionTrue {
+			return ready("CustomResourceDefinition %s is established", obj.Name)
+		}
+	}
+	return inProgress("NotEstablished", "CustomResourceDefinition %s is not established", obj.Name)
+}
@@ -0,0 +1,177 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"testing"
+
+	meta_util "kmodules.xyz/client-go/meta"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestComputeStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  *unstructured.Unstructured
+		want meta_util.Status
+	}{
+		{
+			name: "not found",
+			obj:  nil,
+			want: meta_util.NotFoundStatus,
+		},
+		{
+			name: "terminating",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "ConfigMap",
+				"metadata":   map[string]any{"name": "cm", "deletionTimestamp": "2024-01-01T00:00:00Z"},
+			}},
+			want: meta_util.TerminatingStatus,
+		},
+		{
+			name: "generation not observed",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "d", "generation": int64(3)},
+				"status":     map[string]any{"observedGeneration": int64(2)},
+			}},
+			want: meta_util.InProgressStatus,
+		},
+		{
+			name: "deployment ready",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "apps/v1",
+				"kind":       "Deployment",
+				"metadata":   map[string]any{"name": "d", "generation": int64(1)},
+				"spec":       map[string]any{"replicas": int64(1)},
+				"status": map[string]any{
+					"observedGeneration": int64(1),
+					"replicas":           int64(1),
+					"updatedReplicas":    int64(1),
+					"availableReplicas":  int64(1),
+					"readyReplicas":      int64(1),
+				},
+			}},
+			want: meta_util.CurrentStatus,
+		},
+		{
+			name: "job failed",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "batch/v1",
+				"kind":       "Job",
+				"metadata":   map[string]any{"name": "j"},
+				"status": map[string]any{
+					"conditions": []any{
+						map[string]any{"type": "Failed", "status": "True", "reason": "BackoffLimitExceeded"},
+					},
+				},
+			}},
+			want: meta_util.FailedStatus,
+		},
+		{
+			name: "pvc pending",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "PersistentVolumeClaim",
+				"metadata":   map[string]any{"name": "data"},
+				"status":     map[string]any{"phase": "Pending"},
+			}},
+			want: meta_util.InProgressStatus,
+		},
+		{
+			name: "load balancer service without ingress",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "v1",
+				"kind":       "Service",
+				"metadata":   map[string]any{"name": "svc"},
+				"spec":       map[string]any{"type": "LoadBalancer"},
+			}},
+			want: meta_util.InProgressStatus,
+		},
+		{
+			name: "custom resource with error severity",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "kubedb.com/v1",
+				"kind":       "Postgres",
+				"metadata":   map[string]any{"name": "pg", "generation": int64(1)},
+				"status": map[string]any{
+					"observedGeneration": int64(1),
+					"conditions": []any{
+						map[string]any{"type": "Ready", "status": "False", "severity": "Error", "reason": "DatabaseDown"},
+					},
+				},
+			}},
+			want: meta_util.FailedStatus,
+		},
+		{
+			name: "custom resource with warning severity",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "kubedb.com/v1",
+				"kind":       "Postgres",
+				"metadata":   map[string]any{"name": "pg"},
+				"status": map[string]any{
+					"conditions": []any{
+						map[string]any{"type": "Ready", "status": "False", "severity": "Warning", "reason": "Provisioning"},
+					},
+				},
+			}},
+			want: meta_util.InProgressStatus,
+		},
+		{
+			name: "custom resource ready",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "kubedb.com/v1",
+				"kind":       "Postgres",
+				"metadata":   map[string]any{"name": "pg"},
+				"status": map[string]any{
+					"conditions": []any{
+						map[string]any{"type": "Ready", "status": "True", "lastTransitionTime": "2024-01-01T00:00:00Z"},
+					},
+				},
+			}},
+			want: meta_util.CurrentStatus,
+		},
+		{
+			name: "custom resource stalled",
+			obj: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.com/v1",
+				"kind":       "Widget",
+				"metadata":   map[string]any{"name": "w"},
+				"status": map[string]any{
+					"conditions": []any{
+						map[string]any{"type": "Stalled", "status": "True", "reason": "InvalidSpec"},
+					},
+				},
+			}},
+			want: meta_util.FailedStatus,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ComputeStatus(tt.obj)
+			if err != nil {
+				t.Fatalf("ComputeStatus() error = %v", err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("ComputeStatus() = %+v, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package satoken
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	core_util "kmodules.xyz/client-go/core/v1"
+	"kmodules.xyz/client-go/tools/clientcmd"
+
+	"github.com/pkg/errors"
+	authv1 "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/client-go/transport"
+	"k8s.io/klog/v2"
+	"k8s.io/utils/ptr"
+)
+
+const (
+	// DefaultExpiration is the requested lifetime of the tokens.
+	DefaultExpiration = time.Hour
+	// MinExpiration is the shortest token lifetime accepted by the api server.
+	MinExpiration = 10 * time.Minute
+
+	// tokens are refreshed once this fraction of their lifetime has passed, like the kubelet does
+	refreshFraction = 0.8
+)
+
+// Token is a ServiceAccount token issued by the TokenRequest api, or read from a legacy token Secret.
+type Token struct {
+	Token string
+	// ExpirationTime is zero for legacy tokens, which do not expire.
+	ExpirationTime time.Time
+	// Legacy is true if the token was read from a kubernetes.io/service-account-token Secret.
+	Legacy bool
+	// CAData is the ca.crt of the legacy token Secret.
+	CAData []byte
+
+	refreshAt time.Time
+}
+
+type options struct {
+	audiences      []string
+	expiration     time.Duration
+	boundObject    *authv1.BoundObjectReference
+	legacyFallback bool
+}
+
+type Option func(*options)
+
+// WithAudiences sets the intended audiences of the tokens. Defaults to the audience of the api server.
+func WithAudiences(audiences ...string) Option {
+	return func(o *options) {
+		o.audiences = audiences
+	}
+}
+
+// WithExpiration sets the requested lifetime of the tokens. Defaults to DefaultExpiration.
+// The api server may issue tokens with a different lifetime.
+func WithExpiration(d time.Duration) Option {
+	return func(o *options) {
+		o.expiration = d
+	}
+}
+
+// WithBoundObject binds the tokens to a Pod or Secret, so that they are invalidated when the object is deleted.
+func WithBoundObject(ref authv1.BoundObjectReference) Option {
+	return func(o *options) {
+		o.boundObject = &ref
+	}
+}
+
+// WithoutLegacyFallback returns an error instead of reading a legacy token Secret when the cluster does not
+// support the TokenRequest api.
+func WithoutLegacyFallback() Option {
+	return func(o *options) {
+		o.legacyFallback = false
+	}
+}
+
+// TokenProvider issues tokens of a ServiceAccount using the TokenRequest api. Tokens are cached and
+// refreshed before they expire. On clusters without the TokenRequest api, the token is read from a
+// legacy token Secret, which is created if needed.
+type TokenProvider struct {
+	kc   kubernetes.Interface
+	sa   types.NamespacedName
+	opts options
+	now  func() time.Time
+
+	mu     sync.Mutex
+	cached *Token
+}
+
+func NewTokenProvider(kc kubernetes.Interface, sa types.NamespacedName, opts ...Option) *TokenProvider {
+	o := options{
+		expiration:     DefaultExpiration,
+		legacyFallback: true,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.expiration < MinExpiration {
+		o.expiration = MinExpiration
+	}
+	return &TokenProvider{
+		kc:   kc,
+		sa:   sa,
+		opts: o,
+		now:  time.Now,
+	}
+}
+
+// Token returns a cached token, or requests a new one if the cached token is about to expire.
+func (p *TokenProvider) Token(ctx context.Context) (*Token, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached != nil && (p.cached.Legacy || p.now().Before(p.cached.refreshAt)) {
+		return p.cached, nil
+	}
+
+	token, err := p.requestToken(ctx)
+	if err != nil {
+		if p.cached != nil && p.now().Before(p.cached.ExpirationTime) {
+			klog.Warningf("failed to refresh token of ServiceAccount %s, using the cached token: %v", p.sa, err)
+			return p.cached, nil
+		}
+		return nil, err
+	}
+	p.cached = token
+	return token, nil
+}
+
+func (p *TokenProvider) requestToken(ctx context.Context) (*Token, error) {
+	req := &authv1.TokenRequest{
+		Spec: authv1.TokenRequestSpec{
+			Audiences:         p.opts.audiences,
+			ExpirationSeconds: ptr.To(int64(p.opts.expiration.Seconds())),
+			BoundObjectRef:    p.opts.boundObject,
+		},
+	}
+	issued := p.now()
+	resp, err := p.kc.CoreV1().ServiceAccounts(p.sa.Namespace).CreateToken(ctx, p.sa.Name, req, metav1.CreateOptions{})
+	if err == nil {
+		exp := resp.Status.ExpirationTimestamp.Time
+		return &Token{
+			Token:          resp.Status.Token,
+			ExpirationTime: exp,
+			refreshAt:      issued.Add(time.Duration(refreshFraction * float64(exp.Sub(issued)))),
+		}, nil
+	}
+	if !p.opts.legacyFallback || !tokenRequestUnsupported(err) {
+		return nil, errors.Wrapf(err, "failed to request token for ServiceAccount %s", p.sa)
+	}
+	if kerr.IsNotFound(err) {
+		// the api server returns NotFound both for a missing ServiceAccount and a missing token subresource
+		if _, e2 := p.kc.CoreV1().ServiceAccounts(p.sa.Namespace).Get(ctx, p.sa.Name, metav1.GetOptions{}); e2 != nil {
+			return nil, errors.Wrapf(e2, "failed to get ServiceAccount %s", p.sa)
+		}
+	}
+
+	klog.V(3).Infof("TokenRequest api is not supported, using a legacy token Secret for ServiceAccount %s", p.sa)
+	secret, err := core_util.GetServiceAccountTokenSecret(p.kc, p.sa)
+	if err != nil {
+		return nil, err
+	}
+	return &Token{
+		Token:  string(secret.Data[core.ServiceAccountTokenKey]),
+		Legacy: true,
+		CAData: secret.Data[core.ServiceAccountRootCAKey],
+	}, nil
+}
+
+func tokenRequestUnsupported(err error) bool {
+	return kerr.IsNotFound(err) || kerr.IsMethodNotSupported(err)
+}
+
+// RESTConfig returns a copy of the base config that authenticates as the ServiceAccount. Only the
+// server address and TLS settings of the base config are used. Clients created from the config
+// always send a fresh token, so they keep working after the first token expires.
+func (p *TokenProvider) RESTConfig(ctx context.Context, base *rest.Config) (*rest.Config, error) {
+	token, err := p.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg := p.staticConfig(base, token)
+	if !token.Legacy {
+		cfg.Wrap(transport.Wrappers(fnBearerToken(p)))
+	}
+	return cfg, nil
+}
+
+// KubeConfig returns a kubeconfig that authenticates as the ServiceAccount, built with clientcmd.BuildKubeConfig.
+// The kubeconfig embeds the current token, so it must be generated again before Token.ExpirationTime.
+func (p *TokenProvider) KubeConfig(ctx context.Context, base *rest.Config, namespace string) (*clientcmdapi.Config, error) {
+	token, err := p.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		namespace = p.sa.Namespace
+	}
+	return clientcmd.BuildKubeConfig(p.staticConfig(base, token), namespace)
+}
+
+func (p *TokenProvider) staticConfig(base *rest.Config, token *Token) *rest.Config {
+	cfg := rest.AnonymousClientConfig(base)
+	if len(cfg.CAData) == 0 && cfg.CAFile == "" && len(token.CAData) > 0 {
+		cfg.CAData = token.CAData
+	}
+	cfg.BearerToken = token.Token
+	return cfg
+}
+
+type bearerToken struct {
+	rt       http.RoundTripper
+	provider *TokenProvider
+}
+
+func (rt *bearerToken) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := rt.provider.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token.Token)
+	return rt.rt.RoundTrip(req)
+}
+
+var _ http.RoundTripper = &bearerToken{}
+
+func fnBearerToken(p *TokenProvider) func(rt http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return &bearerToken{rt, p}
+	}
+}
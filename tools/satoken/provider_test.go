@@ -0,0 +1,156 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package satoken
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authv1 "k8s.io/api/authentication/v1"
+	core "k8s.io/api/core/v1"
+	kerr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+var sa = types.NamespacedName{Namespace: "demo", Name: "agent"}
+
+func newTokenClient(now func() time.Time) (*fake.Clientset, *int) {
+	kc := fake.NewSimpleClientset()
+	issued := 0
+	kc.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "token" {
+			return false, nil, nil
+		}
+		req := action.(clienttesting.CreateAction).GetObject().(*authv1.TokenRequest)
+		issued++
+		req.Status = authv1.TokenRequestStatus{
+			Token:               fmt.Sprintf("token-%d", issued),
+			ExpirationTimestamp: metav1.NewTime(now().Add(time.Duration(*req.Spec.ExpirationSeconds) * time.Second)),
+		}
+		return true, req, nil
+	})
+	return kc, &issued
+}
+
+func TestTokenRefresh(t *testing.T) {
+	clock := time.Now()
+	now := func() time.Time { return clock }
+	kc, issued := newTokenClient(now)
+	p := NewTokenProvider(kc, sa, WithAudiences("agent"), WithExpiration(time.Hour))
+	p.now = now
+
+	token, err := p.Token(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token != "token-1" || token.Legacy {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	clock = clock.Add(30 * time.Minute)
+	if token, _ = p.Token(context.TODO()); token.Token != "token-1" {
+		t.Errorf("expected the cached token, got %s", token.Token)
+	}
+	clock = clock.Add(20 * time.Minute)
+	if token, _ = p.Token(context.TODO()); token.Token != "token-2" {
+		t.Errorf("expected a refreshed token, got %s", token.Token)
+	}
+	if *issued != 2 {
+		t.Errorf("expected 2 token requests, found %d", *issued)
+	}
+}
+
+func TestLegacyFallback(t *testing.T) {
+	kc := fake.NewSimpleClientset(
+		&core.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: sa.Name, Namespace: sa.Namespace}},
+		&core.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "agent-token",
+				Namespace:   sa.Namespace,
+				Annotations: map[string]string{core.ServiceAccountNameKey: sa.Name},
+			},
+			Type: core.SecretTypeServiceAccountToken,
+			Data: map[string][]byte{
+				core.ServiceAccountTokenKey:  []byte("legacy"),
+				core.ServiceAccountRootCAKey: []byte("ca"),
+			},
+		},
+	)
+	kc.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, kerr.NewNotFound(schema.GroupResource{Resource: "serviceaccounts/token"}, sa.Name)
+	})
+
+	p := NewTokenProvider(kc, sa)
+	cfg, err := p.KubeConfig(context.TODO(), &rest.Config{Host: "https://example.com"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth := cfg.AuthInfos["default-user"]; auth.Token != "legacy" {
+		t.Errorf("expected legacy token, got %q", auth.Token)
+	}
+	if cluster := cfg.Clusters["default-cluster"]; string(cluster.CertificateAuthorityData) != "ca" {
+		t.Errorf("expected ca from the token secret, got %q", cluster.CertificateAuthorityData)
+	}
+	if ctx := cfg.Contexts["default-context"]; ctx.Namespace != sa.Namespace {
+		t.Errorf("expected namespace %s, got %s", sa.Namespace, ctx.Namespace)
+	}
+
+	p = NewTokenProvider(kc, sa, WithoutLegacyFallback())
+	if _, err := p.Token(context.TODO()); err == nil {
+		t.Error("expected an error without legacy fallback")
+	}
+}
+
+func TestRESTConfig(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"demo"}}`))
+	}))
+	defer srv.Close()
+
+	clock := time.Now()
+	now := func() time.Time { return clock }
+	kc, _ := newTokenClient(now)
+	p := NewTokenProvider(kc, sa)
+	p.now = now
+
+	cfg, err := p.RESTConfig(context.TODO(), &rest.Config{Host: srv.URL, BearerToken: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := kubernetes.NewForConfigOrDie(cfg)
+	_, _ = client.CoreV1().Namespaces().Get(context.TODO(), "demo", metav1.GetOptions{})
+	clock = clock.Add(55 * time.Minute)
+	_, _ = client.CoreV1().Namespaces().Get(context.TODO(), "demo", metav1.GetOptions{})
+
+	want := []string{"Bearer token-1", "Bearer token-2"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
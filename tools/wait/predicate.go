@@ -0,0 +1,419 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/cli-runtime/pkg/resource"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// ObjectPredicate reports whether an object satisfies a wait condition.
+type ObjectPredicate func(obj *unstructured.Unstructured) (bool, error)
+
+// PredicateFor returns the predicate for a non-delete condition. Supported conditions are
+//
+//	condition=Ready[=True]
+//	jsonpath={.status.phase}[=Running]
+//	cel=object.status.readyReplicas == object.spec.replicas
+//
+// A jsonpath condition without a value is satisfied when the path exists.
+func PredicateFor(condition string) (ObjectPredicate, error) {
+	switch {
+	case strings.HasPrefix(condition, "condition="):
+		conditionName := condition[len("condition="):]
+		conditionValue := "true"
+		if equalsIndex := strings.Index(conditionName, "="); equalsIndex != -1 {
+			conditionValue = conditionName[equalsIndex+1:]
+			conditionName = conditionName[0:equalsIndex]
+		}
+		return ConditionalWait{
+			conditionName:   conditionName,
+			conditionStatus: conditionValue,
+		}.checkCondition, nil
+	case strings.HasPrefix(condition, "jsonpath="):
+		return JSONPathPredicate(condition[len("jsonpath="):])
+	case strings.HasPrefix(condition, "cel="):
+		return CELPredicate(condition[len("cel="):])
+	}
+	return nil, fmt.Errorf("unrecognized condition: %q", condition)
+}
+
+// JSONPathPredicate returns a predicate for a kubectl style jsonpath condition, eg, {.status.phase}=Running.
+// The expression must select exactly one value. If no value is given, the predicate is satisfied when
+// the path exists.
+func JSONPathPredicate(condition string) (ObjectPredicate, error) {
+	expr, value, hasValue := condition, "", false
+	if idx := strings.LastIndex(condition, "}"); idx != -1 && idx+1 < len(condition) && condition[idx+1] == '=' {
+		expr, value, hasValue = condition[:idx+1], condition[idx+2:], true
+	} else if idx == -1 {
+		if before, after, found := strings.Cut(condition, "="); found {
+			expr, value, hasValue = before, after, true
+		}
+	}
+	if expr == "" {
+		return nil, fmt.Errorf("jsonpath expression cannot be empty")
+	}
+	if !strings.HasPrefix(expr, "{") {
+		expr = "{" + expr + "}"
+	}
+
+	j := jsonpath.New("wait").AllowMissingKeys(true)
+	if err := j.Parse(expr); err != nil {
+		return nil, fmt.Errorf("failed to parse jsonpath %s: %w", expr, err)
+	}
+
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		results, err := j.FindResults(obj.Object)
+		if err != nil {
+			return false, err
+		}
+		var values []reflect.Value
+		for _, r := range results {
+			values = append(values, r...)
+		}
+		if len(values) == 0 {
+			return false, nil
+		}
+		if len(values) > 1 {
+			return false, fmt.Errorf("jsonpath %s selected %d values, expected exactly one", expr, len(values))
+		}
+		if !hasValue {
+			return true, nil
+		}
+		v := values[0]
+		if !v.IsValid() || !v.CanInterface() {
+			return false, nil
+		}
+		switch x := v.Interface().(type) {
+		case map[string]any, []any:
+			return false, fmt.Errorf("jsonpath %s selected a non-primitive value", expr)
+		case nil:
+			return value == "" || value == "null", nil
+		default:
+			return fmt.Sprintf("%v", x) == value, nil
+		}
+	}, nil
+}
+
+// CELPredicate returns a predicate for a CEL expression evaluated against the object.
+// The object is available as the "object" variable and the expression must return a bool,
+// eg, object.status.readyReplicas == object.spec.replicas.
+func CELPredicate(expr string) (ObjectPredicate, error) {
+	env, err := cel.NewEnv(cel.Variable("object", cel.DynType))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("failed to compile CEL expression %q: %w", expr, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("CEL expression %q must return a bool, found %v", expr, ast.OutputType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	paths := selectedPaths(ast)
+
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		out, _, err := prg.Eval(map[string]any{
+			"object": obj.Object,
+		})
+		if err != nil {
+			// missing fields are expected while the object is being reconciled
+			if hasMissingPath(obj, paths) {
+				return false, nil
+			}
+			return false, err
+		}
+		result, ok := out.Value().(bool)
+		if !ok {
+			return false, fmt.Errorf("CEL expression %q returned %T, expected bool", expr, out.Value())
+		}
+		return result, nil
+	}, nil
+}
+
+// selectedPaths returns the field paths of the object selected by the expression, eg, [status readyReplicas]
+// for object.status.readyReplicas. Only the operand of a has() test must exist.
+func selectedPaths(a *cel.Ast) [][]string {
+	var paths [][]string
+	celast.PreOrderVisit(a.NativeRep().Expr(), celast.NewExprVisitor(func(e celast.Expr) {
+		if e.Kind() != celast.SelectKind {
+			return
+		}
+		sel := e.AsSelect()
+		path, ok := objectPath(sel.Operand())
+		if !ok {
+			return
+		}
+		if !sel.IsTestOnly() {
+			path = append(path, sel.FieldName())
+		}
+		if len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}))
+	return paths
+}
+
+// objectPath returns the field path of a chain of field selections on the object variable.
+func objectPath(e celast.Expr) ([]string, bool) {
+	switch e.Kind() {
+	case celast.IdentKind:
+		return nil, e.AsIdent() == "object"
+	case celast.SelectKind:
+		sel := e.AsSelect()
+		if sel.IsTestOnly() {
+			return nil, false
+		}
+		path, ok := objectPath(sel.Operand())
+		if !ok {
+			return nil, false
+		}
+		return append(path, sel.FieldName()), true
+	}
+	return nil, false
+}
+
+func hasMissingPath(obj *unstructured.Unstructured, paths [][]string) bool {
+	for _, path := range paths {
+		if _, found, err := unstructured.NestedFieldNoCopy(obj.Object, path...); err == nil && !found {
+			return true
+		}
+	}
+	return false
+}
+
+// AllOf returns a predicate that is satisfied when all the predicates are satisfied.
+func AllOf(predicates ...ObjectPredicate) ObjectPredicate {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		for _, p := range predicates {
+			if ok, err := p(obj); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+// AnyOf returns a predicate that is satisfied when any of the predicates is satisfied.
+func AnyOf(predicates ...ObjectPredicate) ObjectPredicate {
+	return func(obj *unstructured.Unstructured) (bool, error) {
+		var errs []error
+		for _, p := range predicates {
+			ok, err := p(obj)
+			if ok {
+				return true, nil
+			}
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return false, errors.Join(errs...)
+	}
+}
+
+// PredicatesFor returns the predicates for a list of non-delete conditions.
+func PredicatesFor(conditions []string) ([]ObjectPredicate, error) {
+	predicates := make([]ObjectPredicate, 0, len(conditions))
+	for _, c := range conditions {
+		p, err := PredicateFor(c)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+	return predicates, nil
+}
+
+// ConditionFuncForAll returns a condition func that waits until every condition is met for a resource.
+func ConditionFuncForAll(conditions []string, errOut io.Writer) (ConditionFunc, error) {
+	predicates, err := PredicatesFor(conditions)
+	if err != nil {
+		return nil, err
+	}
+	return PredicateWait{predicate: AllOf(predicates...), errOut: errOut}.IsConditionMet, nil
+}
+
+// ConditionFuncForAny returns a condition func that waits until any of the conditions is met for a resource.
+func ConditionFuncForAny(conditions []string, errOut io.Writer) (ConditionFunc, error) {
+	predicates, err := PredicatesFor(conditions)
+	if err != nil {
+		return nil, err
+	}
+	return PredicateWait{predicate: AnyOf(predicates...), errOut: errOut}.IsConditionMet, nil
+}
+
+// RunWaitAny waits until any of the resources found by the ResourceFinder satisfies the predicate.
+// Unlike RunWait, which requires every resource to satisfy the ConditionFn, this polls all the resources
+// every interval and returns as soon as one of them satisfies the predicate.
+func (o *WaitOptions) RunWaitAny(predicate ObjectPredicate, interval time.Duration) error {
+	var infos []*resource.Info
+	err := o.ResourceFinder.Do().Visit(func(info *resource.Info, err error) error {
+		if err != nil {
+			return err
+		}
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 {
+		return errNoMatchingResources
+	}
+
+	var lastErr error
+	err = wait.PollUntilContextTimeout(context.Background(), interval, o.Timeout, true, func(ctx context.Context) (bool, error) {
+		for _, info := range infos {
+			obj, err := o.DynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace).Get(ctx, info.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				lastErr = err
+				continue
+			}
+			ok, err := predicate(obj)
+			if ok {
+				_ = o.Printer.PrintObj(obj, o.Out)
+				return true, nil
+			}
+			if err != nil {
+				lastErr = err
+			}
+		}
+		return false, nil
+	})
+	if wait.Interrupted(err) {
+		return errors.Join(fmt.Errorf("timed out waiting for any of %d resources to satisfy the condition", len(infos)), lastErr)
+	}
+	return err
+}
+
+// PredicateWait holds information to wait on an object predicate.
+type PredicateWait struct {
+	predicate ObjectPredicate
+	// errOut is written to if an error occurs
+	errOut io.Writer
+}
+
+// NewPredicateWait returns a PredicateWait for the predicate.
+func NewPredicateWait(predicate ObjectPredicate, errOut io.Writer) PredicateWait {
+	return PredicateWait{predicate: predicate, errOut: errOut}
+}
+
+// IsConditionMet is a conditionfunc for waiting on the predicate to be satisfied
+func (w PredicateWait) IsConditionMet(info *resource.Info, o *WaitOptions) (runtime.Object, bool, error) {
+	endTime := time.Now().Add(o.Timeout)
+	for {
+		if len(info.Name) == 0 {
+			return info.Object, false, fmt.Errorf("resource name must be provided")
+		}
+
+		nameSelector := fields.OneTermEqualSelector("metadata.name", info.Name).String()
+
+		var gottenObj *unstructured.Unstructured
+		// List with a name field selector to get the current resourceVersion to watch from (not the object's resourceVersion)
+		gottenObjList, err := o.DynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace).List(context.TODO(), metav1.ListOptions{FieldSelector: nameSelector})
+
+		resourceVersion := ""
+		switch {
+		case err != nil:
+			return info.Object, false, err
+		case len(gottenObjList.Items) != 1:
+			resourceVersion = gottenObjList.GetResourceVersion()
+		default:
+			gottenObj = &gottenObjList.Items[0]
+			conditionMet, err := w.predicate(gottenObj)
+			if conditionMet {
+				return gottenObj, true, nil
+			}
+			if err != nil {
+				return gottenObj, false, err
+			}
+			resourceVersion = gottenObjList.GetResourceVersion()
+		}
+
+		watchOptions := metav1.ListOptions{}
+		watchOptions.FieldSelector = nameSelector
+		watchOptions.ResourceVersion = resourceVersion
+		objWatch, err := o.DynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace).Watch(context.TODO(), watchOptions)
+		if err != nil {
+			return gottenObj, false, err
+		}
+
+		timeout := time.Until(endTime)
+		errWaitTimeoutWithName := extendErrWaitTimeout(info)
+		if timeout < 0 {
+			// we're out of time
+			return gottenObj, false, errWaitTimeoutWithName
+		}
+
+		ctx, cancel := watchtools.ContextWithOptionalTimeout(context.Background(), o.Timeout)
+		watchEvent, err := watchtools.UntilWithoutRetry(ctx, objWatch, w.isConditionMet)
+		cancel()
+		switch {
+		case err == nil:
+			return watchEvent.Object, true, nil
+		case errors.Is(err, watchtools.ErrWatchClosed):
+			continue
+		case wait.Interrupted(err):
+			if watchEvent != nil {
+				return watchEvent.Object, false, errWaitTimeoutWithName
+			}
+			return gottenObj, false, errWaitTimeoutWithName
+		default:
+			return gottenObj, false, err
+		}
+	}
+}
+
+func (w PredicateWait) isConditionMet(event watch.Event) (bool, error) {
+	if event.Type == watch.Error {
+		// keep waiting in the event we see an error - we expect the watch to be closed by
+		// the server
+		err := apierrors.FromObject(event.Object)
+		_, _ = fmt.Fprintf(w.errOut, "error: An error occurred while waiting for the condition to be satisfied: %v", err)
+		return false, nil
+	}
+	if event.Type == watch.Deleted {
+		// this will chain back out, result in another get and an return false back up the chain
+		return false, nil
+	}
+	obj := event.Object.(*unstructured.Unstructured)
+	return w.predicate(obj)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright AppsCode Inc. and Contributors
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wait
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newDeploymentObject(replicas, readyReplicas int64, phase string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{
+		Object: map[string]any{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata": map[string]any{
+				"namespace": "default",
+				"name":      "demo",
+			},
+			"spec": map[string]any{
+				"replicas": replicas,
+			},
+			"status": map[string]any{
+				"readyReplicas": readyReplicas,
+				"phase":         phase,
+				"conditions": []any{
+					map[string]any{"type": "Available", "status": "True"},
+				},
+			},
+		},
+	}
+}
+
+func TestPredicateFor(t *testing.T) {
+	tests := []struct {
+		condition string
+		obj       *unstructured.Unstructured
+		want      bool
+		wantErr   bool
+	}{
+		{condition: "jsonpath={.status.phase}=Running", obj: newDeploymentObject(3, 3, "Running"), want: true},
+		{condition: "jsonpath={.status.phase}=Running", obj: newDeploymentObject(3, 3, "Pending"), want: false},
+		{condition: "jsonpath={.status.readyReplicas}=3", obj: newDeploymentObject(3, 3, "Running"), want: true},
+		{condition: "jsonpath=.status.phase=Running", obj: newDeploymentObject(3, 3, "Running"), want: true},
+		{condition: "jsonpath={.status.phase}", obj: newDeploymentObject(3, 3, "Running"), want: true},
+		{condition: "jsonpath={.status.missing}", obj: newDeploymentObject(3, 3, "Running"), want: false},
+		{condition: `jsonpath={.status.conditions[?(@.type=="Available")].status}=True`, obj: newDeploymentObject(3, 3, "Running"), want: true},
+		{condition: "jsonpath={.status}=Running", obj: newDeploymentObject(3, 3, "Running"), wantErr: true},
+		{condition: "cel=object.status.readyReplicas == object.spec.replicas", obj: newDeploymentObject(3, 3, "Running"), want: true},
+		{condition: "cel=object.status.readyReplicas == object.spec.replicas", obj: newDeploymentObject(3, 1, "Running"), want: false},
+		{condition: "cel=object.status.notThere == 1", obj: newDeploymentObject(3, 1, "Running"), want: false},
+		{condition: "cel=object.metadata.name", obj: newDeploymentObject(3, 1, "Running"), wantErr: true},
+		{condition: "cel=object.missing.nested.field == 1", obj: newDeploymentObject(3, 1, "Running"), want: false},
+		{condition: "cel=!has(object.status.notThere) || object.status.notThere == 1", obj: newDeploymentObject(3, 1, "Running"), want: true},
+		{condition: "cel=object.spec.replicas / 0 == 1", obj: newDeploymentObject(3, 1, "Running"), wantErr: true},
+		{condition: "condition=Available", obj: newDeploymentObject(3, 1, "Running"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			p, err := PredicateFor(tt.condition)
+			if err != nil {
+				t.Fatalf("PredicateFor() error = %v", err)
+			}
+			got, err := p(tt.obj)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("predicate error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("predicate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPredicateForInvalid(t *testing.T) {
+	for _, condition := range []string{"cel=object.status.", "cel=1 + 2", "jsonpath={.status[}", "unknown=value"} {
+		if _, err := PredicateFor(condition); err == nil {
+			t.Errorf("PredicateFor(%q) expected error", condition)
+		}
+	}
+}
+
+func TestAllOfAnyOf(t *testing.T) {
+	obj := newDeploymentObject(3, 1, "Running")
+	preds, err := PredicatesFor([]string{"jsonpath={.status.phase}=Running", "cel=object.status.readyReplicas == 3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := AllOf(preds...)(obj); ok {
+		t.Error("AllOf expected to be unsatisfied")
+	}
+	if ok, _ := AnyOf(preds...)(obj); !ok {
+		t.Error("AnyOf expected to be satisfied")
+	}
+}
@@ -62,6 +62,17 @@ func ConditionFuncFor(condition string, errOut io.Writer) (ConditionFunc, error)
 		}.IsConditionMet, nil
 	}
 
+	if strings.HasPrefix(condition, "jsonpath=") || strings.HasPrefix(condition, "cel=") {
+		predicate, err := PredicateFor(condition)
+		if err != nil {
+			return nil, err
+		}
+		return PredicateWait{
+			predicate: predicate,
+			errOut:    errOut,
+		}.IsConditionMet, nil
+	}
+
 	return nil, fmt.Errorf("unrecognized condition: %q", condition)
 }
 
@@ -122,7 +133,9 @@ func (o *WaitOptions) RunWait() error {
 }
 
 func (o *WaitOptions) WaitUntilAvailable(forCondition string) error {
-	if strings.HasPrefix(forCondition, "condition=") {
+	if strings.HasPrefix(forCondition, "condition=") ||
+		strings.HasPrefix(forCondition, "jsonpath=") ||
+		strings.HasPrefix(forCondition, "cel=") {
 		// Wait for the resources to be available
 		return wait.PollUntilContextTimeout(context.Background(), 10*time.Second, o.Timeout, true, func(ctx context.Context) (bool, error) {
 			visitCount := 0
@@ -241,68 +254,7 @@ type ConditionalWait struct {
 
 // IsConditionMet is a conditionfunc for waiting on an API condition to be met
 func (w ConditionalWait) IsConditionMet(info *resource.Info, o *WaitOptions) (runtime.Object, bool, error) {
-	endTime := time.Now().Add(o.Timeout)
-	for {
-		if len(info.Name) == 0 {
-			return info.Object, false, fmt.Errorf("resource name must be provided")
-		}
-
-		nameSelector := fields.OneTermEqualSelector("metadata.name", info.Name).String()
-
-		var gottenObj *unstructured.Unstructured
-		// List with a name field selector to get the current resourceVersion to watch from (not the object's resourceVersion)
-		gottenObjList, err := o.DynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace).List(context.TODO(), metav1.ListOptions{FieldSelector: nameSelector})
-
-		resourceVersion := ""
-		switch {
-		case err != nil:
-			return info.Object, false, err
-		case len(gottenObjList.Items) != 1:
-			resourceVersion = gottenObjList.GetResourceVersion()
-		default:
-			gottenObj = &gottenObjList.Items[0]
-			conditionMet, err := w.checkCondition(gottenObj)
-			if conditionMet {
-				return gottenObj, true, nil
-			}
-			if err != nil {
-				return gottenObj, false, err
-			}
-			resourceVersion = gottenObjList.GetResourceVersion()
-		}
-
-		watchOptions := metav1.ListOptions{}
-		watchOptions.FieldSelector = nameSelector
-		watchOptions.ResourceVersion = resourceVersion
-		objWatch, err := o.DynamicClient.Resource(info.Mapping.Resource).Namespace(info.Namespace).Watch(context.TODO(), watchOptions)
-		if err != nil {
-			return gottenObj, false, err
-		}
-
-		timeout := time.Until(endTime)
-		errWaitTimeoutWithName := extendErrWaitTimeout(info)
-		if timeout < 0 {
-			// we're out of time
-			return gottenObj, false, errWaitTimeoutWithName
-		}
-
-		ctx, cancel := watchtools.ContextWithOptionalTimeout(context.Background(), o.Timeout)
-		watchEvent, err := watchtools.UntilWithoutRetry(ctx, objWatch, w.isConditionMet)
-		cancel()
-		switch {
-		case err == nil:
-			return watchEvent.Object, true, nil
-		case errors.Is(err, watchtools.ErrWatchClosed):
-			continue
-		case wait.Interrupted(err):
-			if watchEvent != nil {
-				return watchEvent.Object, false, errWaitTimeoutWithName
-			}
-			return gottenObj, false, errWaitTimeoutWithName
-		default:
-			return gottenObj, false, err
-		}
-	}
+	return PredicateWait{predicate: w.checkCondition, errOut: w.errOut}.IsConditionMet(info, o)
 }
 
 func (w ConditionalWait) checkCondition(obj *unstructured.Unstructured) (bool, error) {
@@ -329,22 +281,6 @@ func (w ConditionalWait) checkCondition(obj *unstructured.Unstructured) (bool, e
 	return false, nil
 }
 
-func (w ConditionalWait) isConditionMet(event watch.Event) (bool, error) {
-	if event.Type == watch.Error {
-		// keep waiting in the event we see an error - we expect the watch to be closed by
-		// the server
-		err := apierrors.FromObject(event.Object)
-		_, _ = fmt.Fprintf(w.errOut, "error: An error occurred while waiting for the condition to be satisfied: %v", err)
-		return false, nil
-	}
-	if event.Type == watch.Deleted {
-		// this will chain back out, result in another get and an return false back up the chain
-		return false, nil
-	}
-	obj := event.Object.(*unstructured.Unstructured)
-	return w.checkCondition(obj)
-}
-
 func extendErrWaitTimeout(info *resource.Info) error {
 	return wait.ErrorInterrupted(fmt.Errorf("timed out waiting for the condition on %s/%s", info.Mapping.Resource.Resource, info.Name))
 }